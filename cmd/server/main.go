@@ -7,8 +7,10 @@ import (
 	"os/signal"
 	"syscall"
 
+	"em_tz_anvar/internal/auth"
 	"em_tz_anvar/internal/config"
 	"em_tz_anvar/internal/handler"
+	"em_tz_anvar/internal/policy"
 	"em_tz_anvar/internal/repository"
 	"em_tz_anvar/internal/server"
 	"em_tz_anvar/internal/service"
@@ -26,6 +28,16 @@ import (
 // @BasePath /api/v1
 
 // @schemes http
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT в формате "Bearer <token>"
+
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description API-ключ сервисного клиента, права задаются скоупами
 func main() {
 	//Flag parsing
 	configPath := flag.String("config", "config.yaml", "path to config file")
@@ -52,11 +64,42 @@ func main() {
 	defer db.Close()
 	log.Info().Msg("Connected to database")
 
-	repos := repository.NewRepository(db)
-	services := service.NewService(repos)
-	handlers := handler.NewHandler(services)
+	repos := repository.NewRepository(db, service.BuildCharges)
+	//Policy: проверки доступа по ролям поверх сервисов
+	services := policy.Wrap(service.NewService(repos, &cfg.Validation), repos.Subscription)
+
+	//Charges ledger: backfill and horizon shift in background, cost reports extend it on demand
+	go func() {
+		if _, err := services.Subscription.RebuildCharges(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Failed to rebuild charges ledger")
+		}
+	}()
+
+	//Idempotency keys: истекшие ответы больше не нужны
+	if purged, err := services.Idempotency.PurgeExpired(context.Background()); err != nil {
+		log.Warn().Err(err).Msg("Failed to purge expired idempotency keys")
+	} else if purged > 0 {
+		log.Info().Int64("keys", purged).Msg("Expired idempotency keys purged")
+	}
+
+	//Auth: без auth.enabled API открыт, как раньше
+	var verifier *auth.Verifier
+	if cfg.Auth.Enabled {
+		verifier, err = auth.NewVerifier(&cfg.Auth)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to configure authentication")
+		}
+		log.Info().Msg("Bearer token authentication enabled")
+	} else {
+		log.Warn().Msg("Authentication is disabled, API is open")
+	}
 
-	srv := server.NewServer(cfg, handlers)
+	handlers := handler.NewHandler(services, verifier, &cfg.RateLimit)
+
+	srv, err := server.NewServer(cfg, handlers)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure server")
+	}
 
 	//Graceful shutdown
 	go func() {
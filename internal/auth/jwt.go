@@ -0,0 +1,255 @@
+// Package auth проверяет bearer-токены (JWT, HS256 и RS256) без обращения к внешним сервисам
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"em_tz_anvar/internal/config"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// clockSkew допустимое расхождение часов при проверке exp и nbf
+const clockSkew = 30 * time.Second
+
+// Verifier проверяет подпись и claims токена
+type Verifier struct {
+	hmacSecret  []byte
+	rsaKey      *rsa.PublicKey
+	issuer      string
+	audience    string
+	adminRole   string
+	analystRole string
+	now         func() time.Time
+}
+
+// NewVerifier собирает Verifier из конфигурации; нужен хотя бы один ключ
+func NewVerifier(cfg *config.AuthConfig) (*Verifier, error) {
+	v := &Verifier{
+		issuer:      cfg.Issuer,
+		audience:    cfg.Audience,
+		adminRole:   cfg.AdminRole,
+		analystRole: cfg.AnalystRole,
+		now:         time.Now,
+	}
+
+	if cfg.HS256Secret != "" {
+		v.hmacSecret = []byte(cfg.HS256Secret)
+	}
+
+	if cfg.RS256PublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.RS256PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RS256 public key: %w", err)
+		}
+		key, err := ParseRSAPublicKey(data)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKey = key
+	}
+
+	if v.hmacSecret == nil && v.rsaKey == nil {
+		return nil, errors.New("auth: neither hs256_secret nor rs256_public_key_file is set")
+	}
+
+	return v, nil
+}
+
+// ParseRSAPublicKey разбирает PEM с ключом в формате PKIX ("PUBLIC KEY") или PKCS#1 ("RSA PUBLIC KEY")
+func ParseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("auth: RS256 public key is not PEM")
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("auth: invalid RS256 public key: %w", err)
+		}
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("auth: invalid RS256 public key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("auth: public key is not RSA")
+	}
+	return key, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// claims поля токена, которые понимает сервис. user_id можно не указывать, если sub — UUID пользователя
+type claims struct {
+	Subject   string          `json:"sub"`
+	UserID    string          `json:"user_id"`
+	Roles     []string        `json:"roles"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+}
+
+// Verify проверяет токен и возвращает личность вызывающего
+func (v *Verifier) Verify(token string) (*reqctx.Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding", ErrInvalidToken)
+	}
+	if err := v.verifySignature(h.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	return v.identity(&c)
+}
+
+// verifySignature алгоритм берется из заголовка, но только среди тех, для которых настроен ключ
+func (v *Verifier) verifySignature(alg, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case "HS256":
+		if v.hmacSecret == nil {
+			return fmt.Errorf("%w: HS256 is not accepted", ErrInvalidToken)
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case "RS256":
+		if v.rsaKey == nil {
+			return fmt.Errorf("%w: RS256 is not accepted", ErrInvalidToken)
+		}
+		if err := rsa.VerifyPKCS1v15(v.rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, alg)
+	}
+	return nil
+}
+
+func (v *Verifier) identity(c *claims) (*reqctx.Identity, error) {
+	now := v.now()
+
+	if c.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: exp is required", ErrInvalidToken)
+	}
+	if now.After(time.Unix(*c.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, ErrTokenExpired
+	}
+	if c.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*c.NotBefore, 0)) {
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.audience != "" && !hasAudience(c.Audience, v.audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: sub is required", ErrInvalidToken)
+	}
+
+	id := &reqctx.Identity{Subject: c.Subject, Role: v.role(c.Roles)}
+
+	userID := c.UserID
+	if userID == "" {
+		userID = c.Subject
+	}
+	if parsed, err := uuid.Parse(userID); err == nil {
+		id.UserID = parsed
+	} else if id.Role == reqctx.RoleUser || c.UserID != "" {
+		// Без user_id обычный пользователь не может владеть подписками
+		return nil, fmt.Errorf("%w: user_id is not a UUID", ErrInvalidToken)
+	}
+
+	return id, nil
+}
+
+// role роль из claim roles; админ сильнее аналитика, без известных ролей — обычный пользователь
+func (v *Verifier) role(roles []string) string {
+	role := reqctx.RoleUser
+	for _, r := range roles {
+		switch {
+		case r == v.adminRole && v.adminRole != "":
+			return reqctx.RoleAdmin
+		case r == v.analystRole && v.analystRole != "":
+			role = reqctx.RoleAnalyst
+		}
+	}
+	return role
+}
+
+// hasAudience aud по RFC 7519 — строка или массив строк
+func hasAudience(raw json.RawMessage, want string) bool {
+	if len(raw) == 0 {
+		return false
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == want
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return false
+	}
+	for _, aud := range list {
+		if aud == want {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
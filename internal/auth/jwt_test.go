@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/config"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "test-secret"
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret string, claims map[string]interface{}) string {
+	input := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	input := encodeSegment(t, map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newHS256Verifier(t *testing.T) *Verifier {
+	v, err := NewVerifier(&config.AuthConfig{HS256Secret: testSecret, AdminRole: "admin", AnalystRole: "analyst"})
+	require.NoError(t, err)
+	return v
+}
+
+func TestVerifier_HS256(t *testing.T) {
+	v := newHS256Verifier(t)
+	userID := uuid.New()
+
+	token := signHS256(t, testSecret, map[string]interface{}{
+		"sub": userID.String(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	identity, err := v.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, userID, identity.UserID)
+	assert.Equal(t, userID.String(), identity.Subject)
+	assert.Equal(t, reqctx.RoleUser, identity.Role)
+}
+
+func TestVerifier_Admin(t *testing.T) {
+	v := newHS256Verifier(t)
+
+	// Админу user_id не обязателен
+	token := signHS256(t, testSecret, map[string]interface{}{
+		"sub":   "ops@example.com",
+		"roles": []string{"admin"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	identity, err := v.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, reqctx.RoleAdmin, identity.Role)
+	assert.Equal(t, uuid.Nil, identity.UserID)
+}
+
+func TestVerifier_Roles(t *testing.T) {
+	v := newHS256Verifier(t)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  string
+	}{
+		{name: "no roles", roles: nil, want: reqctx.RoleUser},
+		{name: "unknown role", roles: []string{"viewer"}, want: reqctx.RoleUser},
+		{name: "analyst", roles: []string{"analyst"}, want: reqctx.RoleAnalyst},
+		{name: "admin wins", roles: []string{"analyst", "admin"}, want: reqctx.RoleAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signHS256(t, testSecret, map[string]interface{}{"sub": uuid.New().String(), "roles": tt.roles, "exp": exp})
+			identity, err := v.Verify(token)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, identity.Role)
+		})
+	}
+
+	// Аналитику, как и админу, user_id не обязателен
+	token := signHS256(t, testSecret, map[string]interface{}{"sub": "bi@example.com", "roles": []string{"analyst"}, "exp": exp})
+	identity, err := v.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, identity.UserID)
+}
+
+func TestVerifier_EmptyRoleNames(t *testing.T) {
+	v, err := NewVerifier(&config.AuthConfig{HS256Secret: testSecret})
+	require.NoError(t, err)
+
+	// Пустая строка в roles не должна совпасть с ненастроенной ролью
+	token := signHS256(t, testSecret, map[string]interface{}{
+		"sub":   uuid.New().String(),
+		"roles": []string{""},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	identity, err := v.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, reqctx.RoleUser, identity.Role)
+}
+
+func TestVerifier_Rejects(t *testing.T) {
+	v := newHS256Verifier(t)
+	exp := time.Now().Add(time.Hour).Unix()
+	userID := uuid.New().String()
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{name: "wrong secret", token: signHS256(t, "other", map[string]interface{}{"sub": userID, "exp": exp}), want: ErrInvalidToken},
+		{name: "expired", token: signHS256(t, testSecret, map[string]interface{}{"sub": userID, "exp": time.Now().Add(-time.Hour).Unix()}), want: ErrTokenExpired},
+		{name: "no exp", token: signHS256(t, testSecret, map[string]interface{}{"sub": userID}), want: ErrInvalidToken},
+		{name: "not yet valid", token: signHS256(t, testSecret, map[string]interface{}{"sub": userID, "exp": exp, "nbf": time.Now().Add(time.Minute * 10).Unix()}), want: ErrInvalidToken},
+		{name: "sub is not uuid", token: signHS256(t, testSecret, map[string]interface{}{"sub": "alice", "exp": exp}), want: ErrInvalidToken},
+		{name: "alg none", token: encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, map[string]interface{}{"sub": userID, "exp": exp}) + ".", want: ErrInvalidToken},
+		{name: "malformed", token: "abc.def", want: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := v.Verify(tt.token)
+			assert.ErrorIs(t, err, tt.want)
+			assert.Nil(t, identity)
+		})
+	}
+}
+
+func TestVerifier_IssuerAndAudience(t *testing.T) {
+	v, err := NewVerifier(&config.AuthConfig{HS256Secret: testSecret, Issuer: "idp", Audience: "subscriptions", AdminRole: "admin"})
+	require.NoError(t, err)
+	claims := func(iss string, aud interface{}) map[string]interface{} {
+		return map[string]interface{}{"sub": uuid.New().String(), "exp": time.Now().Add(time.Hour).Unix(), "iss": iss, "aud": aud}
+	}
+
+	_, err = v.Verify(signHS256(t, testSecret, claims("idp", []string{"billing", "subscriptions"})))
+	assert.NoError(t, err)
+	_, err = v.Verify(signHS256(t, testSecret, claims("idp", "subscriptions")))
+	assert.NoError(t, err)
+	_, err = v.Verify(signHS256(t, testSecret, claims("other", "subscriptions")))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = v.Verify(signHS256(t, testSecret, claims("idp", "billing")))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifier_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "public.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	v, err := NewVerifier(&config.AuthConfig{RS256PublicKeyFile: keyFile, AdminRole: "admin"})
+	require.NoError(t, err)
+	userID := uuid.New()
+
+	token := signRS256(t, key, map[string]interface{}{"sub": "alice", "user_id": userID.String(), "exp": time.Now().Add(time.Hour).Unix()})
+	identity, err := v.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", identity.Subject)
+	assert.Equal(t, userID, identity.UserID)
+
+	// HS256-токен не принимается, если секрет не настроен
+	_, err = v.Verify(signHS256(t, testSecret, map[string]interface{}{"sub": userID.String(), "exp": time.Now().Add(time.Hour).Unix()}))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestNewVerifier_NoKeys(t *testing.T) {
+	_, err := NewVerifier(&config.AuthConfig{Enabled: true})
+	assert.Error(t, err)
+}
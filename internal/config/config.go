@@ -8,9 +8,12 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Logger   LoggerConfig
+	Server     ServerConfig
+	Database   DatabaseConfig
+	Logger     LoggerConfig
+	Auth       AuthConfig
+	RateLimit  RateLimitConfig  `mapstructure:"rate_limit"`
+	Validation ValidationConfig `mapstructure:"validation"`
 }
 
 type ServerConfig struct {
@@ -18,6 +21,8 @@ type ServerConfig struct {
 	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
 	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// TrustedProxies адреса и подсети прокси, чьему X-Forwarded-For верить; пусто — клиент определяется по адресу соединения
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -37,6 +42,54 @@ type LoggerConfig struct {
 	Format string `mapstructure:"format"`
 }
 
+// AuthConfig проверка bearer-токенов (JWT). Достаточно одного ключа: HS256-секрета или публичного RS256-ключа
+type AuthConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	HS256Secret        string `mapstructure:"hs256_secret"`
+	RS256PublicKeyFile string `mapstructure:"rs256_public_key_file"` // PEM
+	Issuer             string `mapstructure:"issuer"`                // пусто — iss не проверяется
+	Audience           string `mapstructure:"audience"`              // пусто — aud не проверяется
+	AdminRole          string `mapstructure:"admin_role"`
+	AnalystRole        string `mapstructure:"analyst_role"`
+}
+
+// RateLimitConfig ограничение частоты запросов на клиента (API-ключ или IP) по группам маршрутов
+type RateLimitConfig struct {
+	Enabled bool                 `mapstructure:"enabled"`
+	Default RateLimit            `mapstructure:"default"`
+	Groups  map[string]RateLimit `mapstructure:"groups"` // ip, subscriptions, services, audit, exchange_rates, api_keys
+}
+
+// RateLimit token bucket: RequestsPerSecond — скорость пополнения, Burst — емкость.
+// RequestsPerSecond <= 0 — без ограничения
+type RateLimit struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int     `mapstructure:"burst"`
+}
+
+// For лимит группы маршрутов; для группы без своей настройки — Default
+func (c *RateLimitConfig) For(group string) RateLimit {
+	if limit, ok := c.Groups[group]; ok {
+		return limit
+	}
+	return c.Default
+}
+
+// ValidationConfig настраиваемые доменные правила подписок. Нулевое значение правила — без ограничения
+type ValidationConfig struct {
+	MaxPrice            int      `mapstructure:"max_price"`
+	MaxStartMonthsAhead int      `mapstructure:"max_start_months_ahead"` // насколько позже текущего месяца может начинаться подписка
+	AllowedServiceNames []string `mapstructure:"allowed_service_names"`  // каталог сервисов; пусто — любое название
+	OverlapMode         string   `mapstructure:"overlap_mode"`           // подписки пользователя на один сервис с пересекающимися периодами
+}
+
+// Режимы ValidationConfig.OverlapMode. Пустой режим — OverlapOff
+const (
+	OverlapOff    = "off"    // не проверять
+	OverlapWarn   = "warn"   // записать и вернуть ID пересекающихся подписок в ответе
+	OverlapReject = "reject" // отклонить запись (409)
+)
+
 func Load(configPath string) (*Config, error) {
 	viper.SetConfigFile(configPath)
 	viper.SetConfigType("yaml")
@@ -51,6 +104,16 @@ func Load(configPath string) (*Config, error) {
 	viper.BindEnv("database.sslmode", "DB_SSLMODE")
 	viper.BindEnv("server.port", "SERVER_PORT")
 	viper.BindEnv("logger.level", "LOG_LEVEL")
+	viper.BindEnv("auth.enabled", "AUTH_ENABLED")
+	viper.BindEnv("auth.hs256_secret", "AUTH_HS256_SECRET")
+	viper.BindEnv("auth.rs256_public_key_file", "AUTH_RS256_PUBLIC_KEY_FILE")
+	viper.BindEnv("rate_limit.enabled", "RATE_LIMIT_ENABLED")
+
+	viper.SetDefault("auth.admin_role", "admin")
+	viper.SetDefault("auth.analyst_role", "analyst")
+	viper.SetDefault("validation.max_price", 1000000)
+	viper.SetDefault("validation.max_start_months_ahead", 12)
+	viper.SetDefault("validation.overlap_mode", OverlapWarn)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -61,6 +124,12 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	switch cfg.Validation.OverlapMode {
+	case "", OverlapOff, OverlapWarn, OverlapReject:
+	default:
+		return nil, fmt.Errorf("invalid validation.overlap_mode %q, expected off, warn or reject", cfg.Validation.OverlapMode)
+	}
+
 	return &cfg, nil
 }
 
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateAPIKey выпускает API-ключ
+// @Summary Выпуск API-ключа
+// @Description Ключ для сервисных клиентов. Значение key возвращается только в этом ответе, хранится лишь его хеш.
+// @Description Скоупы: subscriptions:read, subscriptions:write, cost:read, services:write, rates:read, rates:write, audit:read
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param input body models.CreateAPIKeyReq true "Имя, скоупы и срок действия"
+// @Success 201 {object} models.APIKeySecret
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /api-keys [post]
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidBody(c, err)
+		return
+	}
+
+	key, err := h.services.APIKey.Create(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// GetAPIKeys возвращает список API-ключей
+// @Summary Список API-ключей
+// @Description Все ключи, включая отозванные, без секретов
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /api-keys [get]
+func (h *Handler) GetAPIKeys(c *gin.Context) {
+	keys, err := h.services.APIKey.List(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey отзывает API-ключ
+// @Summary Отзыв API-ключа
+// @Tags api-keys
+// @Param id path string true "ID ключа (UUID)"
+// @Success 204 "No Content"
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /api-keys/{id} [delete]
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	if err := h.services.APIKey.Revoke(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RotateAPIKey выдает ключу новый секрет
+// @Summary Ротация API-ключа
+// @Description Новый секрет с теми же скоупами и сроком, старый перестает действовать сразу
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "ID ключа (UUID)"
+// @Success 200 {object} models.APIKeySecret
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /api-keys/{id}/rotate [post]
+func (h *Handler) RotateAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	key, err := h.services.APIKey.Rotate(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
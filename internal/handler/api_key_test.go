@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/policy"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/reqctx"
+	"em_tz_anvar/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockAPIKeyService реализует service.APIKeyService для тестов
+type mockAPIKeyService struct {
+	createFn       func(ctx context.Context, req *models.CreateAPIKeyReq) (*models.APIKeySecret, error)
+	revokeFn       func(ctx context.Context, id uuid.UUID) error
+	authenticateFn func(ctx context.Context, key string) (*reqctx.Identity, error)
+}
+
+func (m *mockAPIKeyService) Create(ctx context.Context, req *models.CreateAPIKeyReq) (*models.APIKeySecret, error) {
+	if m.createFn != nil {
+		return m.createFn(ctx, req)
+	}
+	return &models.APIKeySecret{}, nil
+}
+
+func (m *mockAPIKeyService) List(ctx context.Context) ([]models.APIKey, error) {
+	return []models.APIKey{}, nil
+}
+
+func (m *mockAPIKeyService) Revoke(ctx context.Context, id uuid.UUID) error {
+	if m.revokeFn != nil {
+		return m.revokeFn(ctx, id)
+	}
+	return nil
+}
+
+func (m *mockAPIKeyService) Rotate(ctx context.Context, id uuid.UUID) (*models.APIKeySecret, error) {
+	return &models.APIKeySecret{}, nil
+}
+
+func (m *mockAPIKeyService) Authenticate(ctx context.Context, key string) (*reqctx.Identity, error) {
+	if m.authenticateFn != nil {
+		return m.authenticateFn(ctx, key)
+	}
+	return nil, service.ErrInvalidAPIKey
+}
+
+func TestAuthMiddleware_APIKeyScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keyID := uuid.New()
+	keys := &mockAPIKeyService{
+		authenticateFn: func(ctx context.Context, key string) (*reqctx.Identity, error) {
+			if key != "sk_reader" {
+				return nil, service.ErrInvalidAPIKey
+			}
+			return &reqctx.Identity{Subject: "api-key:" + keyID.String(), Name: "reader", APIKey: true, Scopes: []string{models.ScopeSubscriptionsRead}}, nil
+		},
+	}
+	var actor string
+	router := gin.New()
+	// API-ключи проверяются и при выключенной проверке токенов
+	router.Use(AuthMiddleware(nil, keys))
+	router.GET("/read", RequireScope(models.ScopeSubscriptionsRead), func(c *gin.Context) {
+		actor = reqctx.Actor(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+	router.POST("/write", RequireScope(models.ScopeSubscriptionsWrite), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		want   int
+	}{
+		{name: "scope granted", method: http.MethodGet, path: "/read", key: "sk_reader", want: http.StatusOK},
+		{name: "scope missing", method: http.MethodPost, path: "/write", key: "sk_reader", want: http.StatusForbidden},
+		{name: "unknown key", method: http.MethodGet, path: "/read", key: "sk_other", want: http.StatusUnauthorized},
+		{name: "anonymous with auth disabled", method: http.MethodPost, path: "/write", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+	assert.Equal(t, "api-key:"+keyID.String()+" (reader)", actor)
+}
+
+func TestHandler_CreateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockAPIKeyService{
+		createFn: func(ctx context.Context, req *models.CreateAPIKeyReq) (*models.APIKeySecret, error) {
+			if req.Scopes[0] == "admin" {
+				return nil, service.ErrInvalidAPIKeyRequest
+			}
+			return &models.APIKeySecret{APIKey: models.APIKey{ID: uuid.New(), Name: req.Name, Scopes: req.Scopes}, Key: "sk_secret"}, nil
+		},
+	}
+	h := NewHandler(&service.Service{APIKey: mock}, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/api-keys", h.CreateAPIKey)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/api-keys", strings.NewReader(`{"name":"batch","scopes":["cost:read"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp models.APIKeySecret
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "sk_secret", resp.Key)
+	assert.NotContains(t, rec.Body.String(), "key_hash")
+
+	for _, body := range []string{`{"name":"batch","scopes":["admin"]}`, `{"name":"batch","scopes":[]}`, `{"scopes":["cost:read"]}`} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/api-keys", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
+func TestHandler_RevokeAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "revoked", err: nil, want: http.StatusNoContent},
+		{name: "not found", err: repository.ErrAPIKeyNotFound, want: http.StatusNotFound},
+		{name: "not admin", err: policy.ErrForbidden, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockAPIKeyService{revokeFn: func(ctx context.Context, id uuid.UUID) error { return tt.err }}
+			h := NewHandler(&service.Service{APIKey: mock}, nil, nil)
+			router := gin.New()
+			router.DELETE("/api/v1/api-keys/:id", h.RevokeAPIKey)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/api-keys/"+uuid.New().String(), nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetSubscriptionHistory возвращает историю изменений подписки
+// @Summary История изменений подписки
+// @Description Записи журнала изменений подписки, новые первыми. Доступна и для удаленных подписок
+// @Tags audit
+// @Produce json
+// @Param id path string true "ID подписки (UUID)"
+// @Param limit query int false "Лимит записей" default(50)
+// @Param offset query int false "Смещение" default(0)
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscriptions/{id}/history [get]
+func (h *Handler) GetSubscriptionHistory(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	limit, offset := 50, 0
+	parsePagination(c, &limit, &offset)
+
+	entries, err := h.services.Audit.GetHistory(c.Request.Context(), id, limit, offset)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// GetAuditLog возвращает журнал изменений подписок
+// @Summary Журнал изменений
+// @Description Все изменения подписок с фильтрацией, новые первыми
+// @Tags audit
+// @Produce json
+// @Param subscription_id query string false "ID подписки (UUID)"
+// @Param actor query string false "Автор изменения"
+// @Param action query string false "Действие" Enums(create, update, delete, restore, purge)
+// @Param from query string false "Начиная с даты (YYYY-MM-DD)"
+// @Param to query string false "По дату включительно (YYYY-MM-DD)"
+// @Param limit query int false "Лимит записей" default(50)
+// @Param offset query int false "Смещение" default(0)
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /audit [get]
+func (h *Handler) GetAuditLog(c *gin.Context) {
+	filter := &models.AuditFilter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Limit:  50,
+	}
+
+	if subID := c.Query("subscription_id"); subID != "" {
+		id, err := uuid.Parse(subID)
+		if err != nil {
+			invalidParam(c, "subscription_id", "must be a UUID")
+			return
+		}
+		filter.SubscriptionID = &id
+	}
+
+	switch filter.Action {
+	case "", models.AuditCreate, models.AuditUpdate, models.AuditDelete, models.AuditRestore, models.AuditPurge:
+	default:
+		invalidParam(c, "action", "must be one of: create, update, delete, restore, purge")
+		return
+	}
+
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			invalidDate(c, "from", "YYYY-MM-DD")
+			return
+		}
+		filter.From = &date
+	}
+
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			invalidDate(c, "to", "YYYY-MM-DD")
+			return
+		}
+		// Граница включительно: до начала следующего дня
+		next := date.AddDate(0, 0, 1)
+		filter.To = &next
+	}
+
+	parsePagination(c, &filter.Limit, &filter.Offset)
+
+	entries, err := h.services.Audit.List(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
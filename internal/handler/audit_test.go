@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/reqctx"
+	"em_tz_anvar/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockAuditService реализует service.AuditService для тестов
+type mockAuditService struct {
+	listFn       func(ctx context.Context, filter *models.AuditFilter) ([]models.AuditEntry, error)
+	getHistoryFn func(ctx context.Context, id uuid.UUID, limit, offset int) ([]models.AuditEntry, error)
+}
+
+func (m *mockAuditService) List(ctx context.Context, filter *models.AuditFilter) ([]models.AuditEntry, error) {
+	if m.listFn != nil {
+		return m.listFn(ctx, filter)
+	}
+	return []models.AuditEntry{}, nil
+}
+
+func (m *mockAuditService) GetHistory(ctx context.Context, id uuid.UUID, limit, offset int) ([]models.AuditEntry, error) {
+	if m.getHistoryFn != nil {
+		return m.getHistoryFn(ctx, id, limit, offset)
+	}
+	return []models.AuditEntry{}, nil
+}
+
+func TestHandler_GetSubscriptionHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	mock := &mockAuditService{
+		getHistoryFn: func(ctx context.Context, subID uuid.UUID, limit, offset int) ([]models.AuditEntry, error) {
+			assert.Equal(t, id, subID)
+			assert.Equal(t, 10, limit)
+			return []models.AuditEntry{
+				{ID: 1, SubscriptionID: subID, Action: models.AuditCreate, Actor: "alice", Before: json.RawMessage(`null`), After: json.RawMessage(`{"price":100}`)},
+			}, nil
+		},
+	}
+	h := NewHandler(&service.Service{Audit: mock}, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/:id/history", h.GetSubscriptionHistory)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/"+id.String()+"/history?limit=10", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entries []models.AuditEntry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.JSONEq(t, `{"price":100}`, string(entries[0].After))
+}
+
+func TestHandler_GetAuditLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var captured *models.AuditFilter
+	mock := &mockAuditService{
+		listFn: func(ctx context.Context, filter *models.AuditFilter) ([]models.AuditEntry, error) {
+			captured = filter
+			return []models.AuditEntry{}, nil
+		},
+	}
+	h := NewHandler(&service.Service{Audit: mock}, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/audit", h.GetAuditLog)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/audit?actor=alice&action=delete&from=2025-01-01&to=2025-01-31", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, captured)
+	assert.Equal(t, "alice", captured.Actor)
+	assert.Equal(t, models.AuditDelete, captured.Action)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), *captured.From)
+	// to включительно — граница сдвигается на начало следующего дня
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), *captured.To)
+	assert.Equal(t, 50, captured.Limit)
+}
+
+func TestHandler_GetAuditLog_InvalidParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(&service.Service{Audit: &mockAuditService{}}, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/audit", h.GetAuditLog)
+
+	for _, query := range []string{"action=drop", "subscription_id=abc", "from=01-2025", "to=2025/01/31"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/audit?"+query, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var requestID, actor string
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/", func(c *gin.Context) {
+		requestID = reqctx.RequestID(c.Request.Context())
+		actor = reqctx.Actor(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	req.Header.Set("X-Actor", "alice")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, "req-42", requestID)
+	assert.Equal(t, "alice", actor)
+	assert.Equal(t, "req-42", rec.Header().Get("X-Request-ID"))
+
+	// Без заголовков: новый UUID и системный автор
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	_, err := uuid.Parse(requestID)
+	assert.NoError(t, err)
+	assert.Equal(t, requestID, rec.Header().Get("X-Request-ID"))
+	assert.Equal(t, reqctx.SystemActor, actor)
+
+	// Длинный автор обрезается по символам под размер колонки журнала
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Actor", strings.Repeat("я", 300))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, strings.Repeat("я", reqctx.MaxActorLen), actor)
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"net/http"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateService добавляет сервис в каталог
+// @Summary Создание сервиса каталога
+// @Description Каноническое название и псевдонимы сравниваются без учета регистра и лишних пробелов,
+// @Description одно название может принадлежать только одному сервису (иначе 409).
+// @Description Подписки с любым из названий ссылаются на сервис и получают его каноническое название
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param input body models.ServiceReq true "Сервис"
+// @Success 201 {object} models.Service
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /services [post]
+func (h *Handler) CreateService(c *gin.Context) {
+	var req models.ServiceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidBody(c, err)
+		return
+	}
+
+	service, err := h.services.Catalog.Create(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, service)
+}
+
+// GetServices возвращает каталог сервисов
+// @Summary Каталог сервисов
+// @Description Сервисы по алфавиту. q ищет подстроку в названии и псевдонимах без учета регистра
+// @Tags services
+// @Produce json
+// @Param q query string false "Поиск по названию и псевдонимам"
+// @Param category query string false "Категория"
+// @Success 200 {array} models.Service
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /services [get]
+func (h *Handler) GetServices(c *gin.Context) {
+	filter := &models.ServiceFilter{
+		Search:   c.Query("q"),
+		Category: c.Query("category"),
+	}
+
+	services, err := h.services.Catalog.GetAll(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services)
+}
+
+// GetService возвращает сервис каталога
+// @Summary Сервис каталога
+// @Tags services
+// @Produce json
+// @Param id path string true "ID сервиса (UUID)"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /services/{id} [get]
+func (h *Handler) GetService(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	service, err := h.services.Catalog.GetByID(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, service)
+}
+
+// UpdateService заменяет сервис каталога
+// @Summary Замена сервиса каталога
+// @Description Полная замена, в том числе списка псевдонимов. Новое каноническое название переходит в service_name подписок сервиса
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param id path string true "ID сервиса (UUID)"
+// @Param input body models.ServiceReq true "Сервис целиком"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /services/{id} [put]
+func (h *Handler) UpdateService(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	var req models.ServiceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidBody(c, err)
+		return
+	}
+
+	service, err := h.services.Catalog.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, service)
+}
+
+// DeleteService удаляет сервис из каталога
+// @Summary Удаление сервиса каталога
+// @Description Сервис, на который ссылаются подписки (в том числе из корзины), удаляется только с merge_into:
+// @Description его подписки и все названия переходят к сервису merge_into. Так объединяются дубли вроде "Yandex Plus" и "Яндекс Плюс"
+// @Tags services
+// @Param id path string true "ID сервиса (UUID)"
+// @Param merge_into query string false "ID сервиса (UUID), с которым слить удаляемый"
+// @Success 204 "No Content"
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /services/{id} [delete]
+func (h *Handler) DeleteService(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	mergeInto, ok := parseQueryUUID(c, "merge_into")
+	if !ok {
+		return
+	}
+
+	if err := h.services.Catalog.Delete(c.Request.Context(), id, mergeInto); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCatalogService реализует service.CatalogService для тестов
+type mockCatalogService struct {
+	createFn func(ctx context.Context, req *models.ServiceReq) (*models.Service, error)
+	getAllFn func(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error)
+	deleteFn func(ctx context.Context, id uuid.UUID, mergeInto *uuid.UUID) error
+}
+
+func (m *mockCatalogService) Create(ctx context.Context, req *models.ServiceReq) (*models.Service, error) {
+	if m.createFn != nil {
+		return m.createFn(ctx, req)
+	}
+	return &models.Service{}, nil
+}
+
+func (m *mockCatalogService) GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	return nil, repository.ErrServiceNotFound
+}
+
+func (m *mockCatalogService) GetAll(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error) {
+	if m.getAllFn != nil {
+		return m.getAllFn(ctx, filter)
+	}
+	return []models.Service{}, nil
+}
+
+func (m *mockCatalogService) Update(ctx context.Context, id uuid.UUID, req *models.ServiceReq) (*models.Service, error) {
+	return &models.Service{ID: id, Name: req.Name}, nil
+}
+
+func (m *mockCatalogService) Delete(ctx context.Context, id uuid.UUID, mergeInto *uuid.UUID) error {
+	if m.deleteFn != nil {
+		return m.deleteFn(ctx, id, mergeInto)
+	}
+	return nil
+}
+
+func catalogRouter(mock *mockCatalogService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(&service.Service{Catalog: mock}, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/services", h.GetServices)
+	router.POST("/api/v1/services", h.CreateService)
+	router.GET("/api/v1/services/:id", h.GetService)
+	router.DELETE("/api/v1/services/:id", h.DeleteService)
+	return router
+}
+
+func TestHandler_CreateService(t *testing.T) {
+	router := catalogRouter(&mockCatalogService{
+		createFn: func(ctx context.Context, req *models.ServiceReq) (*models.Service, error) {
+			return &models.Service{ID: uuid.New(), Name: req.Name, Aliases: req.Aliases, Currency: "RUB"}, nil
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/services", strings.NewReader(`{"name":"Yandex Plus","aliases":["Яндекс Плюс"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var service models.Service
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &service))
+	assert.Equal(t, "Yandex Plus", service.Name)
+	assert.Equal(t, []string{"Яндекс Плюс"}, []string(service.Aliases))
+}
+
+func TestHandler_CreateService_NameTaken(t *testing.T) {
+	router := catalogRouter(&mockCatalogService{
+		createFn: func(ctx context.Context, req *models.ServiceReq) (*models.Service, error) {
+			return nil, fmt.Errorf("%w: %q", repository.ErrServiceNameTaken, "Okko")
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/services", strings.NewReader(`{"name":"Okko"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "conflict", decodeProblem(t, rec).Code)
+}
+
+func TestHandler_GetServices(t *testing.T) {
+	var got *models.ServiceFilter
+	router := catalogRouter(&mockCatalogService{
+		getAllFn: func(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error) {
+			got = filter
+			return []models.Service{{Name: "Okko"}}, nil
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/services?q=plus&category=music", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &models.ServiceFilter{Search: "plus", Category: "music"}, got)
+}
+
+func TestHandler_GetService_NotFound(t *testing.T) {
+	router := catalogRouter(&mockCatalogService{})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/services/"+uuid.New().String(), nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "not_found", decodeProblem(t, rec).Code)
+}
+
+func TestHandler_DeleteService(t *testing.T) {
+	id, target := uuid.New(), uuid.New()
+	var merged *uuid.UUID
+	router := catalogRouter(&mockCatalogService{
+		deleteFn: func(ctx context.Context, gotID uuid.UUID, mergeInto *uuid.UUID) error {
+			if mergeInto == nil {
+				return repository.ErrServiceInUse
+			}
+			merged = mergeInto
+			return nil
+		},
+	})
+
+	// Сервис с подписками без merge_into не удаляется
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/services/"+id.String(), nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/services/"+id.String()+"?merge_into="+target.String(), nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, &target, merged)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/services/"+id.String()+"?merge_into=nope", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "merge_into", decodeProblem(t, rec).Errors[0].Field)
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize ограничение на размер CSV с курсами
+const maxImportSize = 10 << 20
+
+// CreateExchangeRates сохраняет курсы валют
+// @Summary Загрузка курсов валют
+// @Description Сохраняет курсы валют (1 base_currency = rate quote_currency на дату), курс на ту же дату перезаписывается
+// @Tags exchange-rates
+// @Accept json
+// @Produce json
+// @Param input body []models.CreateExchangeRateReq true "Курсы"
+// @Success 201 {object} models.SaveExchangeRatesResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /exchange-rates [post]
+func (h *Handler) CreateExchangeRates(c *gin.Context) {
+	var req []models.CreateExchangeRateReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidBody(c, err)
+		return
+	}
+
+	saved, err := h.services.ExchangeRate.Save(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.SaveExchangeRatesResponse{Saved: saved})
+}
+
+// ImportExchangeRates импортирует курсы валют из CSV
+// @Summary Импорт курсов валют из CSV
+// @Description Принимает CSV с колонками base_currency,quote_currency,date,rate (дата YYYY-MM-DD), строка заголовка необязательна
+// @Tags exchange-rates
+// @Accept text/csv
+// @Produce json
+// @Success 201 {object} models.SaveExchangeRatesResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /exchange-rates/import [post]
+func (h *Handler) ImportExchangeRates(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	saved, err := h.services.ExchangeRate.Import(c.Request.Context(), body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.SaveExchangeRatesResponse{Saved: saved})
+}
+
+// GetExchangeRates возвращает курсы валют
+// @Summary Список курсов валют
+// @Description Возвращает сохраненные курсы, новые даты первыми
+// @Tags exchange-rates
+// @Produce json
+// @Param base_currency query string false "Базовая валюта (ISO 4217)"
+// @Param quote_currency query string false "Котируемая валюта (ISO 4217)"
+// @Param from query string false "Начиная с даты (YYYY-MM-DD)"
+// @Param to query string false "По дату (YYYY-MM-DD)"
+// @Success 200 {array} models.ExchangeRate
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /exchange-rates [get]
+func (h *Handler) GetExchangeRates(c *gin.Context) {
+	filter := &models.ExchangeRateFilter{
+		BaseCurrency:  c.Query("base_currency"),
+		QuoteCurrency: c.Query("quote_currency"),
+	}
+
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			invalidDate(c, "from", "YYYY-MM-DD")
+			return
+		}
+		filter.From = &date
+	}
+
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			invalidDate(c, "to", "YYYY-MM-DD")
+			return
+		}
+		filter.To = &date
+	}
+
+	rates, err := h.services.ExchangeRate.GetAll(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
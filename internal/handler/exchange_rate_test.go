@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockExchangeRateService реализует service.ExchangeRateService для тестов
+type mockExchangeRateService struct {
+	saveFn   func(ctx context.Context, reqs []models.CreateExchangeRateReq) (int, error)
+	importFn func(ctx context.Context, r io.Reader) (int, error)
+	getAllFn func(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error)
+}
+
+func (m *mockExchangeRateService) Save(ctx context.Context, reqs []models.CreateExchangeRateReq) (int, error) {
+	if m.saveFn != nil {
+		return m.saveFn(ctx, reqs)
+	}
+	return 0, nil
+}
+
+func (m *mockExchangeRateService) Import(ctx context.Context, r io.Reader) (int, error) {
+	if m.importFn != nil {
+		return m.importFn(ctx, r)
+	}
+	return 0, nil
+}
+
+func (m *mockExchangeRateService) GetAll(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error) {
+	if m.getAllFn != nil {
+		return m.getAllFn(ctx, filter)
+	}
+	return nil, nil
+}
+
+func handlerWithRatesMock(mock *mockExchangeRateService) *Handler {
+	return NewHandler(&service.Service{ExchangeRate: mock}, nil, nil)
+}
+
+func TestHandler_CreateExchangeRates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockExchangeRateService{
+		saveFn: func(ctx context.Context, reqs []models.CreateExchangeRateReq) (int, error) {
+			return len(reqs), nil
+		},
+	}
+	h := handlerWithRatesMock(mock)
+	router := gin.New()
+	router.POST("/api/v1/exchange-rates", h.CreateExchangeRates)
+
+	body := `[{"base_currency":"USD","quote_currency":"RUB","date":"2025-01-31","rate":92.5}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/exchange-rates", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var resp models.SaveExchangeRatesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Saved)
+}
+
+func TestHandler_CreateExchangeRates_InvalidRate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithRatesMock(&mockExchangeRateService{})
+	router := gin.New()
+	router.POST("/api/v1/exchange-rates", h.CreateExchangeRates)
+
+	body := `[{"base_currency":"USD","quote_currency":"RUB","date":"2025-01-31","rate":-1}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/exchange-rates", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_ImportExchangeRates_InvalidFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockExchangeRateService{
+		importFn: func(ctx context.Context, r io.Reader) (int, error) {
+			return 0, fmt.Errorf("%w: line 1: invalid date", service.ErrInvalidExchangeRate)
+		},
+	}
+	h := handlerWithRatesMock(mock)
+	router := gin.New()
+	router.POST("/api/v1/exchange-rates/import", h.ImportExchangeRates)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/exchange-rates/import", strings.NewReader("USD,RUB,bad,1"))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_GetExchangeRates_InvalidDate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithRatesMock(&mockExchangeRateService{})
+	router := gin.New()
+	router.GET("/api/v1/exchange-rates", h.GetExchangeRates)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/exchange-rates?from=01-2025", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"em_tz_anvar/internal/auth"
+	"em_tz_anvar/internal/config"
+	"em_tz_anvar/internal/models"
 	"em_tz_anvar/internal/service"
 
 	_ "em_tz_anvar/docs"
@@ -12,33 +15,99 @@ import (
 
 type Handler struct {
 	services *service.Service
+	verifier *auth.Verifier
+	limits   *config.RateLimitConfig
+	limiters map[string]*RateLimiter
 }
 
-// NewHandler
-func NewHandler(services *service.Service) *Handler {
-	return &Handler{services: services}
+// NewHandler verifier == nil — аутентификация выключена, API открыт; limits == nil — без ограничения частоты
+func NewHandler(services *service.Service, verifier *auth.Verifier, limits *config.RateLimitConfig) *Handler {
+	return &Handler{services: services, verifier: verifier, limits: limits, limiters: make(map[string]*RateLimiter)}
+}
+
+// rateLimit лимитер группы маршрутов: у каждой группы свои корзины, маршруты одной группы делят их
+func (h *Handler) rateLimit(group string) gin.HandlerFunc {
+	limiter, ok := h.limiters[group]
+	if !ok {
+		if h.limits != nil && h.limits.Enabled {
+			limiter = NewRateLimiter(h.limits.For(group))
+		}
+		h.limiters[group] = limiter
+	}
+	return limiter.Middleware()
 }
 
 // InitRoutes
 func (h *Handler) InitRoutes() *gin.Engine {
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.Use(RequestIDMiddleware())
 	router.Use(LoggerMiddleware())
 
 	//Swagger UI
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	api := router.Group("/api/v1")
+	// Лимит по IP до аутентификации: перебор токенов и ключей не доходит до базы
+	api.Use(h.rateLimit("ip"), AuthMiddleware(h.verifier, h.services.APIKey))
 	{
-		subscriptions := api.Group("/subscriptions")
+		// Скоупы ограничивают только API-ключи, см. RequireScope
+		read := RequireScope(models.ScopeSubscriptionsRead)
+		write := RequireScope(models.ScopeSubscriptionsWrite)
+		cost := RequireScope(models.ScopeCostRead)
+		audit := RequireScope(models.ScopeAuditRead)
+
+		subscriptions := api.Group("/subscriptions", h.rateLimit("subscriptions"))
 		{
-			subscriptions.POST("", h.CreateSubscription)
-			subscriptions.GET("", h.GetAllSubscriptions)
+			subscriptions.POST("", write, IdempotencyMiddleware(h.services.Idempotency), h.CreateSubscription)
+			subscriptions.GET("", read, h.GetAllSubscriptions)
 			// Эндпоинт для подсчета стоимости (должен быть перед /:id)
-			subscriptions.GET("/cost", h.GetTotalCost)
-			subscriptions.GET("/:id", h.GetSubscription)
-			subscriptions.PUT("/:id", h.UpdateSubscription)
-			subscriptions.DELETE("/:id", h.DeleteSubscription)
+			subscriptions.GET("/cost", cost, h.GetTotalCost)
+			subscriptions.GET("/cost/breakdown", cost, h.GetCostBreakdown)
+			subscriptions.GET("/:id", read, h.GetSubscription)
+			subscriptions.PUT("/:id", write, h.UpdateSubscription)
+			subscriptions.PATCH("/:id", write, h.PatchSubscription)
+			subscriptions.DELETE("/:id", write, h.DeleteSubscription)
+			subscriptions.GET("/:id/charges", read, h.GetSubscriptionCharges)
+			subscriptions.POST("/:id/restore", write, h.RestoreSubscription)
+			subscriptions.DELETE("/:id/purge", write, h.PurgeSubscription)
+			subscriptions.GET("/:id/history", audit, h.GetSubscriptionHistory)
+		}
+
+		// Отчеты по подпискам пользователя, лимит общий с /subscriptions
+		users := api.Group("/users", h.rateLimit("subscriptions"))
+		{
+			users.GET("/:id/subscriptions", read, h.GetUserSubscriptions)
+			users.GET("/:id/summary", read, cost, h.GetUserSummary)
+			users.GET("/:id/overlaps", read, h.GetUserOverlaps)
+		}
+
+		// Каталог читают с тем же скоупом, что и подписки
+		services := api.Group("/services", h.rateLimit("services"))
+		{
+			services.GET("", read, h.GetServices)
+			services.POST("", RequireScope(models.ScopeServicesWrite), h.CreateService)
+			services.GET("/:id", read, h.GetService)
+			services.PUT("/:id", RequireScope(models.ScopeServicesWrite), h.UpdateService)
+			services.DELETE("/:id", RequireScope(models.ScopeServicesWrite), h.DeleteService)
+		}
+
+		api.GET("/audit", h.rateLimit("audit"), audit, h.GetAuditLog)
+
+		rates := api.Group("/exchange-rates", h.rateLimit("exchange_rates"))
+		{
+			rates.GET("", RequireScope(models.ScopeRatesRead), h.GetExchangeRates)
+			rates.POST("", RequireScope(models.ScopeRatesWrite), h.CreateExchangeRates)
+			rates.POST("/import", RequireScope(models.ScopeRatesWrite), h.ImportExchangeRates)
+		}
+
+		// Управление ключами — только админу с токеном, проверяется политикой доступа
+		keys := api.Group("/api-keys", h.rateLimit("api_keys"))
+		{
+			keys.GET("", h.GetAPIKeys)
+			keys.POST("", h.CreateAPIKey)
+			keys.DELETE("/:id", h.RevokeAPIKey)
+			keys.POST("/:id/rotate", h.RotateAPIKey)
 		}
 	}
 
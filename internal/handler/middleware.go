@@ -1,12 +1,348 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"em_tz_anvar/internal/auth"
+	"em_tz_anvar/internal/config"
+	"em_tz_anvar/internal/reqctx"
+	"em_tz_anvar/internal/service"
+
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	requestIDHeader = "X-Request-ID"
+	actorHeader     = "X-Actor"
+	apiKeyHeader    = "X-API-Key"
+	// idempotencyHeader ключ, по которому повтор запроса получает первый ответ
+	idempotencyHeader    = "Idempotency-Key"
+	replayedHeader       = "Idempotent-Replayed"
+	maxIdempotencyKeyLen = 255
+	// maxRequestIDLen длиннее клиентский X-Request-ID не принимаем и генерируем свой
+	maxRequestIDLen = 128
+)
+
+// RequestIDMiddleware кладет в контекст запроса идентификатор (X-Request-ID клиента или новый UUID)
+// и автора изменений из X-Actor; идентификатор возвращается в ответе
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLen {
+			requestID = uuid.NewString()
+		}
+		c.Header(requestIDHeader, requestID)
+
+		ctx := reqctx.WithRequestID(c.Request.Context(), requestID)
+		if actor := c.GetHeader(actorHeader); actor != "" {
+			ctx = reqctx.WithActor(ctx, actor)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// identityKey ключ личности вызывающего в gin.Context
+const identityKey = "identity"
+
+// AuthMiddleware определяет вызывающего по API-ключу (X-API-Key) или bearer-токену и кладет его личность
+// в gin.Context и контекст запроса. Автором изменений становится личность, X-Actor игнорируется.
+// verifier == nil — токены не проверяются и запрос без ключа проходит анонимно, как раньше
+func AuthMiddleware(verifier *auth.Verifier, keys service.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var identity *reqctx.Identity
+
+		if key := c.GetHeader(apiKeyHeader); key != "" {
+			id, err := keys.Authenticate(c.Request.Context(), key)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidAPIKey) {
+					log.Warn().Err(err).Msg("Rejected api key")
+					respondProblem(c, http.StatusUnauthorized, codeUnauthorized, "invalid api key")
+					return
+				}
+				respondError(c, err)
+				return
+			}
+			identity = id
+		} else if verifier != nil {
+			token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				c.Header("WWW-Authenticate", `Bearer`)
+				respondProblem(c, http.StatusUnauthorized, codeUnauthorized, "missing bearer token or api key")
+				return
+			}
+
+			id, err := verifier.Verify(token)
+			if err != nil {
+				log.Warn().Err(err).Msg("Rejected bearer token")
+				msg := "invalid token"
+				if errors.Is(err, auth.ErrTokenExpired) {
+					msg = "token expired"
+				}
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				respondProblem(c, http.StatusUnauthorized, codeUnauthorized, msg)
+				return
+			}
+			identity = id
+		} else {
+			c.Next()
+			return
+		}
+
+		c.Set(identityKey, identity)
+		ctx := reqctx.WithIdentity(c.Request.Context(), identity)
+		ctx = reqctx.WithActor(ctx, identity.Actor())
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// RequireScope пропускает API-ключ только со скоупом scope; пользователей с токеном и анонимные
+// запросы (auth выключен) не ограничивает
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if identity, ok := reqctx.IdentityFrom(c.Request.Context()); ok && !identity.HasScope(scope) {
+			respondProblem(c, http.StatusForbidden, codeForbidden, "api key lacks scope "+scope)
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitSweepInterval как часто выбрасывать корзины клиентов, которые успели наполниться
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter token bucket на каждого клиента. Клиент — API-ключ, которым прошел запрос, иначе IP
+type RateLimiter struct {
+	rate  float64 // токенов в секунду
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter nil — лимит не задан (RequestsPerSecond <= 0). Burst по умолчанию — одна секунда запросов
+func NewRateLimiter(limit config.RateLimit) *RateLimiter {
+	if limit.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(limit.RequestsPerSecond))
+	}
+	return &RateLimiter{
+		rate:    limit.RequestsPerSecond,
+		burst:   burst,
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// take списывает токен клиента key. Возвращает остаток и, если токена нет, через сколько он появится
+func (l *RateLimiter) take(key string) (remaining float64, retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return b.tokens, l.duration(1 - b.tokens), false
+	}
+	b.tokens--
+	return b.tokens, 0, true
+}
+
+// sweep корзина, которая наполнилась до краев, ничем не отличается от новой
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	refill := l.duration(l.burst)
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// duration время на пополнение tokens токенов
+func (l *RateLimiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// Middleware отвечает 429 с Retry-After, когда клиент исчерпал лимит; в каждом ответе —
+// X-RateLimit-Limit (емкость), X-RateLimit-Remaining и X-RateLimit-Reset (секунд до полной корзины).
+// После AuthMiddleware ключом становится проверенный API-ключ, а не произвольный заголовок; до нее — только IP
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	if l == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if identity, ok := reqctx.IdentityFrom(c.Request.Context()); ok && identity.APIKey {
+			key = identity.Subject
+		}
+
+		remaining, retryAfter, ok := l.take(key)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(int(l.burst)))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(l.duration(l.burst-remaining))))
+
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			log.Warn().Str("client", key).Str("path", c.FullPath()).Msg("Rate limit exceeded")
+			respondProblem(c, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// IdempotencyMiddleware повтор запроса с тем же Idempotency-Key и телом получает сохраненный ответ
+// (с заголовком Idempotent-Replayed) без повторного выполнения. Тот же ключ с другим телом — 422,
+// пока первый запрос не завершился — 409. Ответы 5xx не сохраняются: такой запрос можно повторить
+func IdempotencyMiddleware(keys service.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			invalidParam(c, idempotencyHeader, "must be at most "+strconv.Itoa(maxIdempotencyKeyLen)+" characters long")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondProblem(c, http.StatusBadRequest, codeInvalidRequest, "failed to read request body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		saved, err := keys.Begin(ctx, key, requestHash(c.Request.Method, c.Request.URL.Path, body))
+		switch {
+		case err != nil:
+			// ErrIdempotencyKeyReused — 422, ErrIdempotencyInProgress — 409
+			respondError(c, err)
+			return
+		case saved != nil:
+			c.Header(replayedHeader, "true")
+			contentType := "application/json; charset=utf-8"
+			if *saved.StatusCode >= http.StatusBadRequest {
+				contentType = problemContentType
+			}
+			c.Data(*saved.StatusCode, contentType, saved.Response)
+			c.Abort()
+			return
+		}
+
+		release := func() {
+			store, cancel := detachedContext(ctx)
+			defer cancel()
+			if err := keys.Release(store, key); err != nil {
+				log.Warn().Err(err).Str("idempotency_key", key).Msg("Failed to release idempotency key")
+			}
+		}
+
+		// gin.Recovery стоит снаружи: без освобождения ключ после паники оставался бы "в работе" до истечения
+		defer func() {
+			if p := recover(); p != nil {
+				release()
+				panic(p)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			release()
+			return
+		}
+
+		store, cancel := detachedContext(ctx)
+		defer cancel()
+		if err := keys.Complete(store, key, status, recorder.body.Bytes()); err != nil {
+			log.Warn().Err(err).Str("idempotency_key", key).Msg("Failed to save idempotent response")
+		}
+	}
+}
+
+// idempotencyStoreTimeout сколько ждать записи ответа или освобождения ключа
+const idempotencyStoreTimeout = 5 * time.Second
+
+// detachedContext контекст для записи ключа идемпотентности, который не отменяется вместе с запросом:
+// клиент, отвалившийся по таймауту, повторит запрос и должен получить сохраненный ответ, а не 409
+func detachedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), idempotencyStoreTimeout)
+}
+
+// requestHash отпечаток запроса для сравнения повторов
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder копирует тело ответа, чтобы его можно было сохранить
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
 // LoggerMiddleware
 func LoggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -34,6 +370,7 @@ func LoggerMiddleware() gin.HandlerFunc {
 			Dur("latency", latency).
 			Str("client_ip", c.ClientIP()).
 			Str("user_agent", c.Request.UserAgent()).
+			Str("request_id", reqctx.RequestID(c.Request.Context())).
 			Msg("HTTP request")
 	}
 }
@@ -0,0 +1,378 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/auth"
+	"em_tz_anvar/internal/config"
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/reqctx"
+	"em_tz_anvar/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "test-secret"
+
+// hs256Token подписывает claims секретом testSecret
+func hs256Token(t *testing.T, claims map[string]interface{}) string {
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	input := segment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + segment(claims)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier, err := auth.NewVerifier(&config.AuthConfig{HS256Secret: testSecret, AdminRole: "admin"})
+	require.NoError(t, err)
+
+	var identity *reqctx.Identity
+	var actor string
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), AuthMiddleware(verifier, nil))
+	router.GET("/", func(c *gin.Context) {
+		identity, _ = reqctx.IdentityFrom(c.Request.Context())
+		actor = reqctx.Actor(c.Request.Context())
+		_, ok := c.Get(identityKey)
+		assert.True(t, ok)
+		c.Status(http.StatusOK)
+	})
+	userID := uuid.New()
+
+	t.Run("valid token", func(t *testing.T) {
+		token := hs256Token(t, map[string]interface{}{"sub": userID.String(), "exp": time.Now().Add(time.Hour).Unix()})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		// X-Actor не может подменить автора при включенной аутентификации
+		req.Header.Set("X-Actor", "mallory")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, identity)
+		assert.Equal(t, userID, identity.UserID)
+		assert.Equal(t, userID.String(), actor)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		token := hs256Token(t, map[string]interface{}{"sub": userID.String(), "exp": time.Now().Add(-time.Hour).Unix()})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), "token expired")
+	})
+}
+
+func TestRateLimiter_Take(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(config.RateLimit{RequestsPerSecond: 2, Burst: 3})
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, _, ok := limiter.take("a")
+		require.True(t, ok, "request %d", i)
+	}
+	_, retryAfter, ok := limiter.take("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// Корзины клиентов независимы
+	_, _, ok = limiter.take("b")
+	assert.True(t, ok)
+
+	// За полсекунды набегает один токен
+	now = now.Add(500 * time.Millisecond)
+	remaining, _, ok := limiter.take("a")
+	assert.True(t, ok)
+	assert.InDelta(t, 0, remaining, 1e-9)
+
+	// Наполнившиеся корзины выбрасываются
+	now = now.Add(rateLimitSweepInterval)
+	limiter.take("c")
+	assert.Len(t, limiter.buckets, 1)
+
+	assert.Nil(t, NewRateLimiter(config.RateLimit{}))
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(config.RateLimit{RequestsPerSecond: 1, Burst: 2})
+
+	var keyIdentity bool
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if keyIdentity {
+			identity := &reqctx.Identity{Subject: "api-key:batch", APIKey: true}
+			c.Request = c.Request.WithContext(reqctx.WithIdentity(c.Request.Context(), identity))
+		}
+		c.Next()
+	}, limiter.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Reset"))
+
+	do()
+	rec = do()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// API-ключ с того же IP считается отдельным клиентом
+	keyIdentity = true
+	rec = do()
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Без лимита middleware ничего не делает
+	var disabled *RateLimiter
+	router = gin.New()
+	router.Use(disabled.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	rec = do()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestInitRoutes_RateLimitBeforeAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var lookups int
+	keys := &mockAPIKeyService{
+		authenticateFn: func(ctx context.Context, key string) (*reqctx.Identity, error) {
+			lookups++
+			return nil, service.ErrInvalidAPIKey
+		},
+	}
+	limits := &config.RateLimitConfig{Enabled: true, Groups: map[string]config.RateLimit{"ip": {RequestsPerSecond: 1, Burst: 2}}}
+	router := NewHandler(&service.Service{APIKey: keys}, nil, limits).InitRoutes()
+	require.NoError(t, router.SetTrustedProxies(nil))
+
+	do := func(forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-API-Key", "sk_guess")
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("").Code)
+	// Перебор ключей упирается в лимит до обращения к базе, подмена X-Forwarded-For не помогает
+	assert.Equal(t, http.StatusTooManyRequests, do("").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do("203.0.113.7").Code)
+	assert.Equal(t, 2, lookups)
+}
+
+func TestInitRoutes_RateLimitSharedByGroup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limits := &config.RateLimitConfig{Enabled: true, Groups: map[string]config.RateLimit{"subscriptions": {RequestsPerSecond: 1, Burst: 1}}}
+	subscriptions := &mockSubscriptionService{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+			return &models.SubscriptionPage{Items: []models.Subscription{}}, nil
+		},
+	}
+	router := NewHandler(&service.Service{Subscription: subscriptions}, nil, limits).InitRoutes()
+
+	do := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("/api/v1/subscriptions"))
+	// /users считается по тем же корзинам, что и /subscriptions
+	assert.Equal(t, http.StatusTooManyRequests, do("/api/v1/users/"+uuid.New().String()+"/subscriptions"))
+}
+
+// mockIdempotencyService хранит ответы в памяти
+type mockIdempotencyService struct {
+	records map[string]*models.IdempotencyRecord
+}
+
+func (m *mockIdempotencyService) Begin(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, error) {
+	rec, ok := m.records[key]
+	if !ok {
+		m.records[key] = &models.IdempotencyRecord{Key: key, RequestHash: requestHash}
+		return nil, nil
+	}
+	if rec.RequestHash != requestHash {
+		return nil, service.ErrIdempotencyKeyReused
+	}
+	if rec.StatusCode == nil {
+		return nil, service.ErrIdempotencyInProgress
+	}
+	return rec, nil
+}
+
+func (m *mockIdempotencyService) Complete(ctx context.Context, key string, status int, response []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.records[key].StatusCode = &status
+	m.records[key].Response = response
+	return nil
+}
+
+func (m *mockIdempotencyService) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	delete(m.records, key)
+	return nil
+}
+
+func (m *mockIdempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := &mockIdempotencyService{records: map[string]*models.IdempotencyRecord{}}
+
+	calls := 0
+	fail := false
+	router := gin.New()
+	router.POST("/subscriptions", IdempotencyMiddleware(keys), func(c *gin.Context) {
+		calls++
+		if fail {
+			respondError(c, errors.New("db is down"))
+			return
+		}
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusCreated, gin.H{"call": calls, "body": string(body)})
+	})
+
+	do := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do("k1", `{"price":100}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+
+	// Повтор получает первый ответ, обработчик не вызывается
+	replay := do("k1", `{"price":100}`)
+	assert.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, "true", replay.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	rec := do("k1", `{"price":200}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	// Без ключа запросы не дедуплицируются
+	do("", `{"price":100}`)
+	do("", `{"price":100}`)
+	assert.Equal(t, 3, calls)
+
+	// Ответ 5xx не сохраняется, повтор выполняется заново
+	fail = true
+	rec = do("k2", `{"price":100}`)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	fail = false
+	rec = do("k2", `{"price":100}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+
+	// Запрос с ключом еще выполняется
+	keys.records["k3"] = &models.IdempotencyRecord{Key: "k3", RequestHash: requestHash(http.MethodPost, "/subscriptions", []byte(`{}`))}
+	rec = do("k3", `{}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = do(strings.Repeat("k", 256), `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestIdempotencyMiddleware_ClientGone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := &mockIdempotencyService{records: map[string]*models.IdempotencyRecord{}}
+
+	var cancel context.CancelFunc
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/subscriptions", IdempotencyMiddleware(keys), func(c *gin.Context) {
+		if c.GetHeader("X-Panic") != "" {
+			panic("boom")
+		}
+		// Клиент отвалился по таймауту, пока подписка создавалась
+		cancel()
+		c.JSON(http.StatusCreated, gin.H{"id": "sub-1"})
+	})
+
+	do := func(key string, panics bool) *httptest.ResponseRecorder {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(`{}`)).WithContext(ctx)
+		req.Header.Set("Idempotency-Key", key)
+		if panics {
+			req.Header.Set("X-Panic", "1")
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Ответ сохраняется, хотя контекст запроса уже отменен: повтор получает 201, а не 409
+	require.Equal(t, http.StatusCreated, do("k1", false).Code)
+	replay := do("k1", false)
+	assert.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get("Idempotent-Replayed"))
+
+	// После паники ключ освобожден
+	assert.Equal(t, http.StatusInternalServerError, do("k2", true).Code)
+	assert.NotContains(t, keys.records, "k2")
+}
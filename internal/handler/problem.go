@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"em_tz_anvar/internal/policy"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/reqctx"
+	"em_tz_anvar/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+)
+
+const problemContentType = "application/problem+json"
+
+// Коды ошибок в поле code. Они стабильны: клиент ветвится по code, а не по тексту detail
+const (
+	codeInvalidRequest       = "invalid_request"
+	codeValidationFailed     = "validation_failed"
+	codeConstraintViolation  = "constraint_violation"
+	codeInvalidDate          = "invalid_date"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codeSubscriptionOverlap  = "subscription_overlap"
+	codePreconditionFailed   = "precondition_failed"
+	codeIdempotencyKeyReused = "idempotency_key_reused"
+	codeRateLimited          = "rate_limited"
+	codeInternal             = "internal_error"
+)
+
+// Problem ответ об ошибке в формате RFC 7807 (application/problem+json)
+type Problem struct {
+	Type      string       `json:"type" example:"about:blank"`
+	Title     string       `json:"title" example:"Bad Request"`
+	Status    int          `json:"status" example:"400"`
+	Detail    string       `json:"detail,omitempty" example:"start_date: invalid date, expected YYYY-MM-DD or MM-YYYY"`
+	Instance  string       `json:"instance,omitempty" example:"/api/v1/subscriptions"`
+	Code      string       `json:"code" example:"invalid_date"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError ошибка в конкретном поле тела или параметре запроса
+type FieldError struct {
+	Field   string `json:"field" example:"start_date"`
+	Message string `json:"message" example:"invalid date, expected YYYY-MM-DD or MM-YYYY"`
+}
+
+// respondProblem отвечает ошибкой в формате problem+json и прерывает цепочку обработчиков
+func respondProblem(c *gin.Context, status int, code, detail string, fields ...FieldError) {
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(status, Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestID: reqctx.RequestID(c.Request.Context()),
+		Errors:    fields,
+	})
+}
+
+// invalidParam отвечает 400 validation_failed на некорректное значение одного поля
+func invalidParam(c *gin.Context, field, message string) {
+	respondProblem(c, http.StatusBadRequest, codeValidationFailed, field+": "+message, FieldError{Field: field, Message: message})
+}
+
+// invalidDate отвечает 400 invalid_date на дату в неверном формате
+func invalidDate(c *gin.Context, field, format string) {
+	message := "invalid date, expected " + format
+	respondProblem(c, http.StatusBadRequest, codeInvalidDate, field+": "+message, FieldError{Field: field, Message: message})
+}
+
+// knownError ответ на ошибку сервиса. detail пустой — клиенту уходит текст ошибки,
+// field — поле запроса, к которому относится ошибка
+type knownError struct {
+	err    error
+	status int
+	code   string
+	detail string
+	field  string
+}
+
+// knownErrors ошибки сервисов, которые клиент может исправить сам. Проверяются по порядку
+var knownErrors = []knownError{
+	{err: policy.ErrForbidden, status: http.StatusForbidden, code: codeForbidden},
+	{err: service.ErrInvalidAPIKey, status: http.StatusUnauthorized, code: codeUnauthorized},
+	{err: repository.ErrNotFound, status: http.StatusNotFound, code: codeNotFound},
+	{err: repository.ErrAPIKeyNotFound, status: http.StatusNotFound, code: codeNotFound},
+	{err: repository.ErrRateNotFound, status: http.StatusNotFound, code: codeNotFound},
+	{err: repository.ErrServiceNotFound, status: http.StatusNotFound, code: codeNotFound},
+	{err: repository.ErrServiceNameTaken, status: http.StatusConflict, code: codeConflict},
+	{err: repository.ErrServiceInUse, status: http.StatusConflict, code: codeConflict, detail: "service is used by subscriptions, delete it with merge_into"},
+	{err: repository.ErrNotDeleted, status: http.StatusConflict, code: codeConflict, detail: "subscription must be deleted before purge"},
+	{err: repository.ErrVersionMismatch, status: http.StatusPreconditionFailed, code: codePreconditionFailed, detail: "subscription was modified, reload it and retry"},
+	{err: service.ErrSubscriptionOverlap, status: http.StatusConflict, code: codeSubscriptionOverlap},
+	{err: service.ErrRuleViolation, status: http.StatusUnprocessableEntity, code: codeConstraintViolation, detail: "subscription violates domain rules"},
+	{err: service.ErrIdempotencyKeyReused, status: http.StatusUnprocessableEntity, code: codeIdempotencyKeyReused},
+	{err: service.ErrIdempotencyInProgress, status: http.StatusConflict, code: codeConflict},
+	{err: service.ErrInvalidDate, status: http.StatusBadRequest, code: codeInvalidDate},
+	{err: service.ErrInvalidUserID, status: http.StatusBadRequest, code: codeValidationFailed},
+	{err: service.ErrInvalidBillingPeriod, status: http.StatusBadRequest, code: codeValidationFailed},
+	{err: service.ErrInvalidPriceChange, status: http.StatusBadRequest, code: codeValidationFailed},
+	{err: service.ErrInvalidCursor, status: http.StatusBadRequest, code: codeValidationFailed, field: "cursor"},
+	{err: repository.ErrInvalidSort, status: http.StatusBadRequest, code: codeValidationFailed, field: "sort"},
+	{err: service.ErrInvalidExchangeRate, status: http.StatusBadRequest, code: codeValidationFailed},
+	{err: service.ErrInvalidAPIKeyRequest, status: http.StatusBadRequest, code: codeValidationFailed},
+	{err: service.ErrInvalidService, status: http.StatusBadRequest, code: codeValidationFailed},
+	{err: service.ErrBeyondChargeHorizon, status: http.StatusBadRequest, code: codeValidationFailed},
+}
+
+// respondError отвечает на ошибку сервиса. Неизвестная ошибка — 500 без подробностей:
+// ее текст может содержать SQL и попадает только в лог
+func respondError(c *gin.Context, err error) {
+	for _, known := range knownErrors {
+		if !errors.Is(err, known.err) {
+			continue
+		}
+
+		detail := known.detail
+		if detail == "" {
+			detail = err.Error()
+		}
+
+		var fields []FieldError
+		var validationErr *service.ValidationError
+		var fieldErr *service.FieldError
+		if errors.As(err, &validationErr) {
+			for _, f := range validationErr.Fields {
+				fields = append(fields, FieldError{Field: f.Field, Message: f.Err.Error()})
+			}
+		} else if errors.As(err, &fieldErr) {
+			fields = append(fields, FieldError{Field: fieldErr.Field, Message: fieldErr.Err.Error()})
+		} else if known.field != "" {
+			fields = append(fields, FieldError{Field: known.field, Message: detail})
+		}
+
+		respondProblem(c, known.status, known.code, detail, fields...)
+		return
+	}
+
+	log.Error().Err(err).Str("method", c.Request.Method).Str("path", c.FullPath()).Msg("Request failed")
+	respondProblem(c, http.StatusInternalServerError, codeInternal, "internal server error")
+}
+
+// invalidBody отвечает 400 на тело, которое не удалось разобрать или не прошло binding
+func invalidBody(c *gin.Context, err error) {
+	log.Warn().Err(err).Msg("Invalid request body")
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{Field: fe.Field(), Message: validationMessage(fe)})
+		}
+		respondProblem(c, http.StatusBadRequest, codeValidationFailed, "request body failed validation", fields...)
+		return
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		message := "must be " + typeErr.Type.String()
+		respondProblem(c, http.StatusBadRequest, codeValidationFailed, typeErr.Field+": "+message,
+			FieldError{Field: typeErr.Field, Message: message})
+		return
+	}
+
+	respondProblem(c, http.StatusBadRequest, codeInvalidRequest, "invalid request body: "+err.Error())
+}
+
+// validationMessage текст нарушенного правила binding
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return "must be at least " + fe.Param() + " characters long"
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return "must be at most " + fe.Param() + " characters long"
+		}
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "uuid":
+		return "must be a UUID"
+	case "iso4217":
+		return "must be a three-letter ISO 4217 code"
+	default:
+		return "failed " + fe.Tag() + " validation"
+	}
+}
+
+// Ошибки binding называют поля так же, как JSON, а не как поля структур
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
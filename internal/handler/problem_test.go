@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/policy"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/reqctx"
+	"em_tz_anvar/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeProblem проверяет, что ответ — problem+json, и разбирает его
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+	var problem Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem), rec.Body.String())
+	assert.Equal(t, rec.Code, problem.Status)
+	assert.Equal(t, http.StatusText(rec.Code), problem.Title)
+	return problem
+}
+
+func TestRespondError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		err    error
+		status int
+		code   string
+		field  string
+	}{
+		{err: fmt.Errorf("%w: role %q may not modify subscriptions", policy.ErrForbidden, "analyst"), status: http.StatusForbidden, code: "forbidden"},
+		{err: repository.ErrNotFound, status: http.StatusNotFound, code: "not_found"},
+		{err: repository.ErrAPIKeyNotFound, status: http.StatusNotFound, code: "not_found"},
+		{err: repository.ErrNotDeleted, status: http.StatusConflict, code: "conflict"},
+		{err: repository.ErrVersionMismatch, status: http.StatusPreconditionFailed, code: "precondition_failed"},
+		{err: service.ErrIdempotencyKeyReused, status: http.StatusUnprocessableEntity, code: "idempotency_key_reused"},
+		{err: service.ErrIdempotencyInProgress, status: http.StatusConflict, code: "conflict"},
+		{err: &service.FieldError{Field: "end_date", Err: service.ErrInvalidDate}, status: http.StatusBadRequest, code: "invalid_date", field: "end_date"},
+		{err: &service.FieldError{Field: "billing_months", Err: fmt.Errorf("%w: required", service.ErrInvalidBillingPeriod)}, status: http.StatusBadRequest, code: "validation_failed", field: "billing_months"},
+		{err: service.ErrInvalidCursor, status: http.StatusBadRequest, code: "validation_failed", field: "cursor"},
+		{err: fmt.Errorf("%w: unsupported sort field %q", repository.ErrInvalidSort, "x"), status: http.StatusBadRequest, code: "validation_failed", field: "sort"},
+		{err: fmt.Errorf("%w: line 2: rate must be positive", service.ErrInvalidExchangeRate), status: http.StatusBadRequest, code: "validation_failed"},
+		{err: fmt.Errorf("failed to get subscription: %w", errors.New("pq: connection refused")), status: http.StatusInternalServerError, code: "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			router := gin.New()
+			router.GET("/x", func(c *gin.Context) {
+				c.Request = c.Request.WithContext(reqctx.WithRequestID(c.Request.Context(), "req-1"))
+				respondError(c, tt.err)
+			})
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+
+			assert.Equal(t, tt.status, rec.Code)
+			problem := decodeProblem(t, rec)
+			assert.Equal(t, tt.code, problem.Code)
+			assert.Equal(t, "/x", problem.Instance)
+			assert.Equal(t, "req-1", problem.RequestID)
+			if tt.field != "" {
+				require.Len(t, problem.Errors, 1)
+				assert.Equal(t, tt.field, problem.Errors[0].Field)
+			} else {
+				assert.Empty(t, problem.Errors)
+			}
+			if tt.status == http.StatusInternalServerError {
+				assert.NotContains(t, problem.Detail, "pq:")
+			}
+		})
+	}
+}
+
+func TestInvalidBody_FieldErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/x", func(c *gin.Context) {
+		var req models.CreateSubscriptionReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			invalidBody(c, err)
+		}
+	})
+
+	post := func(body string) Problem {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/x", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		return decodeProblem(t, rec)
+	}
+
+	// Поля называются как в JSON, по одной ошибке на поле
+	problem := post(`{"price":0,"user_id":"nope","billing_period":"daily","start_date":"01-2025"}`)
+	assert.Equal(t, "validation_failed", problem.Code)
+	assert.ElementsMatch(t, []FieldError{
+		{Field: "service_name", Message: "is required"},
+		{Field: "price", Message: "is required"},
+		{Field: "billing_period", Message: "must be one of: weekly, monthly, quarterly, yearly, custom"},
+		{Field: "user_id", Message: "must be a UUID"},
+	}, problem.Errors)
+
+	problem = post(`{"service_name":"Okko","price":"free","user_id":"` + "11111111-1111-1111-1111-111111111111" + `","start_date":"01-2025"}`)
+	assert.Equal(t, "validation_failed", problem.Code)
+	assert.Equal(t, []FieldError{{Field: "price", Message: "must be int"}}, problem.Errors)
+
+	assert.Equal(t, "invalid_request", post(`{"service_name":`).Code)
+}
+
+func TestRespondError_RuleViolations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/x", func(c *gin.Context) {
+		respondError(c, &service.ValidationError{Fields: []service.FieldError{
+			{Field: "end_date", Err: errors.New("must not be before start_date")},
+			{Field: "price", Err: errors.New("must not exceed 1000000")},
+		}})
+	})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+
+	// Все нарушенные правила приходят одним ответом
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, "constraint_violation", problem.Code)
+	assert.Equal(t, []FieldError{
+		{Field: "end_date", Message: "must not be before start_date"},
+		{Field: "price", Message: "must not exceed 1000000"},
+	}, problem.Errors)
+}
@@ -1,17 +1,93 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// etag строгий ETag подписки по ее версии
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
 }
 
-// parseMonthYear
-func parseMonthYear(s string) (time.Time, error) {
-	return time.Parse("01-2006", s)
+// ifMatchVersion версия из заголовка If-Match. Без заголовка и для "*" — 0, проверка не нужна;
+// false — значение не похоже на выданный нами ETag
+func ifMatchVersion(c *gin.Context) (int, bool) {
+	v := strings.TrimSpace(c.GetHeader("If-Match"))
+	if v == "" || v == "*" {
+		return 0, true
+	}
+	v = strings.TrimPrefix(v, "W/")
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(v[1 : len(v)-1])
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// preconditionFailed отвечает 412 на If-Match, который не похож на выданный нами ETag
+func preconditionFailed(c *gin.Context) {
+	respondProblem(c, http.StatusPreconditionFailed, codePreconditionFailed, "If-Match must be an ETag of the subscription")
+}
+
+// setPageHeaders дублирует метаданные страницы в заголовках: X-Total-Count и Link (RFC 8288)
+// со ссылками на первую и следующую страницу при тех же фильтрах
+func setPageHeaders(c *gin.Context, total int, nextCursor string) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+
+	links := []string{pageLink(c, "", "first")}
+	if nextCursor != "" {
+		links = append(links, pageLink(c, nextCursor, "next"))
+	}
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+func pageLink(c *gin.Context, cursor, rel string) string {
+	query := c.Request.URL.Query()
+	query.Del("offset")
+	query.Del("cursor")
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	u := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+}
+
+var errDateFormat = errors.New("expected YYYY-MM-DD or MM-YYYY")
+
+// parseStartDate парсит начало периода: YYYY-MM-DD или MM-YYYY (первое число месяца)
+func parseStartDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("01-2006", s)
+	if err != nil {
+		return time.Time{}, errDateFormat
+	}
+	return t, nil
+}
+
+// parseEndDate парсит конец периода: YYYY-MM-DD или MM-YYYY (последнее число месяца)
+func parseEndDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("01-2006", s)
+	if err != nil {
+		return time.Time{}, errDateFormat
+	}
+	return t.AddDate(0, 1, -1), nil
 }
 
 // parseQueryInt парсит целое число из строки запроса
@@ -23,3 +99,27 @@ func parseQueryInt(s string, target *int) (int, error) {
 	*target = val
 	return val, nil
 }
+
+// parseQueryUUID необязательный UUID из строки запроса. При ошибке сам отвечает 400 и возвращает false
+func parseQueryUUID(c *gin.Context, name string) (*uuid.UUID, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		invalidParam(c, name, "must be a UUID")
+		return nil, false
+	}
+	return &id, true
+}
+
+// parsePagination читает limit и offset из запроса; некорректные значения игнорируются
+func parsePagination(c *gin.Context, limit, offset *int) {
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		*limit = l
+	}
+	if o, err := strconv.Atoi(c.Query("offset")); err == nil && o >= 0 {
+		*offset = o
+	}
+}
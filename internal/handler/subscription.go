@@ -1,11 +1,13 @@
 package handler
 
 import (
-	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"em_tz_anvar/internal/models"
-	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -14,95 +16,272 @@ import (
 
 // CreateSubscription создает новую подписку
 // @Summary Создание подписки
-// @Description Создает новую запись о подписке пользователя
+// @Description Создает новую запись о подписке пользователя.
+// @Description billing_period задает период списания (по умолчанию monthly), для custom нужен billing_months.
+// @Description Повтор с тем же Idempotency-Key и телом возвращает первый ответ, не создавая подписку заново.
+// @Description Нарушение доменных правил (end_date раньше start_date, цена выше лимита и т.п.) — 422 constraint_violation.
+// @Description Пересечение с подпиской пользователя на тот же сервис: в режиме warn ID таких подписок в overlaps, в режиме reject — 409 subscription_overlap
 // @Tags subscriptions
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Ключ идемпотентности, хранится 24 часа"
 // @Param input body models.CreateSubscriptionReq true "Данные подписки"
 // @Success 201 {object} models.Subscription
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscriptions [post]
 func (h *Handler) CreateSubscription(c *gin.Context) {
 	var req models.CreateSubscriptionReq
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Warn().Err(err).Msg("Invalid request body")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body: " + err.Error()})
+		invalidBody(c, err)
 		return
 	}
 
 	subscription, err := h.services.Subscription.Create(c.Request.Context(), &req)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create subscription")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(subscription.Version))
 	c.JSON(http.StatusCreated, subscription)
 }
 
 // GetSubscription возвращает подписку по ID
 // @Summary Получение подписки
-// @Description Возвращает подписку по её ID
+// @Description Возвращает подписку по её ID. Заголовок ETag передается в If-Match при изменении
 // @Tags subscriptions
 // @Produce json
 // @Param id path string true "ID подписки (UUID)"
 // @Success 200 {object} models.Subscription
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscriptions/{id} [get]
 func (h *Handler) GetSubscription(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid subscription ID")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid subscription ID"})
+		invalidParam(c, "id", "must be a UUID")
 		return
 	}
 
 	subscription, err := h.services.Subscription.GetByID(c.Request.Context(), id)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "subscription not found"})
-			return
-		}
-		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to get subscription")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(subscription.Version))
 	c.JSON(http.StatusOK, subscription)
 }
 
+// GetSubscriptionCharges возвращает начисления подписки
+// @Summary Начисления подписки
+// @Description Возвращает журнал начислений подписки: по строке на каждый цикл списания.
+// @Description У бессрочной подписки начисления построены на 24 месяца вперед
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "ID подписки (UUID)"
+// @Success 200 {array} models.Charge
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscriptions/{id}/charges [get]
+func (h *Handler) GetSubscriptionCharges(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid subscription ID")
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	charges, err := h.services.Subscription.GetCharges(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if charges == nil {
+		charges = []models.Charge{}
+	}
+
+	c.JSON(http.StatusOK, charges)
+}
+
 // GetAllSubscriptions возвращает список подписок
 // @Summary Список подписок
-// @Description Возвращает список всех подписок с возможностью фильтрации
+// @Description Возвращает страницу подписок с возможностью фильтрации, по умолчанию новые первыми.
+// @Description sort — price, start_date, service_name или created_at (в корзине также deleted_at), "-" перед полем — по убыванию.
+// @Description Следующая страница запрашивается с cursor=next_cursor; на последней странице next_cursor нет.
+// @Description offset — устаревший режим, с cursor не сочетается.
+// @Description total и заголовок X-Total-Count — число подписок под фильтром, Link — ссылки first и next
 // @Tags subscriptions
 // @Produce json
-// @Param user_id query string false "ID пользователя (UUID)"
+// @Param user_id query []string false "ID пользователей (UUID), повторяются или через запятую" collectionFormat(multi)
+// @Param service_id query string false "ID сервиса каталога (UUID)"
 // @Param service_name query string false "Название сервиса"
+// @Param service_name_match query string false "contains — подстрока без учета регистра, exact — сервис с этим названием или псевдонимом" Enums(contains, exact) default(contains)
+// @Param price_min query int false "Минимальная цена"
+// @Param price_max query int false "Максимальная цена"
+// @Param active_at query string false "Активна на дату (YYYY-MM-DD или MM-YYYY)"
+// @Param start_from query string false "Начало не раньше (YYYY-MM-DD или MM-YYYY)"
+// @Param start_to query string false "Начало не позже (YYYY-MM-DD или MM-YYYY)"
+// @Param end_from query string false "Окончание не раньше (YYYY-MM-DD или MM-YYYY)"
+// @Param end_to query string false "Окончание не позже (YYYY-MM-DD или MM-YYYY)"
+// @Param has_end_date query bool false "true — только с датой окончания, false — только бессрочные"
+// @Param sort query string false "Сортировка, например -price или start_date" default(-created_at)
+// @Param deleted query bool false "true — подписки в корзине"
 // @Param limit query int false "Лимит записей" default(20)
-// @Param offset query int false "Смещение" default(0)
-// @Success 200 {array} models.Subscription
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Param cursor query string false "next_cursor предыдущей страницы"
+// @Param offset query int false "Смещение (устаревший режим)" default(0)
+// @Success 200 {object} models.SubscriptionPage
+// @Header 200 {integer} X-Total-Count "Число подписок под фильтром"
+// @Header 200 {string} Link "Ссылки на первую и следующую страницу"
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscriptions [get]
 func (h *Handler) GetAllSubscriptions(c *gin.Context) {
+	filter, ok := parseSubscriptionFilter(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.services.Subscription.GetAll(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	setPageHeaders(c, page.Total, page.NextCursor)
+	c.JSON(http.StatusOK, page)
+}
+
+// parseSubscriptionFilter разбирает фильтры, сортировку и пагинацию списка подписок.
+// При ошибке сам отвечает 400 и возвращает false
+func parseSubscriptionFilter(c *gin.Context) (*models.SubscriptionFilter, bool) {
 	filter := &models.SubscriptionFilter{
 		ServiceName: c.Query("service_name"),
+		Sort:        c.Query("sort"),
 		Limit:       20,
 		Offset:      0,
 	}
 
-	// Парсинг user_id
-	if userIDStr := c.Query("user_id"); userIDStr != "" {
-		userID, err := uuid.Parse(userIDStr)
+	// user_id повторяется или перечисляется через запятую; один пользователь остается UserID
+	var userIDs []uuid.UUID
+	for _, value := range c.QueryArray("user_id") {
+		for _, userIDStr := range strings.Split(value, ",") {
+			userID, err := uuid.Parse(strings.TrimSpace(userIDStr))
+			if err != nil {
+				log.Warn().Err(err).Str("user_id", userIDStr).Msg("Invalid user ID")
+				invalidParam(c, "user_id", "must be a UUID")
+				return nil, false
+			}
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if len(userIDs) == 1 {
+		filter.UserID = &userIDs[0]
+	} else {
+		filter.UserIDs = userIDs
+	}
+
+	var ok bool
+	if filter.ServiceID, ok = parseQueryUUID(c, "service_id"); !ok {
+		return nil, false
+	}
+
+	switch c.Query("service_name_match") {
+	case "", "contains":
+	case "exact":
+		filter.ServiceNameExact = true
+	default:
+		invalidParam(c, "service_name_match", "must be one of: exact, contains")
+		return nil, false
+	}
+
+	for _, p := range []struct {
+		name   string
+		target **int
+	}{{"price_min", &filter.PriceMin}, {"price_max", &filter.PriceMax}} {
+		value := c.Query(p.name)
+		if value == "" {
+			continue
+		}
+		price, err := strconv.Atoi(value)
+		if err != nil || price < 0 {
+			invalidParam(c, p.name, "must be a non-negative integer")
+			return nil, false
+		}
+		*p.target = &price
+	}
+	if filter.PriceMin != nil && filter.PriceMax != nil && *filter.PriceMin > *filter.PriceMax {
+		invalidParam(c, "price_min", "must not exceed price_max")
+		return nil, false
+	}
+
+	// Начала диапазонов — первое число месяца, концы — последнее
+	for _, d := range []struct {
+		name   string
+		parse  func(string) (time.Time, error)
+		target **time.Time
+	}{
+		{"active_at", parseStartDate, &filter.ActiveAt},
+		{"start_from", parseStartDate, &filter.StartFrom},
+		{"start_to", parseEndDate, &filter.StartTo},
+		{"end_from", parseStartDate, &filter.EndFrom},
+		{"end_to", parseEndDate, &filter.EndTo},
+	} {
+		value := c.Query(d.name)
+		if value == "" {
+			continue
+		}
+		date, err := d.parse(value)
 		if err != nil {
-			log.Warn().Err(err).Str("user_id", userIDStr).Msg("Invalid user ID")
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid user_id format"})
-			return
+			invalidDate(c, d.name, "YYYY-MM-DD or MM-YYYY")
+			return nil, false
 		}
-		filter.UserID = &userID
+		*d.target = &date
+	}
+
+	if hasEndDate := c.Query("has_end_date"); hasEndDate != "" {
+		h, err := strconv.ParseBool(hasEndDate)
+		if err != nil {
+			invalidParam(c, "has_end_date", "must be true or false")
+			return nil, false
+		}
+		filter.HasEndDate = &h
+	}
+
+	if deleted := c.Query("deleted"); deleted != "" {
+		d, err := strconv.ParseBool(deleted)
+		if err != nil {
+			invalidParam(c, "deleted", "must be true or false")
+			return nil, false
+		}
+		filter.Deleted = d
 	}
 
 	// Парсинг limit и offset
@@ -120,84 +299,253 @@ func (h *Handler) GetAllSubscriptions(c *gin.Context) {
 		}
 	}
 
-	subscriptions, err := h.services.Subscription.GetAll(c.Request.Context(), filter)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to get subscriptions")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-		return
+	filter.Cursor = c.Query("cursor")
+	if filter.Cursor != "" && filter.Offset > 0 {
+		invalidParam(c, "cursor", "cannot be combined with offset")
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, subscriptions)
+	return filter, true
 }
 
-// UpdateSubscription обновляет подписку
-// @Summary Обновление подписки
-// @Description Обновляет существующую подписку
+// UpdateSubscription заменяет подписку целиком
+// @Summary Замена подписки
+// @Description Полная замена: service_name, price и start_date обязательны, не переданные currency, billing_period и end_date
+// @Description получают значения по умолчанию (RUB, monthly, бессрочно). Для частичного изменения используйте PATCH.
+// @Description Новая цена действует с price_effective_from (по умолчанию с сегодняшнего дня): списания до этой даты остаются по прежней цене.
+// @Description Пересечения с другими подписками на тот же сервис проверяются, как при создании
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param id path string true "ID подписки (UUID)"
-// @Param input body models.UpdateSubscriptionReq true "Данные для обновления"
+// @Param If-Match header string false "ETag из GetSubscription: изменить, только если подписка не менялась"
+// @Param input body models.UpdateSubscriptionReq true "Подписка целиком"
 // @Success 200 {object} models.Subscription
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscriptions/{id} [put]
 func (h *Handler) UpdateSubscription(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid subscription ID")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid subscription ID"})
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		preconditionFailed(c)
 		return
 	}
 
 	var req models.UpdateSubscriptionReq
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Warn().Err(err).Msg("Invalid request body")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body: " + err.Error()})
+		invalidBody(c, err)
 		return
 	}
 
-	subscription, err := h.services.Subscription.Update(c.Request.Context(), id, &req)
+	subscription, err := h.services.Subscription.Update(c.Request.Context(), id, &req, version)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "subscription not found"})
-			return
-		}
-		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to update subscription")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
+	c.JSON(http.StatusOK, subscription)
+}
+
+// PatchSubscription частично изменяет подписку
+// @Summary Частичное изменение подписки
+// @Description JSON Merge Patch (RFC 7396): меняются только переданные поля, null сбрасывает поле.
+// @Description end_date: null делает подписку бессрочной, currency и billing_period: null возвращают значения по умолчанию.
+// @Description service_name, price и start_date сбросить нельзя. Пересечения проверяются, как при создании
+// @Tags subscriptions
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "ID подписки (UUID)"
+// @Param If-Match header string false "ETag из GetSubscription: изменить, только если подписка не менялась"
+// @Param input body models.PatchSubscriptionReq true "Изменяемые поля"
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscriptions/{id} [patch]
+func (h *Handler) PatchSubscription(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid subscription ID")
+		invalidParam(c, "id", "must be a UUID")
 		return
 	}
 
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		preconditionFailed(c)
+		return
+	}
+
+	var req models.PatchSubscriptionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidBody(c, err)
+		return
+	}
+	if fe := validatePatch(&req); fe != nil {
+		invalidParam(c, fe.Field, fe.Message)
+		return
+	}
+
+	subscription, err := h.services.Subscription.Patch(c.Request.Context(), id, &req, version)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
 	c.JSON(http.StatusOK, subscription)
 }
 
+// validatePatch проверяет поля merge patch по тем же правилам, что binding у UpdateSubscriptionReq
+func validatePatch(req *models.PatchSubscriptionReq) *FieldError {
+	switch {
+	case req.ServiceName.Set && req.ServiceName.Value == "":
+		return &FieldError{Field: "service_name", Message: "cannot be removed or empty"}
+	case req.Price.Set && req.Price.Value < 1:
+		return &FieldError{Field: "price", Message: "cannot be removed and must be at least 1"}
+	case req.StartDate.Set && req.StartDate.Value == "":
+		return &FieldError{Field: "start_date", Message: "cannot be removed or empty"}
+	case req.Currency.Present() && !service.IsCurrencyCode(req.Currency.Value):
+		return &FieldError{Field: "currency", Message: "must be a three-letter ISO 4217 code"}
+	case req.BillingMonths.Present() && (req.BillingMonths.Value < 1 || req.BillingMonths.Value > 120):
+		return &FieldError{Field: "billing_months", Message: "must be between 1 and 120"}
+	}
+	if req.BillingPeriod.Present() {
+		switch req.BillingPeriod.Value {
+		case models.BillingWeekly, models.BillingMonthly, models.BillingQuarterly, models.BillingYearly, models.BillingCustom:
+		default:
+			return &FieldError{Field: "billing_period", Message: "must be one of: weekly, monthly, quarterly, yearly, custom"}
+		}
+	}
+	return nil
+}
+
 // DeleteSubscription удаляет подписку
 // @Summary Удаление подписки
-// @Description Удаляет подписку по ID
+// @Description Переносит подписку в корзину: она пропадает из списков и отчетов, но может быть восстановлена
 // @Tags subscriptions
 // @Param id path string true "ID подписки (UUID)"
+// @Param If-Match header string false "ETag из GetSubscription: удалить, только если подписка не менялась"
 // @Success 204 "No Content"
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscriptions/{id} [delete]
 func (h *Handler) DeleteSubscription(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid subscription ID")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid subscription ID"})
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		preconditionFailed(c)
 		return
 	}
 
-	err = h.services.Subscription.Delete(c.Request.Context(), id)
+	err = h.services.Subscription.Delete(c.Request.Context(), id, version)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "subscription not found"})
-			return
-		}
-		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to delete subscription")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RestoreSubscription возвращает подписку из корзины
+// @Summary Восстановление подписки
+// @Description Возвращает удаленную подписку из корзины
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "ID подписки (UUID)"
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscriptions/{id}/restore [post]
+func (h *Handler) RestoreSubscription(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid subscription ID")
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	subscription, err := h.services.Subscription.Restore(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
+	c.JSON(http.StatusOK, subscription)
+}
+
+// PurgeSubscription окончательно удаляет подписку из корзины
+// @Summary Окончательное удаление подписки
+// @Description Удаляет подписку из корзины вместе с начислениями и историей цен. Активную подписку нужно сначала удалить
+// @Tags subscriptions
+// @Param id path string true "ID подписки (UUID)"
+// @Success 204 "No Content"
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscriptions/{id}/purge [delete]
+func (h *Handler) PurgeSubscription(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid subscription ID")
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	if err := h.services.Subscription.Purge(c.Request.Context(), id); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -206,44 +554,187 @@ func (h *Handler) DeleteSubscription(c *gin.Context) {
 
 // GetTotalCost возвращает суммарную стоимость подписок за период
 // @Summary Суммарная стоимость подписок
-// @Description Подсчитывает суммарную стоимость всех подписок за выбранный период
+// @Description Подсчитывает суммарную стоимость всех подписок за выбранный период по фактическим списаниям (в годовщины start_date с учетом billing_period).
+// @Description Суммы в разных валютах не складываются: разбивка по валютам возвращается в totals.
+// @Description С target_currency каждый месяц пересчитывается по курсу на конец месяца, в ответе — использованные курсы и месяцы без курса.
+// @Description С group_by в groups возвращается рейтинг сервисов или пользователей по сумме (отдельно в каждой валюте), top ограничивает его длину
 // @Tags subscriptions
 // @Produce json
 // @Param user_id query string false "ID пользователя (UUID)"
+// @Param service_id query string false "ID сервиса каталога (UUID)"
 // @Param service_name query string false "Название сервиса"
-// @Param start_date query string true "Начало периода (MM-YYYY)"
-// @Param end_date query string true "Конец периода (MM-YYYY)"
+// @Param currency query string false "Код валюты (ISO 4217)"
+// @Param target_currency query string false "Валюта пересчета итога (ISO 4217), курсы берутся из /exchange-rates"
+// @Param group_by query string false "Рейтинг по сервисам или пользователям" Enums(service_name, user_id)
+// @Param top query int false "Сколько первых групп вернуть в каждой валюте"
+// @Param start_date query string true "Начало периода (YYYY-MM-DD или MM-YYYY — с первого числа месяца)"
+// @Param end_date query string true "Конец периода включительно (YYYY-MM-DD или MM-YYYY — по последнее число месяца)"
+// @Param proration query string false "Начисление: none — списания в периоде целиком (по умолчанию), daily — доля цикла по дням" Enums(none, daily)
 // @Success 200 {object} models.TotalCostResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscriptions/cost [get]
 func (h *Handler) GetTotalCost(c *gin.Context) {
+	filter, ok := parseCostFilter(c)
+	if !ok {
+		return
+	}
+
+	if target := c.Query("target_currency"); target != "" {
+		if !service.IsCurrencyCode(target) {
+			invalidParam(c, "target_currency", "must be a three-letter ISO 4217 code")
+			return
+		}
+		filter.TargetCurrency = target
+	}
+
+	if !parseCostGroupBy(c, filter) {
+		return
+	}
+
+	if top := c.Query("top"); top != "" {
+		var n int
+		if _, err := parseQueryInt(top, &n); err != nil || n <= 0 {
+			invalidParam(c, "top", "must be a positive integer")
+			return
+		}
+		if filter.GroupBy == "" {
+			invalidParam(c, "top", "requires group_by")
+			return
+		}
+		filter.Top = n
+	}
+
+	if filter.GroupBy != "" && filter.TargetCurrency != "" {
+		invalidParam(c, "group_by", "cannot be combined with target_currency")
+		return
+	}
+
+	result, err := h.services.Subscription.GetTotalCost(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetCostBreakdown возвращает стоимость подписок по месяцам
+// @Summary Стоимость подписок по месяцам
+// @Description Возвращает по строке на каждый месяц периода (в том числе пустые месяцы) с суммами по валютам.
+// @Description С group_by суммы внутри месяца разбиваются по названию сервиса или пользователю
+// @Tags subscriptions
+// @Produce json
+// @Param user_id query string false "ID пользователя (UUID)"
+// @Param service_id query string false "ID сервиса каталога (UUID)"
+// @Param service_name query string false "Название сервиса"
+// @Param currency query string false "Код валюты (ISO 4217)"
+// @Param group_by query string false "Группировка внутри месяца" Enums(service_name, user_id)
+// @Param start_date query string true "Начало периода (YYYY-MM-DD или MM-YYYY — с первого числа месяца)"
+// @Param end_date query string true "Конец периода включительно (YYYY-MM-DD или MM-YYYY — по последнее число месяца)"
+// @Param proration query string false "Начисление: none — списания в периоде целиком (по умолчанию), daily — доля цикла по дням" Enums(none, daily)
+// @Success 200 {object} models.CostBreakdownResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscriptions/cost/breakdown [get]
+func (h *Handler) GetCostBreakdown(c *gin.Context) {
+	filter, ok := parseCostFilter(c)
+	if !ok {
+		return
+	}
+
+	if !parseCostGroupBy(c, filter) {
+		return
+	}
+
+	result, err := h.services.Subscription.GetCostBreakdown(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// parseCostGroupBy разбирает group_by. При ошибке сам отвечает 400 и возвращает false
+func parseCostGroupBy(c *gin.Context, filter *models.CostFilter) bool {
+	groupBy := c.Query("group_by")
+	if groupBy == "" {
+		return true
+	}
+
+	if groupBy != models.CostGroupByServiceName && groupBy != models.CostGroupByUserID {
+		invalidParam(c, "group_by", "must be one of: service_name, user_id")
+		return false
+	}
+
+	filter.GroupBy = groupBy
+	return true
+}
+
+// parseCostFilter разбирает общие параметры эндпоинтов стоимости.
+// При ошибке сам отвечает 400 и возвращает false
+func parseCostFilter(c *gin.Context) (*models.CostFilter, bool) {
 	startDateStr := c.Query("start_date")
 	endDateStr := c.Query("end_date")
 
 	if startDateStr == "" || endDateStr == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "start_date and end_date are required"})
-		return
+		respondProblem(c, http.StatusBadRequest, codeValidationFailed, "start_date and end_date are required",
+			FieldError{Field: "start_date", Message: "is required"}, FieldError{Field: "end_date", Message: "is required"})
+		return nil, false
 	}
 
-	startDate, err := parseMonthYear(startDateStr)
+	startDate, err := parseStartDate(startDateStr)
 	if err != nil {
 		log.Warn().Err(err).Str("start_date", startDateStr).Msg("Invalid start_date format")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid start_date format, expected MM-YYYY"})
-		return
+		invalidDate(c, "start_date", "YYYY-MM-DD or MM-YYYY")
+		return nil, false
 	}
 
-	endDate, err := parseMonthYear(endDateStr)
+	endDate, err := parseEndDate(endDateStr)
 	if err != nil {
 		log.Warn().Err(err).Str("end_date", endDateStr).Msg("Invalid end_date format")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid end_date format, expected MM-YYYY"})
-		return
+		invalidDate(c, "end_date", "YYYY-MM-DD or MM-YYYY")
+		return nil, false
+	}
+
+	// Перевернутый период дал бы нулевую сумму вместо ошибки
+	if startDate.After(endDate) {
+		invalidParam(c, "start_date", "must not be after end_date")
+		return nil, false
 	}
 
 	filter := &models.CostFilter{
 		StartDate:   startDate,
 		EndDate:     endDate,
 		ServiceName: c.Query("service_name"),
+		Proration:   models.ProrationNone,
+	}
+
+	if proration := c.Query("proration"); proration != "" {
+		if proration != models.ProrationNone && proration != models.ProrationDaily {
+			invalidParam(c, "proration", "must be one of: none, daily")
+			return nil, false
+		}
+		filter.Proration = proration
+	}
+
+	if currency := c.Query("currency"); currency != "" {
+		if !service.IsCurrencyCode(currency) {
+			invalidParam(c, "currency", "must be a three-letter ISO 4217 code")
+			return nil, false
+		}
+		filter.Currency = currency
 	}
 
 	// Парсинг user_id
@@ -251,18 +742,16 @@ func (h *Handler) GetTotalCost(c *gin.Context) {
 		userID, err := uuid.Parse(userIDStr)
 		if err != nil {
 			log.Warn().Err(err).Str("user_id", userIDStr).Msg("Invalid user ID")
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid user_id format"})
-			return
+			invalidParam(c, "user_id", "must be a UUID")
+			return nil, false
 		}
 		filter.UserID = &userID
 	}
 
-	result, err := h.services.Subscription.GetTotalCost(c.Request.Context(), filter)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to calculate total cost")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-		return
+	var ok bool
+	if filter.ServiceID, ok = parseQueryUUID(c, "service_id"); !ok {
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, result)
+	return filter, true
 }
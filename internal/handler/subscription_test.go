@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/policy"
 	"em_tz_anvar/internal/repository"
 	"em_tz_anvar/internal/service"
 
@@ -24,10 +26,32 @@ import (
 type mockSubscriptionService struct {
 	createFn       func(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error)
 	getByIDFn      func(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
-	getAllFn       func(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error)
-	updateFn       func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq) (*models.Subscription, error)
-	deleteFn       func(ctx context.Context, id uuid.UUID) error
+	getAllFn       func(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error)
+	updateFn       func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error)
+	patchFn        func(ctx context.Context, id uuid.UUID, req *models.PatchSubscriptionReq, version int) (*models.Subscription, error)
+	deleteFn       func(ctx context.Context, id uuid.UUID, version int) error
 	getTotalCostFn func(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error)
+	getBreakdownFn func(ctx context.Context, filter *models.CostFilter) (*models.CostBreakdownResponse, error)
+	getChargesFn   func(ctx context.Context, id uuid.UUID) ([]models.Charge, error)
+	rebuildFn      func(ctx context.Context) (int, error)
+	restoreFn      func(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	purgeFn        func(ctx context.Context, id uuid.UUID) error
+	getOverlapsFn  func(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error)
+	getSummaryFn   func(ctx context.Context, userID uuid.UUID) (*models.UserSummary, error)
+}
+
+func (m *mockSubscriptionService) Restore(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	if m.restoreFn != nil {
+		return m.restoreFn(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionService) Purge(ctx context.Context, id uuid.UUID) error {
+	if m.purgeFn != nil {
+		return m.purgeFn(ctx, id)
+	}
+	return nil
 }
 
 func (m *mockSubscriptionService) Create(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error) {
@@ -44,23 +68,30 @@ func (m *mockSubscriptionService) GetByID(ctx context.Context, id uuid.UUID) (*m
 	return nil, nil
 }
 
-func (m *mockSubscriptionService) GetAll(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
+func (m *mockSubscriptionService) GetAll(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
 	if m.getAllFn != nil {
 		return m.getAllFn(ctx, filter)
 	}
 	return nil, nil
 }
 
-func (m *mockSubscriptionService) Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq) (*models.Subscription, error) {
+func (m *mockSubscriptionService) Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
 	if m.updateFn != nil {
-		return m.updateFn(ctx, id, req)
+		return m.updateFn(ctx, id, req, version)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionService) Patch(ctx context.Context, id uuid.UUID, req *models.PatchSubscriptionReq, version int) (*models.Subscription, error) {
+	if m.patchFn != nil {
+		return m.patchFn(ctx, id, req, version)
 	}
 	return nil, nil
 }
 
-func (m *mockSubscriptionService) Delete(ctx context.Context, id uuid.UUID) error {
+func (m *mockSubscriptionService) Delete(ctx context.Context, id uuid.UUID, version int) error {
 	if m.deleteFn != nil {
-		return m.deleteFn(ctx, id)
+		return m.deleteFn(ctx, id, version)
 	}
 	return nil
 }
@@ -72,11 +103,46 @@ func (m *mockSubscriptionService) GetTotalCost(ctx context.Context, filter *mode
 	return nil, nil
 }
 
+func (m *mockSubscriptionService) GetCostBreakdown(ctx context.Context, filter *models.CostFilter) (*models.CostBreakdownResponse, error) {
+	if m.getBreakdownFn != nil {
+		return m.getBreakdownFn(ctx, filter)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionService) GetCharges(ctx context.Context, id uuid.UUID) ([]models.Charge, error) {
+	if m.getChargesFn != nil {
+		return m.getChargesFn(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionService) RebuildCharges(ctx context.Context) (int, error) {
+	if m.rebuildFn != nil {
+		return m.rebuildFn(ctx)
+	}
+	return 0, nil
+}
+
+func (m *mockSubscriptionService) GetOverlaps(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error) {
+	if m.getOverlapsFn != nil {
+		return m.getOverlapsFn(ctx, userID)
+	}
+	return []models.SubscriptionOverlap{}, nil
+}
+
+func (m *mockSubscriptionService) GetUserSummary(ctx context.Context, userID uuid.UUID) (*models.UserSummary, error) {
+	if m.getSummaryFn != nil {
+		return m.getSummaryFn(ctx, userID)
+	}
+	return &models.UserSummary{UserID: userID}, nil
+}
+
 func handlerWithMock(mock *mockSubscriptionService) *Handler {
 	svc := &service.Service{
 		Subscription: mock,
 	}
-	return NewHandler(svc)
+	return NewHandler(svc, nil, nil)
 }
 
 func TestHandler_CreateSubscription(t *testing.T) {
@@ -113,6 +179,75 @@ func TestHandler_CreateSubscription(t *testing.T) {
 	assert.Equal(t, 400, sub.Price)
 }
 
+func TestHandler_CreateSubscription_InvalidCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithMock(&mockSubscriptionService{})
+	router := gin.New()
+	router.POST("/api/v1/subscriptions", h.CreateSubscription)
+
+	body := `{"service_name":"Netflix","price":15,"currency":"XXQ","user_id":"` + uuid.New().String() + `","start_date":"01-2025"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, "validation_failed", problem.Code)
+	assert.Equal(t, []FieldError{{Field: "currency", Message: "must be a three-letter ISO 4217 code"}}, problem.Errors)
+}
+
+func TestHandler_CreateSubscription_InvalidDate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockSubscriptionService{
+		createFn: func(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error) {
+			return nil, &service.FieldError{Field: "start_date", Err: service.ErrInvalidDate}
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.POST("/api/v1/subscriptions", h.CreateSubscription)
+
+	body := `{"service_name":"Yandex","price":400,"user_id":"` + uuid.New().String() + `","start_date":"2025-13"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	// Раньше любая ошибка сервиса при создании превращалась в 500
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, "invalid_date", problem.Code)
+	assert.Equal(t, []FieldError{{Field: "start_date", Message: service.ErrInvalidDate.Error()}}, problem.Errors)
+}
+
+func TestHandler_CreateSubscription_InvalidBillingPeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockSubscriptionService{
+		createFn: func(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error) {
+			return nil, fmt.Errorf("%w: billing_months is required for custom billing_period", service.ErrInvalidBillingPeriod)
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.POST("/api/v1/subscriptions", h.CreateSubscription)
+
+	for _, body := range []string{
+		`{"service_name":"Ivi","price":100,"billing_period":"daily","user_id":"` + uuid.New().String() + `","start_date":"01-2025"}`,
+		`{"service_name":"Ivi","price":100,"billing_period":"custom","user_id":"` + uuid.New().String() + `","start_date":"01-2025"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
 func TestHandler_CreateSubscription_InvalidJSON(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	h := handlerWithMock(&mockSubscriptionService{})
@@ -126,13 +261,14 @@ func TestHandler_CreateSubscription_InvalidJSON(t *testing.T) {
 	router.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_request", decodeProblem(t, rec).Code)
 }
 
 func TestHandler_CreateSubscription_ServiceError(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mock := &mockSubscriptionService{
 		createFn: func(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error) {
-			return nil, errors.New("db error")
+			return nil, errors.New(`pq: relation "subscriptions" does not exist`)
 		},
 	}
 	h := handlerWithMock(mock)
@@ -147,6 +283,9 @@ func TestHandler_CreateSubscription_ServiceError(t *testing.T) {
 	router.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	// Подробности ошибки базы остаются в логе
+	assert.NotContains(t, rec.Body.String(), "pq:")
+	assert.Equal(t, "internal_error", decodeProblem(t, rec).Code)
 }
 
 func TestHandler_GetSubscription(t *testing.T) {
@@ -161,6 +300,7 @@ func TestHandler_GetSubscription(t *testing.T) {
 				UserID:      id,
 				StartDate:   time.Now(),
 				UpdatedAt:   time.Now(),
+				Version:     7,
 			}, nil
 		},
 	}
@@ -178,6 +318,7 @@ func TestHandler_GetSubscription(t *testing.T) {
 	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sub))
 	assert.Equal(t, id, sub.ID)
 	assert.Equal(t, "Netflix", sub.ServiceName)
+	assert.Equal(t, `"7"`, rec.Header().Get("ETag"))
 }
 
 func TestHandler_GetSubscription_InvalidID(t *testing.T) {
@@ -213,12 +354,62 @@ func TestHandler_GetSubscription_NotFound(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
 
+func TestHandler_GetSubscriptionCharges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	mock := &mockSubscriptionService{
+		getChargesFn: func(ctx context.Context, subID uuid.UUID) ([]models.Charge, error) {
+			return []models.Charge{
+				{SubscriptionID: subID, PeriodStart: time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), PeriodEnd: time.Date(2025, 2, 14, 0, 0, 0, 0, time.UTC), CycleDays: 31, Amount: 400, Currency: "RUB"},
+			}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/:id/charges", h.GetSubscriptionCharges)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/"+id.String()+"/charges", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var charges []models.Charge
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &charges))
+	require.Len(t, charges, 1)
+	assert.Equal(t, id, charges[0].SubscriptionID)
+	assert.Equal(t, 400, charges[0].Amount)
+}
+
+func TestHandler_GetSubscriptionCharges_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockSubscriptionService{
+		getChargesFn: func(ctx context.Context, id uuid.UUID) ([]models.Charge, error) {
+			return nil, repository.ErrNotFound
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/:id/charges", h.GetSubscriptionCharges)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/"+uuid.New().String()+"/charges", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
 func TestHandler_GetAllSubscriptions(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mock := &mockSubscriptionService{
-		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
-			return []models.Subscription{
-				{ID: uuid.New(), ServiceName: "A", Price: 100, UserID: uuid.New(), StartDate: time.Now(), UpdatedAt: time.Now()},
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+			return &models.SubscriptionPage{
+				Items: []models.Subscription{
+					{ID: uuid.New(), ServiceName: "A", Price: 100, UserID: uuid.New(), StartDate: time.Now(), UpdatedAt: time.Now()},
+				},
+				Total:      3,
+				NextCursor: "next",
 			}, nil
 		},
 	}
@@ -226,23 +417,65 @@ func TestHandler_GetAllSubscriptions(t *testing.T) {
 	router := gin.New()
 	router.GET("/api/v1/subscriptions", h.GetAllSubscriptions)
 
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?service_name=A&limit=1&offset=0", nil)
 	rec := httptest.NewRecorder()
 
 	router.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusOK, rec.Code)
-	var list []models.Subscription
-	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
-	assert.Len(t, list, 1)
-	assert.Equal(t, "A", list[0].ServiceName)
+	var page models.SubscriptionPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, "A", page.Items[0].ServiceName)
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, "next", page.NextCursor)
+	assert.Equal(t, "3", rec.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</api/v1/subscriptions?limit=1&service_name=A>; rel="first", `+
+		`</api/v1/subscriptions?cursor=next&limit=1&service_name=A>; rel="next"`, rec.Header().Get("Link"))
+}
+
+func TestHandler_GetAllSubscriptions_Cursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var captured *models.SubscriptionFilter
+	mock := &mockSubscriptionService{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+			captured = filter
+			if filter.Cursor == "broken" {
+				return nil, service.ErrInvalidCursor
+			}
+			return &models.SubscriptionPage{Items: []models.Subscription{}}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions", h.GetAllSubscriptions)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?cursor=abc&limit=5", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, captured)
+	assert.Equal(t, "abc", captured.Cursor)
+	assert.Equal(t, 5, captured.Limit)
+	assert.JSONEq(t, `{"items":[],"total":0}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?cursor=broken", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Курсор и устаревший offset вместе не принимаются
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?cursor=abc&offset=20", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
 
 func TestHandler_UpdateSubscription(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	subID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
 	mock := &mockSubscriptionService{
-		updateFn: func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq) (*models.Subscription, error) {
+		updateFn: func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
 			return &models.Subscription{
 				ID:          id,
 				ServiceName: "Updated",
@@ -257,7 +490,7 @@ func TestHandler_UpdateSubscription(t *testing.T) {
 	router := gin.New()
 	router.PUT("/api/v1/subscriptions/:id", h.UpdateSubscription)
 
-	body := `{"service_name":"Updated","price":600}`
+	body := `{"service_name":"Updated","price":600,"start_date":"01-2025"}`
 	req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/"+subID.String(), strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
@@ -274,7 +507,7 @@ func TestHandler_UpdateSubscription(t *testing.T) {
 func TestHandler_UpdateSubscription_NotFound(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mock := &mockSubscriptionService{
-		updateFn: func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq) (*models.Subscription, error) {
+		updateFn: func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
 			return nil, repository.ErrNotFound
 		},
 	}
@@ -282,7 +515,7 @@ func TestHandler_UpdateSubscription_NotFound(t *testing.T) {
 	router := gin.New()
 	router.PUT("/api/v1/subscriptions/:id", h.UpdateSubscription)
 
-	body := `{"price":100}`
+	body := `{"service_name":"Netflix","price":100,"start_date":"01-2025"}`
 	req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/11111111-1111-1111-1111-111111111111", strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
@@ -292,10 +525,186 @@ func TestHandler_UpdateSubscription_NotFound(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
 
+func TestHandler_UpdateSubscription_InvalidPriceChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockSubscriptionService{
+		updateFn: func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
+			return nil, fmt.Errorf("%w: price_effective_from requires price", service.ErrInvalidPriceChange)
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.PUT("/api/v1/subscriptions/:id", h.UpdateSubscription)
+
+	body := `{"service_name":"Netflix","price":500,"start_date":"01-2025","price_effective_from":"2025-31-01"}`
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/11111111-1111-1111-1111-111111111111", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_UpdateSubscription_IfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var gotVersion int
+	mock := &mockSubscriptionService{
+		updateFn: func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
+			gotVersion = version
+			if version != 4 {
+				return nil, repository.ErrVersionMismatch
+			}
+			return &models.Subscription{ID: id, ServiceName: "Updated", Version: 5}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.PUT("/api/v1/subscriptions/:id", h.UpdateSubscription)
+
+	tests := []struct {
+		name     string
+		ifMatch  string
+		wantCode int
+		wantETag string
+	}{
+		{name: "current version", ifMatch: `"4"`, wantCode: http.StatusOK, wantETag: `"5"`},
+		{name: "weak etag", ifMatch: `W/"4"`, wantCode: http.StatusOK, wantETag: `"5"`},
+		{name: "stale version", ifMatch: `"3"`, wantCode: http.StatusPreconditionFailed},
+		{name: "malformed", ifMatch: "4", wantCode: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/11111111-1111-1111-1111-111111111111", strings.NewReader(`{"service_name":"Updated","price":600,"start_date":"01-2025"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("If-Match", tt.ifMatch)
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, tt.wantETag, rec.Header().Get("ETag"))
+		})
+	}
+
+	// Без If-Match версия не проверяется
+	gotVersion = -1
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/11111111-1111-1111-1111-111111111111", strings.NewReader(`{"service_name":"Updated","price":600,"start_date":"01-2025"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, 0, gotVersion)
+}
+
+func TestHandler_DeleteSubscription_IfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockSubscriptionService{
+		deleteFn: func(ctx context.Context, id uuid.UUID, version int) error {
+			if version != 0 && version != 2 {
+				return repository.ErrVersionMismatch
+			}
+			return nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.DELETE("/api/v1/subscriptions/:id", h.DeleteSubscription)
+
+	for ifMatch, want := range map[string]int{`"2"`: http.StatusNoContent, "*": http.StatusNoContent, `"1"`: http.StatusPreconditionFailed} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/subscriptions/11111111-1111-1111-1111-111111111111", nil)
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, want, rec.Code, "If-Match %s", ifMatch)
+	}
+}
+
+func TestHandler_UpdateSubscription_RequiresFullBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithMock(&mockSubscriptionService{
+		updateFn: func(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
+			t.Fatal("partial body must not reach the service")
+			return nil, nil
+		},
+	})
+	router := gin.New()
+	router.PUT("/api/v1/subscriptions/:id", h.UpdateSubscription)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/11111111-1111-1111-1111-111111111111", strings.NewReader(`{"price":100}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_PatchSubscription(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var got *models.PatchSubscriptionReq
+	mock := &mockSubscriptionService{
+		patchFn: func(ctx context.Context, id uuid.UUID, req *models.PatchSubscriptionReq, version int) (*models.Subscription, error) {
+			got = req
+			return &models.Subscription{ID: id, ServiceName: "Netflix", Price: 700, Version: 3}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.PATCH("/api/v1/subscriptions/:id", h.PatchSubscription)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/subscriptions/11111111-1111-1111-1111-111111111111", strings.NewReader(`{"price":700,"end_date":null}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	require.NotNil(t, got)
+	assert.True(t, got.Price.Present())
+	assert.Equal(t, 700, got.Price.Value)
+	assert.True(t, got.EndDate.Set)
+	assert.True(t, got.EndDate.Null)
+	assert.False(t, got.ServiceName.Set)
+}
+
+func TestHandler_PatchSubscription_Invalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithMock(&mockSubscriptionService{
+		patchFn: func(ctx context.Context, id uuid.UUID, req *models.PatchSubscriptionReq, version int) (*models.Subscription, error) {
+			t.Fatal("invalid patch must not reach the service")
+			return nil, nil
+		},
+	})
+	router := gin.New()
+	router.PATCH("/api/v1/subscriptions/:id", h.PatchSubscription)
+
+	for _, body := range []string{
+		`{"service_name":null}`,
+		`{"price":0}`,
+		`{"start_date":null}`,
+		`{"currency":"rub"}`,
+		`{"currency":"ZZZ"}`,
+		`{"billing_period":"daily"}`,
+		`{"billing_months":500}`,
+		`{"price":"free"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/subscriptions/11111111-1111-1111-1111-111111111111", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
 func TestHandler_DeleteSubscription(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mock := &mockSubscriptionService{
-		deleteFn: func(ctx context.Context, id uuid.UUID) error {
+		deleteFn: func(ctx context.Context, id uuid.UUID, version int) error {
 			return nil
 		},
 	}
@@ -314,7 +723,7 @@ func TestHandler_DeleteSubscription(t *testing.T) {
 func TestHandler_DeleteSubscription_NotFound(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mock := &mockSubscriptionService{
-		deleteFn: func(ctx context.Context, id uuid.UUID) error {
+		deleteFn: func(ctx context.Context, id uuid.UUID, version int) error {
 			return repository.ErrNotFound
 		},
 	}
@@ -330,6 +739,175 @@ func TestHandler_DeleteSubscription_NotFound(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
 
+func TestHandler_GetAllSubscriptions_Deleted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var captured *models.SubscriptionFilter
+	mock := &mockSubscriptionService{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+			captured = filter
+			return &models.SubscriptionPage{Items: []models.Subscription{}}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions", h.GetAllSubscriptions)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?deleted=true", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, captured)
+	assert.True(t, captured.Deleted)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?deleted=maybe", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_GetAllSubscriptions_Filters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	alice := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	bob := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	carol := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+	var captured *models.SubscriptionFilter
+	mock := &mockSubscriptionService{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+			captured = filter
+			if filter.Sort == "user_id" {
+				return nil, fmt.Errorf("%w: unsupported sort field %q", repository.ErrInvalidSort, filter.Sort)
+			}
+			return &models.SubscriptionPage{Items: []models.Subscription{}}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions", h.GetAllSubscriptions)
+
+	get := func(query string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?"+query, nil))
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, get("user_id="+alice.String()+","+bob.String()+"&user_id="+carol.String()+
+		"&service_name=Okko&service_name_match=exact&price_min=100&price_max=500&active_at=03-2025"+
+		"&start_from=2025-01-15&start_to=02-2025&end_from=01-2026&end_to=06-2026&has_end_date=true&sort=-price"))
+	assert.Nil(t, captured.UserID)
+	assert.Equal(t, []uuid.UUID{alice, bob, carol}, captured.UserIDs)
+	assert.Equal(t, "Okko", captured.ServiceName)
+	assert.True(t, captured.ServiceNameExact)
+	assert.Equal(t, 100, *captured.PriceMin)
+	assert.Equal(t, 500, *captured.PriceMax)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), *captured.ActiveAt)
+	assert.Equal(t, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), *captured.StartFrom)
+	// Конец диапазона в формате MM-YYYY — последнее число месяца
+	assert.Equal(t, time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC), *captured.StartTo)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), *captured.EndFrom)
+	assert.Equal(t, time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC), *captured.EndTo)
+	assert.True(t, *captured.HasEndDate)
+	assert.Equal(t, "-price", captured.Sort)
+
+	// Один пользователь по-прежнему передается как UserID
+	require.Equal(t, http.StatusOK, get("user_id="+alice.String()+"&service_id="+carol.String()))
+	assert.Equal(t, &alice, captured.UserID)
+	assert.Empty(t, captured.UserIDs)
+	assert.Equal(t, &carol, captured.ServiceID)
+
+	for _, query := range []string{
+		"user_id=" + alice.String() + ",nope",
+		"service_name_match=regex",
+		"service_id=netflix",
+		"price_min=-1",
+		"price_max=cheap",
+		"price_min=500&price_max=100",
+		"active_at=yesterday",
+		"end_to=2026-13-01",
+		"has_end_date=sometimes",
+		"sort=user_id",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(query), query)
+	}
+}
+
+func TestHandler_GetAllSubscriptions_Forbidden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := &mockSubscriptionService{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+			return nil, policy.ErrForbidden
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions", h.GetAllSubscriptions)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?user_id="+uuid.New().String(), nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestHandler_RestoreSubscription(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	id := uuid.New()
+	mock := &mockSubscriptionService{
+		restoreFn: func(ctx context.Context, subID uuid.UUID) (*models.Subscription, error) {
+			if subID != id {
+				return nil, repository.ErrNotFound
+			}
+			return &models.Subscription{ID: subID, ServiceName: "Yandex Plus"}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.POST("/api/v1/subscriptions/:id/restore", h.RestoreSubscription)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions/"+id.String()+"/restore", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions/"+uuid.New().String()+"/restore", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_PurgeSubscription(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "purged", err: nil, want: http.StatusNoContent},
+		{name: "not in trash", err: repository.ErrNotDeleted, want: http.StatusConflict},
+		{name: "not found", err: repository.ErrNotFound, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockSubscriptionService{
+				purgeFn: func(ctx context.Context, id uuid.UUID) error { return tt.err },
+			}
+			h := handlerWithMock(mock)
+			router := gin.New()
+			router.DELETE("/api/v1/subscriptions/:id/purge", h.PurgeSubscription)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/subscriptions/"+uuid.New().String()+"/purge", nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
 func TestHandler_GetTotalCost(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mock := &mockSubscriptionService{
@@ -353,6 +931,73 @@ func TestHandler_GetTotalCost(t *testing.T) {
 	assert.Equal(t, "RUB", resp.Currency)
 }
 
+func TestHandler_GetTotalCost_CurrencyFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var captured *models.CostFilter
+	mock := &mockSubscriptionService{
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error) {
+			captured = filter
+			return &models.TotalCostResponse{TotalCost: 45, Currency: "USD"}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost", h.GetTotalCost)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=03-2025&currency=USD", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, captured)
+	assert.Equal(t, "USD", captured.Currency)
+}
+
+func TestHandler_GetTotalCost_TargetCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var captured *models.CostFilter
+	mock := &mockSubscriptionService{
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error) {
+			captured = filter
+			return &models.TotalCostResponse{
+				TotalCost:    1300,
+				Currency:     "RUB",
+				MissingRates: []models.MissingRate{{Month: "02-2025", Currency: "USD", Amount: 10}},
+			}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost", h.GetTotalCost)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=02-2025&target_currency=RUB", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, captured)
+	assert.Equal(t, "RUB", captured.TargetCurrency)
+	var resp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Len(t, resp.MissingRates, 1)
+}
+
+func TestHandler_GetTotalCost_InvalidCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithMock(&mockSubscriptionService{})
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost", h.GetTotalCost)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=03-2025&currency=dollars", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
 func TestHandler_GetTotalCost_MissingParams(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	h := handlerWithMock(&mockSubscriptionService{})
@@ -380,3 +1025,158 @@ func TestHandler_GetTotalCost_InvalidDate(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
+
+func TestHandler_GetTotalCost_DailyProration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var captured *models.CostFilter
+	mock := &mockSubscriptionService{
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error) {
+			captured = filter
+			return &models.TotalCostResponse{TotalCost: 955, Currency: "RUB"}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost", h.GetTotalCost)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=2025-01-15&end_date=03-2025&proration=daily", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, captured)
+	assert.Equal(t, models.ProrationDaily, captured.Proration)
+	assert.Equal(t, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), captured.StartDate)
+	assert.Equal(t, time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC), captured.EndDate)
+}
+
+func TestHandler_GetTotalCost_InvalidProration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithMock(&mockSubscriptionService{})
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost", h.GetTotalCost)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=12-2025&proration=hourly", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_GetCostBreakdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var captured *models.CostFilter
+	mock := &mockSubscriptionService{
+		getBreakdownFn: func(ctx context.Context, filter *models.CostFilter) (*models.CostBreakdownResponse, error) {
+			captured = filter
+			return &models.CostBreakdownResponse{
+				GroupBy: filter.GroupBy,
+				Months: []models.CostBreakdownMonth{
+					{Month: "01-2025", Items: []models.CostBreakdownItem{{Key: "Netflix", Currency: "USD", TotalCost: 10}}},
+					{Month: "02-2025", Items: []models.CostBreakdownItem{}},
+				},
+			}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost/breakdown", h.GetCostBreakdown)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost/breakdown?start_date=01-2025&end_date=02-2025&group_by=service_name", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, captured)
+	assert.Equal(t, models.CostGroupByServiceName, captured.GroupBy)
+	var resp models.CostBreakdownResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Len(t, resp.Months, 2)
+}
+
+func TestHandler_GetCostBreakdown_InvalidGroupBy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithMock(&mockSubscriptionService{})
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost/breakdown", h.GetCostBreakdown)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost/breakdown?start_date=01-2025&end_date=02-2025&group_by=price", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_Cost_InvertedPeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithMock(&mockSubscriptionService{})
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost", h.GetTotalCost)
+	router.GET("/api/v1/subscriptions/cost/breakdown", h.GetCostBreakdown)
+
+	for _, path := range []string{"/api/v1/subscriptions/cost", "/api/v1/subscriptions/cost/breakdown"} {
+		req := httptest.NewRequest(http.MethodGet, path+"?start_date=03-2025&end_date=01-2025", nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+		assert.Equal(t, "start_date", decodeProblem(t, rec).Errors[0].Field, path)
+	}
+}
+
+func TestHandler_GetTotalCost_GroupByTop(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var captured *models.CostFilter
+	mock := &mockSubscriptionService{
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error) {
+			captured = filter
+			return &models.TotalCostResponse{
+				TotalCost: 4800,
+				Currency:  "RUB",
+				Groups:    []models.CostGroup{{Key: "Yandex Plus", Currency: "RUB", TotalCost: 4800, Months: 12, SubscriptionCount: 1, Rank: 1}},
+			}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost", h.GetTotalCost)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=12-2025&group_by=user_id&top=3", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, captured)
+	assert.Equal(t, models.CostGroupByUserID, captured.GroupBy)
+	assert.Equal(t, 3, captured.Top)
+	var resp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Len(t, resp.Groups, 1)
+}
+
+func TestHandler_GetTotalCost_InvalidGrouping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlerWithMock(&mockSubscriptionService{})
+	router := gin.New()
+	router.GET("/api/v1/subscriptions/cost", h.GetTotalCost)
+
+	for _, query := range []string{
+		"group_by=price",
+		"top=5",
+		"group_by=user_id&top=0",
+		"group_by=user_id&target_currency=RUB",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=12-2025&"+query, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
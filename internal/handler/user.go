@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// GetUserOverlaps возвращает пересечения подписок пользователя
+// @Summary Пересекающиеся подписки пользователя
+// @Description Пары действующих подписок пользователя на один сервис (с учетом псевдонимов каталога), периоды которых пересекаются.
+// @Description Такие подписки дважды учитываются в отчетах по стоимости. overlap_end нет, если обе подписки бессрочные
+// @Tags users
+// @Produce json
+// @Param id path string true "ID пользователя (UUID)"
+// @Success 200 {array} models.SubscriptionOverlap
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /users/{id}/overlaps [get]
+func (h *Handler) GetUserOverlaps(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid user ID")
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	overlaps, err := h.services.Subscription.GetOverlaps(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, overlaps)
+}
+
+// GetUserSubscriptions возвращает подписки пользователя
+// @Summary Подписки пользователя
+// @Description Список подписок пользователя из пути: фильтры, сортировка и пагинация — как у GET /subscriptions, кроме user_id
+// @Tags users
+// @Produce json
+// @Param id path string true "ID пользователя (UUID)"
+// @Param service_id query string false "ID сервиса каталога (UUID)"
+// @Param service_name query string false "Название сервиса"
+// @Param service_name_match query string false "contains — подстрока без учета регистра, exact — сервис с этим названием или псевдонимом" Enums(contains, exact) default(contains)
+// @Param price_min query int false "Минимальная цена"
+// @Param price_max query int false "Максимальная цена"
+// @Param active_at query string false "Активна на дату (YYYY-MM-DD или MM-YYYY)"
+// @Param start_from query string false "Начало не раньше (YYYY-MM-DD или MM-YYYY)"
+// @Param start_to query string false "Начало не позже (YYYY-MM-DD или MM-YYYY)"
+// @Param end_from query string false "Окончание не раньше (YYYY-MM-DD или MM-YYYY)"
+// @Param end_to query string false "Окончание не позже (YYYY-MM-DD или MM-YYYY)"
+// @Param has_end_date query bool false "true — только с датой окончания, false — только бессрочные"
+// @Param sort query string false "Сортировка, например -price или start_date" default(-created_at)
+// @Param deleted query bool false "true — подписки в корзине"
+// @Param limit query int false "Лимит записей" default(20)
+// @Param cursor query string false "next_cursor предыдущей страницы"
+// @Param offset query int false "Смещение (устаревший режим)" default(0)
+// @Success 200 {object} models.SubscriptionPage
+// @Header 200 {integer} X-Total-Count "Число подписок под фильтром"
+// @Header 200 {string} Link "Ссылки на первую и следующую страницу"
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /users/{id}/subscriptions [get]
+func (h *Handler) GetUserSubscriptions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid user ID")
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	// Пользователь задан путем, второй фильтр по user_id сделал бы ответ неоднозначным
+	if _, ok := c.GetQuery("user_id"); ok {
+		invalidParam(c, "user_id", "is taken from the path")
+		return
+	}
+
+	filter, ok := parseSubscriptionFilter(c)
+	if !ok {
+		return
+	}
+	filter.UserID = &userID
+
+	page, err := h.services.Subscription.GetAll(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	setPageHeaders(c, page.Total, page.NextCursor)
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUserSummary возвращает сводку по подпискам пользователя
+// @Summary Сводка по подпискам пользователя
+// @Description Число действующих сегодня подписок, списания текущего месяца и за все время (по валютам, как в /subscriptions/cost)
+// @Description и ближайшее будущее списание каждой подписки. API-ключу нужны скоупы subscriptions:read и cost:read
+// @Tags users
+// @Produce json
+// @Param id path string true "ID пользователя (UUID)"
+// @Success 200 {object} models.UserSummary
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /users/{id}/summary [get]
+func (h *Handler) GetUserSummary(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Warn().Err(err).Str("id", c.Param("id")).Msg("Invalid user ID")
+		invalidParam(c, "id", "must be a UUID")
+		return
+	}
+
+	summary, err := h.services.Subscription.GetUserSummary(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
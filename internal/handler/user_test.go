@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_GetUserOverlaps(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := uuid.New()
+	mock := &mockSubscriptionService{
+		getOverlapsFn: func(ctx context.Context, id uuid.UUID) ([]models.SubscriptionOverlap, error) {
+			assert.Equal(t, userID, id)
+			return []models.SubscriptionOverlap{{
+				ServiceName:    "Okko",
+				SubscriptionID: uuid.New(),
+				OverlappingID:  uuid.New(),
+				OverlapStart:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			}}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/users/:id/overlaps", h.GetUserOverlaps)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users/"+userID.String()+"/overlaps", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var overlaps []models.SubscriptionOverlap
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &overlaps))
+	require.Len(t, overlaps, 1)
+	assert.Equal(t, "Okko", overlaps[0].ServiceName)
+	assert.NotContains(t, rec.Body.String(), "overlap_end")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users/nope/overlaps", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "id", decodeProblem(t, rec).Errors[0].Field)
+}
+
+func TestHandler_CreateSubscription_Overlap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	existing := uuid.New()
+	mock := &mockSubscriptionService{
+		createFn: func(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error) {
+			if req.ServiceName == "Okko" {
+				return nil, fmt.Errorf("%w: %s", service.ErrSubscriptionOverlap, existing)
+			}
+			return &models.Subscription{ID: uuid.New(), ServiceName: req.ServiceName, Overlaps: []uuid.UUID{existing}}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.POST("/api/v1/subscriptions", h.CreateSubscription)
+
+	create := func(name string) *httptest.ResponseRecorder {
+		body := `{"service_name":"` + name + `","price":400,"user_id":"` + uuid.New().String() + `","start_date":"01-2025"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// reject — 409 с ID пересекающейся подписки
+	rec := create("Okko")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, "subscription_overlap", problem.Code)
+	assert.Contains(t, problem.Detail, existing.String())
+
+	// warn — подписка создана, пересечения в ответе
+	rec = create("Netflix")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var sub models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sub))
+	assert.Equal(t, []uuid.UUID{existing}, sub.Overlaps)
+}
+
+func TestHandler_GetUserSubscriptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := uuid.New()
+	var got *models.SubscriptionFilter
+	mock := &mockSubscriptionService{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+			got = filter
+			return &models.SubscriptionPage{Items: []models.Subscription{{UserID: userID}}, Total: 1}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/users/:id/subscriptions", h.GetUserSubscriptions)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users/"+userID.String()+"/subscriptions?sort=price&limit=5", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Total-Count"))
+	require.NotNil(t, got)
+	assert.Equal(t, &userID, got.UserID)
+	assert.Equal(t, "price", got.Sort)
+	assert.Equal(t, 5, got.Limit)
+
+	// Пользователь задается только путем
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users/"+userID.String()+"/subscriptions?user_id="+uuid.New().String(), nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "user_id", decodeProblem(t, rec).Errors[0].Field)
+}
+
+func TestHandler_GetUserSummary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := uuid.New()
+	mock := &mockSubscriptionService{
+		getSummaryFn: func(ctx context.Context, id uuid.UUID) (*models.UserSummary, error) {
+			return &models.UserSummary{
+				UserID:            id,
+				ActiveCount:       2,
+				CurrentMonthSpend: []models.CurrencyCost{{Currency: "RUB", TotalCost: 700}},
+				LifetimeSpend:     []models.CurrencyCost{{Currency: "RUB", TotalCost: 8400}},
+				NextRenewals:      []models.UpcomingCharge{},
+			}, nil
+		},
+	}
+	h := handlerWithMock(mock)
+	router := gin.New()
+	router.GET("/api/v1/users/:id/summary", h.GetUserSummary)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users/"+userID.String()+"/summary", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var summary models.UserSummary
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.Equal(t, userID, summary.UserID)
+	assert.Equal(t, 2, summary.ActiveCount)
+	assert.Equal(t, 8400, summary.LifetimeSpend[0].TotalCost)
+	assert.Contains(t, rec.Body.String(), `"next_renewals":[]`)
+}
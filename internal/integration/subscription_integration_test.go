@@ -4,17 +4,27 @@ package integration
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"em_tz_anvar/internal/auth"
+	"em_tz_anvar/internal/config"
 	"em_tz_anvar/internal/handler"
 	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/policy"
 	"em_tz_anvar/internal/repository"
 	"em_tz_anvar/internal/service"
 
@@ -27,7 +37,11 @@ import (
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 )
 
-var testRouter *gin.Engine
+var (
+	testRouter   *gin.Engine
+	testHandler  *handler.Handler
+	testServices *service.Service
+)
 
 func TestMain(m *testing.M) {
 	ctx := context.Background()
@@ -59,10 +73,10 @@ func TestMain(m *testing.M) {
 		panic("failed to run migrations: " + err.Error())
 	}
 
-	repos := repository.NewRepository(db)
-	services := service.NewService(repos)
-	handlers := handler.NewHandler(services)
-	testRouter = setupRouter(handlers)
+	repos := repository.NewRepository(db, service.BuildCharges)
+	testServices = policy.Wrap(service.NewService(repos, &config.ValidationConfig{MaxPrice: 1000000, MaxStartMonthsAhead: 12, OverlapMode: config.OverlapWarn}), repos.Subscription)
+	testHandler = handler.NewHandler(testServices, nil, nil)
+	testRouter = setupRouter(testHandler)
 
 	os.Exit(m.Run())
 }
@@ -96,18 +110,26 @@ func startPostgres(ctx context.Context) (*postgres.PostgresContainer, string, er
 }
 
 func runMigrations(db *sqlx.DB) error {
-	// Находим migrations относительно корня модуля
+	// Находим migrations относительно корня модуля и применяем все *.up.sql по порядку
 	workDir, _ := os.Getwd()
 	for i := 0; i < 5; i++ {
-		upPath := filepath.Join(workDir, "migrations", "000001_init.up.sql")
-		if _, err := os.Stat(upPath); err == nil {
-			data, err := os.ReadFile(upPath)
-			if err != nil {
-				return err
-			}
-			_, err = db.Exec(string(data))
+		files, err := filepath.Glob(filepath.Join(workDir, "migrations", "*.up.sql"))
+		if err != nil {
 			return err
 		}
+		if len(files) > 0 {
+			sort.Strings(files)
+			for _, f := range files {
+				data, err := os.ReadFile(f)
+				if err != nil {
+					return err
+				}
+				if _, err := db.Exec(string(data)); err != nil {
+					return fmt.Errorf("%s: %w", filepath.Base(f), err)
+				}
+			}
+			return nil
+		}
 		workDir = filepath.Dir(workDir)
 	}
 	return nil
@@ -117,16 +139,62 @@ func runMigrations(db *sqlx.DB) error {
 func setupRouter(h *handler.Handler) *gin.Engine {
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.Use(handler.RequestIDMiddleware())
 	api := router.Group("/api/v1")
+	api.Use(handler.AuthMiddleware(nil, testServices.APIKey))
 	{
+		read := handler.RequireScope(models.ScopeSubscriptionsRead)
+		write := handler.RequireScope(models.ScopeSubscriptionsWrite)
+		cost := handler.RequireScope(models.ScopeCostRead)
+		audit := handler.RequireScope(models.ScopeAuditRead)
+
 		subs := api.Group("/subscriptions")
 		{
-			subs.POST("", h.CreateSubscription)
-			subs.GET("", h.GetAllSubscriptions)
-			subs.GET("/cost", h.GetTotalCost)
-			subs.GET("/:id", h.GetSubscription)
-			subs.PUT("/:id", h.UpdateSubscription)
-			subs.DELETE("/:id", h.DeleteSubscription)
+			subs.POST("", write, handler.IdempotencyMiddleware(testServices.Idempotency), h.CreateSubscription)
+			subs.GET("", read, h.GetAllSubscriptions)
+			subs.GET("/cost", cost, h.GetTotalCost)
+			subs.GET("/cost/breakdown", cost, h.GetCostBreakdown)
+			subs.GET("/:id", read, h.GetSubscription)
+			subs.PUT("/:id", write, h.UpdateSubscription)
+			subs.PATCH("/:id", write, h.PatchSubscription)
+			subs.DELETE("/:id", write, h.DeleteSubscription)
+			subs.GET("/:id/charges", read, h.GetSubscriptionCharges)
+			subs.POST("/:id/restore", write, h.RestoreSubscription)
+			subs.DELETE("/:id/purge", write, h.PurgeSubscription)
+			subs.GET("/:id/history", audit, h.GetSubscriptionHistory)
+		}
+
+		users := api.Group("/users")
+		{
+			users.GET("/:id/subscriptions", read, h.GetUserSubscriptions)
+			users.GET("/:id/summary", read, cost, h.GetUserSummary)
+			users.GET("/:id/overlaps", read, h.GetUserOverlaps)
+		}
+
+		services := api.Group("/services")
+		{
+			services.GET("", read, h.GetServices)
+			services.POST("", handler.RequireScope(models.ScopeServicesWrite), h.CreateService)
+			services.GET("/:id", read, h.GetService)
+			services.PUT("/:id", handler.RequireScope(models.ScopeServicesWrite), h.UpdateService)
+			services.DELETE("/:id", handler.RequireScope(models.ScopeServicesWrite), h.DeleteService)
+		}
+
+		api.GET("/audit", audit, h.GetAuditLog)
+
+		rates := api.Group("/exchange-rates")
+		{
+			rates.GET("", handler.RequireScope(models.ScopeRatesRead), h.GetExchangeRates)
+			rates.POST("", handler.RequireScope(models.ScopeRatesWrite), h.CreateExchangeRates)
+			rates.POST("/import", handler.RequireScope(models.ScopeRatesWrite), h.ImportExchangeRates)
+		}
+
+		keys := api.Group("/api-keys")
+		{
+			keys.GET("", h.GetAPIKeys)
+			keys.POST("", h.CreateAPIKey)
+			keys.DELETE("/:id", h.RevokeAPIKey)
+			keys.POST("/:id/rotate", h.RotateAPIKey)
 		}
 	}
 	router.GET("/health", func(c *gin.Context) {
@@ -164,6 +232,7 @@ func TestIntegration_CRUD_Flow(t *testing.T) {
 	assert.NotEqual(t, uuid.Nil, created.ID)
 	assert.Equal(t, "Yandex Plus", created.ServiceName)
 	assert.Equal(t, 400, created.Price)
+	assert.Equal(t, "RUB", created.Currency)
 	subscriptionID := created.ID.String()
 
 	// GetByID
@@ -181,12 +250,12 @@ func TestIntegration_CRUD_Flow(t *testing.T) {
 	rec = httptest.NewRecorder()
 	testRouter.ServeHTTP(rec, req)
 	require.Equal(t, http.StatusOK, rec.Code)
-	var list []models.Subscription
+	var list models.SubscriptionPage
 	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
-	assert.GreaterOrEqual(t, len(list), 1)
+	assert.GreaterOrEqual(t, len(list.Items), 1)
 
-	// Update
-	updateBody := `{"service_name": "Yandex Plus Updated", "price": 500}`
+	// Update (полная замена: end_date не передан — подписка становится бессрочной)
+	updateBody := `{"service_name": "Yandex Plus Updated", "price": 500, "start_date": "01-2025"}`
 	req = httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/"+subscriptionID, strings.NewReader(updateBody))
 	req.Header.Set("Content-Type", "application/json")
 	rec = httptest.NewRecorder()
@@ -196,6 +265,7 @@ func TestIntegration_CRUD_Flow(t *testing.T) {
 	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &updated))
 	assert.Equal(t, "Yandex Plus Updated", updated.ServiceName)
 	assert.Equal(t, 500, updated.Price)
+	assert.Nil(t, updated.EndDate)
 
 	// GetTotalCost
 	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=12-2025&user_id="+userID, nil)
@@ -220,6 +290,1013 @@ func TestIntegration_CRUD_Flow(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
 
+func TestIntegration_ProblemResponses(t *testing.T) {
+	do := func(method, target, body string) handler.Problem {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+		assert.NotEmpty(t, rec.Header().Get("X-Request-ID"))
+		var problem handler.Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem), rec.Body.String())
+		assert.Equal(t, rec.Code, problem.Status)
+		assert.Equal(t, rec.Header().Get("X-Request-ID"), problem.RequestID)
+		return problem
+	}
+
+	// Некорректная дата при создании — 400 с полем, а не 500
+	problem := do(http.MethodPost, "/api/v1/subscriptions",
+		`{"service_name":"Okko","price":100,"user_id":"`+uuid.New().String()+`","start_date":"13-2025"}`)
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, "invalid_date", problem.Code)
+	require.Len(t, problem.Errors, 1)
+	assert.Equal(t, "start_date", problem.Errors[0].Field)
+
+	problem = do(http.MethodPost, "/api/v1/subscriptions", `{"price":-5}`)
+	assert.Equal(t, "validation_failed", problem.Code)
+	assert.NotEmpty(t, problem.Errors)
+
+	problem = do(http.MethodGet, "/api/v1/subscriptions/"+uuid.New().String(), "")
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, "not_found", problem.Code)
+
+	// Доменные правила — 422 со всеми нарушениями сразу
+	problem = do(http.MethodPost, "/api/v1/subscriptions",
+		`{"service_name":"  ","price":2000000,"user_id":"`+uuid.New().String()+`","start_date":"03-2025","end_date":"01-2025"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, problem.Status)
+	assert.Equal(t, "constraint_violation", problem.Code)
+	fields := make([]string, 0, len(problem.Errors))
+	for _, f := range problem.Errors {
+		fields = append(fields, f.Field)
+	}
+	assert.ElementsMatch(t, []string{"service_name", "end_date", "price"}, fields)
+}
+
+func TestIntegration_GetCost_PerCurrency(t *testing.T) {
+	userID := uuid.New().String()
+	for _, body := range []string{
+		`{"service_name":"Yandex Plus","price":400,"user_id":"` + userID + `","start_date":"01-2025","end_date":"03-2025"}`,
+		`{"service_name":"Netflix","price":15,"currency":"USD","user_id":"` + userID + `","start_date":"01-2025","end_date":"02-2025"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=12-2025&user_id="+userID, nil)
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var costResp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+	assert.Empty(t, costResp.Currency)
+	assert.Equal(t, []models.CurrencyCost{
+		{Currency: "RUB", TotalCost: 1200},
+		{Currency: "USD", TotalCost: 30},
+	}, costResp.Totals)
+}
+
+func TestIntegration_GetCost_TargetCurrency(t *testing.T) {
+	userID := uuid.New().String()
+	for _, body := range []string{
+		`{"service_name":"Yandex Plus","price":400,"user_id":"` + userID + `","start_date":"01-2024","end_date":"02-2024"}`,
+		`{"service_name":"Netflix","price":10,"currency":"USD","user_id":"` + userID + `","start_date":"01-2024","end_date":"02-2024"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	}
+
+	// Курс есть только на январь
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/exchange-rates/import",
+		strings.NewReader("base_currency,quote_currency,date,rate\nUSD,RUB,2024-01-15,90\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, "import: %s", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=12-2023&end_date=02-2024&target_currency=RUB&user_id="+userID, nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var costResp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+	assert.Equal(t, "RUB", costResp.Currency)
+	// январь: 400 + 10*90, февраль: 400 + 10*90 (курс января остается последним известным)
+	assert.Equal(t, 2600, costResp.TotalCost)
+	assert.Len(t, costResp.RatesUsed, 2)
+	assert.Empty(t, costResp.MissingRates)
+}
+
+func TestIntegration_GetCostBreakdown(t *testing.T) {
+	userID := uuid.New().String()
+	for _, body := range []string{
+		`{"service_name":"Kinopoisk","price":300,"user_id":"` + userID + `","start_date":"01-2023","end_date":"01-2023"}`,
+		`{"service_name":"Spotify","price":5,"currency":"EUR","user_id":"` + userID + `","start_date":"03-2023"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost/breakdown?start_date=01-2023&end_date=03-2023&group_by=service_name&user_id="+userID, nil)
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp models.CostBreakdownResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Months, 3)
+	assert.Equal(t, []models.CostBreakdownItem{{Key: "Kinopoisk", Currency: "RUB", TotalCost: 300}}, resp.Months[0].Items)
+	assert.Empty(t, resp.Months[1].Items)
+	assert.Equal(t, []models.CostBreakdownItem{{Key: "Spotify", Currency: "EUR", TotalCost: 5}}, resp.Months[2].Items)
+}
+
+func TestIntegration_GetCost_TopServices(t *testing.T) {
+	userID := uuid.New().String()
+	for _, body := range []string{
+		`{"service_name":"Ivi","price":200,"user_id":"` + userID + `","start_date":"01-2022","end_date":"06-2022"}`,
+		`{"service_name":"Okko","price":500,"user_id":"` + userID + `","start_date":"01-2022","end_date":"03-2022"}`,
+		`{"service_name":"Okko","price":500,"user_id":"` + userID + `","start_date":"10-2022"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2022&end_date=12-2022&group_by=service_name&top=1&user_id="+userID, nil)
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var costResp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+	assert.Equal(t, 1200+3000, costResp.TotalCost)
+	assert.Equal(t, []models.CostGroup{
+		{Key: "Okko", Currency: "RUB", TotalCost: 3000, Months: 6, SubscriptionCount: 2, Rank: 1},
+	}, costResp.Groups)
+}
+
+func TestIntegration_GetCost_DailyProration(t *testing.T) {
+	userID := uuid.New().String()
+	body := `{"service_name":"Wink","price":310,"user_id":"` + userID + `","start_date":"2021-01-15","end_date":"2021-03-01"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+
+	for _, tc := range []struct {
+		proration string
+		want      int
+	}{
+		// списания 15.01 и 15.02
+		{proration: "none", want: 620},
+		// цикл 15.01–14.02 целиком, из цикла 15.02–14.03 (28 дней) подписка действовала 15 дней
+		{proration: "daily", want: 310 + 166},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2021&end_date=12-2021&proration="+tc.proration+"&user_id="+userID, nil)
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var costResp models.TotalCostResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+		assert.Equal(t, tc.want, costResp.TotalCost, tc.proration)
+	}
+}
+
+func TestIntegration_GetCost_BillingPeriods(t *testing.T) {
+	userID := uuid.New().String()
+	for _, body := range []string{
+		`{"service_name":"Annual","price":1200,"billing_period":"yearly","user_id":"` + userID + `","start_date":"2019-03-10"}`,
+		`{"service_name":"Weekly","price":100,"billing_period":"weekly","user_id":"` + userID + `","start_date":"2020-06-01","end_date":"2020-06-30"}`,
+		`{"service_name":"HalfYear","price":600,"billing_period":"custom","billing_months":6,"user_id":"` + userID + `","start_date":"2020-01-31"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost/breakdown?start_date=01-2020&end_date=12-2020&group_by=service_name&user_id="+userID, nil)
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp models.CostBreakdownResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Months, 12)
+	// годовщины: годовой — 10.03, недельный — 1, 8, 15, 22 и 29 июня, полугодовой — 31.01 и 31.07
+	assert.Equal(t, []models.CostBreakdownItem{{Key: "HalfYear", Currency: "RUB", TotalCost: 600}}, resp.Months[0].Items)
+	assert.Empty(t, resp.Months[1].Items)
+	assert.Equal(t, []models.CostBreakdownItem{{Key: "Annual", Currency: "RUB", TotalCost: 1200}}, resp.Months[2].Items)
+	assert.Equal(t, []models.CostBreakdownItem{{Key: "Weekly", Currency: "RUB", TotalCost: 500}}, resp.Months[5].Items)
+	assert.Equal(t, []models.CostBreakdownItem{{Key: "HalfYear", Currency: "RUB", TotalCost: 600}}, resp.Months[6].Items)
+	assert.Empty(t, resp.Months[11].Items)
+}
+
+func TestIntegration_Charges_FollowUpdates(t *testing.T) {
+	userID := uuid.New().String()
+	body := `{"service_name":"Premier","price":300,"user_id":"` + userID + `","start_date":"2019-01-10","end_date":"2019-03-31"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	getCharges := func() []models.Charge {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/"+created.ID.String()+"/charges", nil)
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var charges []models.Charge
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &charges))
+		return charges
+	}
+
+	// 10.01, 10.02, 10.03 — последний цикл обрезан end_date
+	charges := getCharges()
+	require.Len(t, charges, 3)
+	assert.Equal(t, "2019-03-31", charges[2].PeriodEnd.Format("2006-01-02"))
+
+	req = httptest.NewRequest(http.MethodPatch, "/api/v1/subscriptions/"+created.ID.String(), strings.NewReader(`{"billing_period":"quarterly"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	charges = getCharges()
+	require.Len(t, charges, 1)
+	assert.Equal(t, 300, charges[0].Amount)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2019&end_date=12-2019&user_id="+userID, nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var costResp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+	assert.Equal(t, 300, costResp.TotalCost)
+}
+
+func TestIntegration_List_CursorPagination(t *testing.T) {
+	userID := uuid.New().String()
+	for i := 0; i < 5; i++ {
+		body := fmt.Sprintf(`{"service_name":"Page %d","price":100,"user_id":"%s","start_date":"01-2025"}`, i, userID)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	getPage := func(cursor string) models.SubscriptionPage {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?limit=2&user_id="+userID+"&cursor="+cursor, nil)
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var page models.SubscriptionPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		assert.Equal(t, strconv.Itoa(page.Total), rec.Header().Get("X-Total-Count"))
+		return page
+	}
+
+	first := getPage("")
+	require.Len(t, first.Items, 2)
+	require.NotEmpty(t, first.NextCursor)
+	assert.Equal(t, 5, first.Total)
+
+	// Новая подписка между запросами не сдвигает следующие страницы
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions",
+		strings.NewReader(`{"service_name":"Late","price":100,"user_id":"`+userID+`","start_date":"01-2025"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	seen := map[uuid.UUID]bool{}
+	for _, s := range first.Items {
+		seen[s.ID] = true
+	}
+	cursor := first.NextCursor
+	for cursor != "" {
+		page := getPage(cursor)
+		// Итог пересчитывается на каждой странице и учитывает новую подписку
+		assert.Equal(t, 6, page.Total)
+		for _, s := range page.Items {
+			assert.False(t, seen[s.ID], "duplicate %s", s.ServiceName)
+			assert.NotEqual(t, "Late", s.ServiceName)
+			seen[s.ID] = true
+		}
+		cursor = page.NextCursor
+	}
+	assert.Len(t, seen, 5)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?cursor=garbage", nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestIntegration_List_FiltersAndSort(t *testing.T) {
+	alice, bob := uuid.New().String(), uuid.New().String()
+	for _, body := range []string{
+		`{"service_name":"Yandex Plus","price":300,"user_id":"` + alice + `","start_date":"01-2025"}`,
+		`{"service_name":"Yandex Plus Multi","price":500,"user_id":"` + alice + `","start_date":"03-2025","end_date":"06-2025"}`,
+		`{"service_name":"Okko","price":200,"user_id":"` + bob + `","start_date":"02-2025"}`,
+		`{"service_name":"100%_fun","price":100,"user_id":"` + bob + `","start_date":"04-2025"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	list := func(query string) []string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?user_id="+alice+","+bob+"&"+query, nil)
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var page models.SubscriptionPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		names := []string{}
+		for _, s := range page.Items {
+			names = append(names, s.ServiceName)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"Yandex Plus Multi", "Yandex Plus", "Okko", "100%_fun"}, list("sort=-price"))
+	assert.Equal(t, []string{"100%_fun", "Okko"}, list("sort=price&price_max=200"))
+	assert.Equal(t, []string{"Yandex Plus"}, list("service_name=Yandex%20Plus&service_name_match=exact"))
+	assert.Equal(t, []string{}, list("service_name=Yandex%20Plus&service_name_match=exact&sort=price&price_min=301"))
+	assert.Equal(t, []string{"Yandex Plus", "Yandex Plus Multi"}, list("service_name=yandex&sort=start_date"))
+	assert.Equal(t, []string{"100%_fun"}, list("service_name=%25_"))
+	assert.Equal(t, []string{"Yandex Plus Multi"}, list("has_end_date=true"))
+	assert.Equal(t, []string{"Yandex Plus", "Okko"}, list("active_at=2025-07-01&start_to=02-2025&sort=start_date"))
+	assert.Equal(t, []string{"100%_fun", "Yandex Plus Multi"}, list("start_from=03-2025&sort=-start_date"))
+
+	// Курсор продолжает выдачу в выбранной сортировке
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?user_id="+alice+","+bob+"&sort=service_name&limit=3", nil)
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page models.SubscriptionPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.NotEmpty(t, page.NextCursor)
+	assert.Equal(t, []string{"Yandex Plus Multi"}, list("sort=service_name&limit=3&cursor="+page.NextCursor))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?sort=user_id", nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestIntegration_ServiceCatalog(t *testing.T) {
+	userID := uuid.New().String()
+	// Названия уникальны для теста: каталог общий для всех тестов
+	suffix := uuid.New().String()[:8]
+	latin, cyrillic := "Music "+suffix, "Музыка "+suffix
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		return rec
+	}
+	create := func(name string) models.Subscription {
+		rec := do(http.MethodPost, "/api/v1/subscriptions",
+			`{"service_name":"`+name+`","price":100,"user_id":"`+userID+`","start_date":"01-2025"}`)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		var sub models.Subscription
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sub))
+		require.NotNil(t, sub.ServiceID)
+		return sub
+	}
+
+	// Написания, отличающиеся регистром и пробелами, — один сервис
+	first := create(latin)
+	second := create("  " + strings.ToUpper(latin) + " ")
+	assert.Equal(t, first.ServiceID, second.ServiceID)
+	assert.Equal(t, latin, second.ServiceName)
+
+	// Другое название — другой сервис, пока их не слили
+	third := create(cyrillic)
+	assert.NotEqual(t, first.ServiceID, third.ServiceID)
+
+	rec := do(http.MethodDelete, "/api/v1/services/"+third.ServiceID.String(), "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = do(http.MethodDelete, "/api/v1/services/"+third.ServiceID.String()+"?merge_into="+first.ServiceID.String(), "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodGet, "/api/v1/subscriptions/"+third.ID.String(), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var merged models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &merged))
+	assert.Equal(t, first.ServiceID, merged.ServiceID)
+	assert.Equal(t, latin, merged.ServiceName)
+	assert.Equal(t, third.Version+1, merged.Version)
+
+	// Бывшее название стало псевдонимом
+	rec = do(http.MethodGet, "/api/v1/services/"+first.ServiceID.String(), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var service models.Service
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &service))
+	assert.Equal(t, []string{cyrillic}, []string(service.Aliases))
+	assert.Equal(t, first.ServiceID, create(strings.ToLower(cyrillic)).ServiceID)
+
+	// Точный фильтр находит сервис по любому его названию
+	rec = do(http.MethodGet, "/api/v1/subscriptions?user_id="+userID+"&service_name_match=exact&service_name="+url.QueryEscape(cyrillic), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page models.SubscriptionPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Equal(t, 4, page.Total)
+
+	// Название не может принадлежать двум сервисам
+	rec = do(http.MethodPost, "/api/v1/services", `{"name":"Other `+suffix+`","aliases":["`+cyrillic+`"]}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Переименование сервиса переходит в его подписки
+	renamed := "Music Pro " + suffix
+	rec = do(http.MethodPut, "/api/v1/services/"+first.ServiceID.String(), `{"name":"`+renamed+`","aliases":["`+latin+`","`+cyrillic+`"],"category":"music"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = do(http.MethodGet, "/api/v1/subscriptions/"+first.ID.String(), "")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &merged))
+	assert.Equal(t, renamed, merged.ServiceName)
+
+	rec = do(http.MethodGet, "/api/v1/services?category=music&q="+url.QueryEscape(strings.ToUpper(cyrillic)), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var services []models.Service
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &services))
+	require.Len(t, services, 1)
+	assert.Equal(t, renamed, services[0].Name)
+}
+
+func TestIntegration_Overlaps(t *testing.T) {
+	userID := uuid.New().String()
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		return rec
+	}
+	create := func(name, start, end string) models.Subscription {
+		body := `{"service_name":"` + name + `","price":100,"user_id":"` + userID + `","start_date":"` + start + `"`
+		if end != "" {
+			body += `,"end_date":"` + end + `"`
+		}
+		rec := do(http.MethodPost, "/api/v1/subscriptions", body+"}")
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		var sub models.Subscription
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sub))
+		return sub
+	}
+
+	first := create("Okko", "01-2025", "06-2025")
+	assert.Empty(t, first.Overlaps)
+
+	// Пересечение ищется по сервису каталога, а не по написанию названия
+	second := create(" okko ", "03-2025", "")
+	assert.Equal(t, []uuid.UUID{first.ID}, second.Overlaps)
+
+	third := create("Okko", "07-2025", "08-2025")
+	assert.Equal(t, []uuid.UUID{second.ID}, third.Overlaps)
+
+	// Другой сервис и соседние периоды не пересекаются
+	assert.Empty(t, create("Netflix", "01-2025", "").Overlaps)
+
+	rec := do(http.MethodGet, "/api/v1/users/"+userID+"/overlaps", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var overlaps []models.SubscriptionOverlap
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &overlaps))
+	require.Len(t, overlaps, 2)
+	assert.Equal(t, first.ID, overlaps[0].SubscriptionID)
+	assert.Equal(t, second.ID, overlaps[0].OverlappingID)
+	assert.Equal(t, "2025-03-01", overlaps[0].OverlapStart.Format("2006-01-02"))
+	require.NotNil(t, overlaps[0].OverlapEnd)
+	assert.Equal(t, "2025-06-30", overlaps[0].OverlapEnd.Format("2006-01-02"))
+	assert.Equal(t, second.ID, overlaps[1].SubscriptionID)
+	assert.Equal(t, third.ID, overlaps[1].OverlappingID)
+
+	// Сокращенная подписка больше не пересекается, удаленная в корзину не учитывается
+	rec = do(http.MethodPatch, "/api/v1/subscriptions/"+first.ID.String(), `{"end_date":"02-2025"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var patched models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &patched))
+	assert.Empty(t, patched.Overlaps)
+
+	rec = do(http.MethodDelete, "/api/v1/subscriptions/"+third.ID.String(), "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do(http.MethodGet, "/api/v1/users/"+userID+"/overlaps", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+}
+
+func TestIntegration_UserEndpoints(t *testing.T) {
+	userID, otherID := uuid.New().String(), uuid.New().String()
+	thisMonth := time.Now().UTC()
+	thisMonth = time.Date(thisMonth.Year(), thisMonth.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		return rec
+	}
+	create := func(user, name string, price int, start time.Time) models.Subscription {
+		rec := do(http.MethodPost, "/api/v1/subscriptions",
+			fmt.Sprintf(`{"service_name":%q,"price":%d,"user_id":%q,"start_date":%q}`, name, price, user, start.Format("2006-01-02")))
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		var sub models.Subscription
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sub))
+		return sub
+	}
+
+	// Месячная подписка с начала месяца три месяца назад: четыре списания по сегодня
+	okko := create(userID, "Okko", 100, thisMonth.AddDate(0, -3, 0))
+	removed := create(userID, "Netflix", 500, thisMonth.AddDate(0, -1, 0))
+	create(otherID, "Okko", 999, thisMonth.AddDate(0, -3, 0))
+	require.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/v1/subscriptions/"+removed.ID.String(), "").Code)
+
+	rec := do(http.MethodGet, "/api/v1/users/"+userID+"/subscriptions", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var page models.SubscriptionPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, okko.ID, page.Items[0].ID)
+
+	rec = do(http.MethodGet, "/api/v1/users/"+userID+"/summary", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var summary models.UserSummary
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.Equal(t, 1, summary.ActiveCount)
+	assert.Equal(t, []models.CurrencyCost{{Currency: "RUB", TotalCost: 100}}, summary.CurrentMonthSpend)
+	assert.Equal(t, []models.CurrencyCost{{Currency: "RUB", TotalCost: 400}}, summary.LifetimeSpend)
+	require.Len(t, summary.NextRenewals, 1)
+	assert.Equal(t, okko.ID, summary.NextRenewals[0].SubscriptionID)
+	assert.Equal(t, thisMonth.AddDate(0, 1, 0).Format("2006-01-02"), summary.NextRenewals[0].Date.Format("2006-01-02"))
+
+	// Пользователь без подписок получает пустую сводку, а не 404
+	rec = do(http.MethodGet, "/api/v1/users/"+uuid.New().String()+"/summary", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.Zero(t, summary.ActiveCount)
+	assert.Empty(t, summary.LifetimeSpend)
+}
+
+func TestIntegration_Patch_ClearsEndDate(t *testing.T) {
+	userID := uuid.New().String()
+	body := `{"service_name":"Kion","price":200,"currency":"USD","user_id":"` + userID + `","start_date":"01-2016","end_date":"03-2016"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.NotNil(t, created.EndDate)
+
+	// null снимает end_date, остальные поля не меняются
+	req = httptest.NewRequest(http.MethodPatch, "/api/v1/subscriptions/"+created.ID.String(), strings.NewReader(`{"end_date":null}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var patched models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &patched))
+	assert.Nil(t, patched.EndDate)
+	assert.Equal(t, "Kion", patched.ServiceName)
+	assert.Equal(t, "USD", patched.Currency)
+
+	got, err := testServices.Subscription.GetByID(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.EndDate)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2016&end_date=12-2016&user_id="+userID, nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var costResp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+	assert.Equal(t, 12*200, costResp.TotalCost)
+}
+
+func TestIntegration_PriceChange_KeepsPastCost(t *testing.T) {
+	userID := uuid.New().String()
+	body := `{"service_name":"Start","price":400,"user_id":"` + userID + `","start_date":"01-2018","end_date":"12-2018"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	req = httptest.NewRequest(http.MethodPatch, "/api/v1/subscriptions/"+created.ID.String(),
+		strings.NewReader(`{"price":500,"price_effective_from":"07-2018"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2018&end_date=12-2018&user_id="+userID, nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var costResp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+	// январь–июнь по старой цене, июль–декабрь по новой
+	assert.Equal(t, 6*400+6*500, costResp.TotalCost)
+}
+
+func TestIntegration_SoftDelete_RestoreAndPurge(t *testing.T) {
+	userID := uuid.New().String()
+	body := `{"service_name":"Wink","price":250,"user_id":"` + userID + `","start_date":"01-2017","end_date":"12-2017"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	subURL := "/api/v1/subscriptions/" + created.ID.String()
+
+	getCost := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2017&end_date=12-2017&user_id="+userID, nil)
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var costResp models.TotalCostResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+		return costResp.TotalCost
+	}
+	listIDs := func(query string) []uuid.UUID {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?user_id="+userID+query, nil)
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var list models.SubscriptionPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+		ids := make([]uuid.UUID, 0, len(list.Items))
+		for _, s := range list.Items {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, 12*250, getCost())
+
+	// Удаление из корзины невозможно, пока подписка активна
+	req = httptest.NewRequest(http.MethodDelete, subURL+"/purge", nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, subURL, nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, subURL, nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, 0, getCost())
+	assert.Empty(t, listIDs(""))
+	assert.Equal(t, []uuid.UUID{created.ID}, listIDs("&deleted=true"))
+
+	req = httptest.NewRequest(http.MethodPost, subURL+"/restore", nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, 12*250, getCost())
+	assert.Equal(t, []uuid.UUID{created.ID}, listIDs(""))
+
+	req = httptest.NewRequest(http.MethodDelete, subURL, nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, subURL+"/purge", nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, listIDs("&deleted=true"))
+
+	req = httptest.NewRequest(http.MethodPost, subURL+"/restore", nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestIntegration_AuditLog(t *testing.T) {
+	actor := "auditor-" + uuid.NewString()
+	body := `{"service_name":"Okko","price":300,"user_id":"` + uuid.New().String() + `","start_date":"01-2025"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", actor)
+	req.Header.Set("X-Request-ID", "req-create")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, "create: %s", rec.Body.String())
+	assert.Equal(t, "req-create", rec.Header().Get("X-Request-ID"))
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	subURL := "/api/v1/subscriptions/" + created.ID.String()
+
+	req = httptest.NewRequest(http.MethodPatch, subURL, strings.NewReader(`{"price":350}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", actor)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodDelete, subURL, nil)
+	req.Header.Set("X-Actor", actor)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	// История доступна и для удаленной подписки
+	req = httptest.NewRequest(http.MethodGet, subURL+"/history", nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var history []models.AuditEntry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &history))
+	require.Len(t, history, 3)
+	assert.Equal(t, models.AuditDelete, history[0].Action)
+	assert.Equal(t, models.AuditUpdate, history[1].Action)
+	assert.Equal(t, models.AuditCreate, history[2].Action)
+	assert.Equal(t, "req-create", history[2].RequestID)
+	assert.JSONEq(t, `null`, string(history[2].Before))
+
+	var before, after models.Subscription
+	require.NoError(t, json.Unmarshal(history[1].Before, &before))
+	require.NoError(t, json.Unmarshal(history[1].After, &after))
+	assert.Equal(t, 300, before.Price)
+	assert.Equal(t, 350, after.Price)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/audit?action=update&actor="+actor, nil)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var entries []models.AuditEntry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, created.ID, entries[0].SubscriptionID)
+}
+
+// bearerToken HS256-токен пользователя userID с ролями roles, подписанный secret
+func bearerToken(t *testing.T, secret string, userID uuid.UUID, roles ...string) string {
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	input := segment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." +
+		segment(map[string]interface{}{"sub": userID.String(), "roles": roles, "exp": time.Now().Add(time.Hour).Unix()})
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return "Bearer " + input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestIntegration_Auth_ScopesToCaller(t *testing.T) {
+	const secret = "integration-secret"
+	verifier, err := auth.NewVerifier(&config.AuthConfig{HS256Secret: secret, AdminRole: "admin", AnalystRole: "analyst"})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(handler.RequestIDMiddleware())
+	api := router.Group("/api/v1", handler.AuthMiddleware(verifier, testServices.APIKey))
+	api.POST("/subscriptions", testHandler.CreateSubscription)
+	api.GET("/subscriptions", testHandler.GetAllSubscriptions)
+	api.GET("/subscriptions/cost", testHandler.GetTotalCost)
+	api.GET("/subscriptions/:id", testHandler.GetSubscription)
+	api.DELETE("/subscriptions/:id", testHandler.DeleteSubscription)
+	api.POST("/exchange-rates", testHandler.CreateExchangeRates)
+
+	alice, bob := uuid.New(), uuid.New()
+	do := func(method, url, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/api/v1/subscriptions", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	aliceToken, bobToken := bearerToken(t, secret, alice), bearerToken(t, secret, bob)
+	rec = do(http.MethodPost, "/api/v1/subscriptions", aliceToken,
+		`{"service_name":"Ivi","price":200,"user_id":"`+alice.String()+`","start_date":"01-2016","end_date":"12-2016"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	// Подписку для другого пользователя создать нельзя
+	rec = do(http.MethodPost, "/api/v1/subscriptions", bobToken,
+		`{"service_name":"Ivi","price":200,"user_id":"`+alice.String()+`","start_date":"01-2016"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Чужая подписка для bob не существует
+	rec = do(http.MethodGet, "/api/v1/subscriptions/"+created.ID.String(), bobToken, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = do(http.MethodDelete, "/api/v1/subscriptions/"+created.ID.String(), bobToken, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = do(http.MethodGet, "/api/v1/subscriptions", bobToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list models.SubscriptionPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Empty(t, list.Items)
+
+	rec = do(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2016&end_date=12-2016&user_id="+alice.String(), bobToken, "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Без user_id отчет считается только по своим подпискам
+	rec = do(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2016&end_date=12-2016", aliceToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var costResp models.TotalCostResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+	assert.Equal(t, 12*200, costResp.TotalCost)
+
+	// Аналитик считает отчеты по любому пользователю, но ничего не меняет
+	analystToken := bearerToken(t, secret, uuid.New(), "analyst")
+	rec = do(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2016&end_date=12-2016&user_id="+alice.String(), analystToken, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &costResp))
+	assert.Equal(t, 12*200, costResp.TotalCost)
+	rec = do(http.MethodDelete, "/api/v1/subscriptions/"+created.ID.String(), analystToken, "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Курсы меняет только админ
+	rec = do(http.MethodPost, "/api/v1/exchange-rates", aliceToken, `[{"base_currency":"USD","quote_currency":"RUB","date":"2016-01-01","rate":75}]`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Админ удаляет чужую подписку
+	rec = do(http.MethodDelete, "/api/v1/subscriptions/"+created.ID.String(), bearerToken(t, secret, uuid.New(), "admin"), "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestIntegration_APIKeys_Scopes(t *testing.T) {
+	do := func(method, url, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/v1/api-keys", "", `{"name":"billing-batch","scopes":["subscriptions:read","cost:read"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created models.APIKeySecret
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Key)
+	assert.Equal(t, created.Key[:len(created.Prefix)], created.Prefix)
+
+	rec = do(http.MethodGet, "/api/v1/subscriptions?limit=1", created.Key, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = do(http.MethodGet, "/api/v1/subscriptions/cost?start_date=01-2025&end_date=12-2025", created.Key, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Нет subscriptions:write
+	rec = do(http.MethodPost, "/api/v1/subscriptions", created.Key,
+		`{"service_name":"Batch","price":100,"user_id":"`+uuid.New().String()+`","start_date":"01-2025"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Ключ не может управлять ключами
+	rec = do(http.MethodGet, "/api/v1/api-keys", created.Key, "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = do(http.MethodPost, "/api/v1/api-keys/"+created.ID.String()+"/rotate", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var rotated models.APIKeySecret
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rotated))
+	assert.NotEqual(t, created.Key, rotated.Key)
+
+	rec = do(http.MethodGet, "/api/v1/subscriptions?limit=1", created.Key, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = do(http.MethodGet, "/api/v1/subscriptions?limit=1", rotated.Key, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = do(http.MethodDelete, "/api/v1/api-keys/"+created.ID.String(), "", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = do(http.MethodGet, "/api/v1/subscriptions?limit=1", rotated.Key, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = do(http.MethodPost, "/api/v1/api-keys", "", `{"name":"bad","scopes":["everything"]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestIntegration_IdempotentCreate(t *testing.T) {
+	userID := uuid.New()
+	body := `{"service_name":"Okko","price":300,"user_id":"` + userID.String() + `","start_date":"01-2025"}`
+	do := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		return rec
+	}
+
+	key := uuid.NewString()
+	first := do(key, body)
+	require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(first.Body.Bytes(), &created))
+
+	// Повтор после таймаута не создает вторую подписку
+	replay := do(key, body)
+	require.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get("Idempotent-Replayed"))
+	var replayed models.Subscription
+	require.NoError(t, json.Unmarshal(replay.Body.Bytes(), &replayed))
+	assert.Equal(t, created.ID, replayed.ID)
+
+	subs, err := testServices.Subscription.GetAll(context.Background(), &models.SubscriptionFilter{UserID: &userID})
+	require.NoError(t, err)
+	assert.Len(t, subs.Items, 1)
+
+	rec := do(key, strings.Replace(body, "300", "400", 1))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestIntegration_OptimisticConcurrency(t *testing.T) {
+	userID := uuid.New().String()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(`{"service_name":"Wink","price":200,"user_id":"`+userID+`","start_date":"01-2025"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	path := "/api/v1/subscriptions/" + created.ID.String()
+
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	staleETag := rec.Header().Get("ETag")
+	assert.Equal(t, `"1"`, staleETag)
+
+	update := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		testRouter.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Первый клиент успевает изменить подписку, второй работает со старой версией
+	rec = update(staleETag, `{"price":250}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	freshETag := rec.Header().Get("ETag")
+	assert.Equal(t, `"2"`, freshETag)
+
+	rec = update(staleETag, `{"price":300}`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, path, nil)
+	req.Header.Set("If-Match", staleETag)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	got, err := testServices.Subscription.GetByID(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 250, got.Price)
+
+	req = httptest.NewRequest(http.MethodDelete, path, nil)
+	req.Header.Set("If-Match", freshETag)
+	rec = httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
 func TestIntegration_GetSubscription_NotFound(t *testing.T) {
 	id := uuid.New().String()
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/"+id, nil)
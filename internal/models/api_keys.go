@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Скоупы API-ключей: к какой группе маршрутов у ключа есть доступ
+const (
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+	ScopeCostRead           = "cost:read"
+	ScopeServicesWrite      = "services:write"
+	ScopeRatesRead          = "rates:read"
+	ScopeRatesWrite         = "rates:write"
+	ScopeAuditRead          = "audit:read"
+)
+
+// APIKeyScopes все допустимые скоупы
+var APIKeyScopes = []string{
+	ScopeSubscriptionsRead,
+	ScopeSubscriptionsWrite,
+	ScopeCostRead,
+	ScopeServicesWrite,
+	ScopeRatesRead,
+	ScopeRatesWrite,
+	ScopeAuditRead,
+}
+
+// APIKey ключ сервисного клиента. Сам ключ не хранится, Prefix — его начало для опознания в списке
+type APIKey struct {
+	ID         uuid.UUID      `json:"id" db:"id"`
+	Name       string         `json:"name" db:"name"`
+	Prefix     string         `json:"prefix" db:"key_prefix"`
+	KeyHash    string         `json:"-" db:"key_hash"`
+	Scopes     pq.StringArray `json:"scopes" db:"scopes" swaggertype:"array,string"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt  *time.Time     `json:"revoked_at,omitempty" db:"revoked_at"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedBy  string         `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+type CreateAPIKeyReq struct {
+	Name      string     `json:"name" binding:"required,max=255"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeySecret ответ на выпуск и ротацию: Key показывается только здесь
+type APIKeySecret struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// AuditEntry запись журнала изменений: кто, когда и как изменил подписку.
+// Before и After — снимки подписки до и после изменения (null для create и purge соответственно)
+type AuditEntry struct {
+	ID             int64           `json:"id" db:"id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id" db:"subscription_id"`
+	Action         string          `json:"action" db:"action"`
+	Actor          string          `json:"actor" db:"actor"`
+	RequestID      string          `json:"request_id,omitempty" db:"request_id"`
+	Before         json.RawMessage `json:"before" db:"before" swaggertype:"object"`
+	After          json.RawMessage `json:"after" db:"after" swaggertype:"object"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
+type AuditFilter struct {
+	SubscriptionID *uuid.UUID
+	Actor          string
+	Action         string
+	From           *time.Time
+	To             *time.Time
+	Limit          int
+	Offset         int
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Service сервис из каталога. Подписка ссылается на него по ID, а ее service_name — каноническое Name.
+// Aliases — другие написания названия, по которым подписка тоже находит этот сервис
+type Service struct {
+	ID           uuid.UUID      `json:"id" db:"id"`
+	Name         string         `json:"name" db:"name"`
+	Aliases      pq.StringArray `json:"aliases" db:"aliases" swaggertype:"array,string"`
+	Category     string         `json:"category,omitempty" db:"category"`
+	DefaultPrice *int           `json:"default_price,omitempty" db:"default_price"`
+	Currency     string         `json:"currency" db:"currency"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// ServiceReq создание и полная замена сервиса каталога
+type ServiceReq struct {
+	Name         string   `json:"name" binding:"required,max=255"`
+	Aliases      []string `json:"aliases,omitempty" binding:"omitempty,dive,max=255"`
+	Category     string   `json:"category,omitempty" binding:"omitempty,max=100"`
+	DefaultPrice *int     `json:"default_price,omitempty" binding:"omitempty,min=1"`
+	Currency     string   `json:"currency,omitempty" binding:"omitempty,iso4217"`
+}
+
+// ServiceFilter Search ищет подстроку в названии и псевдонимах без учета регистра
+type ServiceFilter struct {
+	Search   string
+	Category string
+}
+
+// ServiceKey нормализованное название сервиса: нижний регистр, пробелы по краям убраны, внутри схлопнуты.
+// Названия с одинаковым ключом — один сервис. Та же нормализация в миграции 000014
+func ServiceKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Charge начисление за один цикл списания подписки
+type Charge struct {
+	SubscriptionID uuid.UUID `json:"subscription_id" db:"subscription_id"`
+	PeriodStart    time.Time `json:"period_start" db:"period_start"`
+	PeriodEnd      time.Time `json:"period_end" db:"period_end"`
+	CycleDays      int       `json:"cycle_days" db:"cycle_days"`
+	Amount         int       `json:"amount" db:"amount"`
+	Currency       string    `json:"currency" db:"currency"`
+}
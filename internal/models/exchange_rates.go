@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// ExchangeRate курс на дату: 1 единица BaseCurrency = Rate единиц QuoteCurrency
+type ExchangeRate struct {
+	BaseCurrency  string    `json:"base_currency" db:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency" db:"quote_currency"`
+	Date          time.Time `json:"date" db:"rate_date"`
+	Rate          float64   `json:"rate" db:"rate"`
+}
+
+type CreateExchangeRateReq struct {
+	BaseCurrency  string  `json:"base_currency" binding:"required,iso4217"`
+	QuoteCurrency string  `json:"quote_currency" binding:"required,iso4217"`
+	Date          string  `json:"date" binding:"required"`
+	Rate          float64 `json:"rate" binding:"required,gt=0"`
+}
+
+type ExchangeRateFilter struct {
+	BaseCurrency  string
+	QuoteCurrency string
+	From          *time.Time
+	To            *time.Time
+}
+
+type SaveExchangeRatesResponse struct {
+	Saved int `json:"saved"`
+}
+
+// AppliedRate курс, по которому пересчитан месяц
+type AppliedRate struct {
+	Month    string  `json:"month"`
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Rate     float64 `json:"rate"`
+	RateDate string  `json:"rate_date"`
+}
+
+// MissingRate месяц, для которого не нашлось курса; сумма не вошла в итог
+type MissingRate struct {
+	Month    string `json:"month"`
+	Currency string `json:"currency"`
+	Amount   int    `json:"amount"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// IdempotencyRecord запрос с заголовком Idempotency-Key и его ответ
+type IdempotencyRecord struct {
+	Owner       string    `db:"owner"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	StatusCode  *int      `db:"status_code"` // nil — запрос еще выполняется
+	Response    []byte    `db:"response"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
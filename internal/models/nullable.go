@@ -0,0 +1,26 @@
+package models
+
+import "encoding/json"
+
+// Nullable поле merge patch, различающее три состояния: ключа нет в теле (Set == false),
+// передан null (Null == true) и передано значение Value
+type Nullable[T any] struct {
+	Value T
+	Set   bool
+	Null  bool
+}
+
+// UnmarshalJSON вызывается только для ключей, которые есть в теле, в том числе для null
+func (n *Nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &n.Value)
+}
+
+// Present передано значение, а не null
+func (n Nullable[T]) Present() bool {
+	return n.Set && !n.Null
+}
@@ -1,52 +1,265 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// DefaultCurrency валюта подписки, если она не указана явно
+const DefaultCurrency = "RUB"
+
+// Периоды списания (Subscription.BillingPeriod). Списания идут в годовщины start_date:
+// раз в неделю, месяц, квартал, год или раз в BillingMonths месяцев для custom
+const (
+	BillingWeekly    = "weekly"
+	BillingMonthly   = "monthly"
+	BillingQuarterly = "quarterly"
+	BillingYearly    = "yearly"
+	BillingCustom    = "custom"
+)
+
 type Subscription struct {
-	ID          uuid.UUID  `json:"id" db:"id"`
-	ServiceName string     `json:"service_name" db:"service_name"`
-	Price       int        `json:"price" db:"price"`
-	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
-	StartDate   time.Time  `json:"start_date" db:"start_date"`
-	EndDate     *time.Time `json:"end_date,omitempty" db:"end_date"`
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	ID            uuid.UUID  `json:"id" db:"id"`
+	ServiceName   string     `json:"service_name" db:"service_name"`
+	ServiceID     *uuid.UUID `json:"service_id,omitempty" db:"service_id"` // сервис каталога, пуст только у старых подписок без названия
+	Price         int        `json:"price" db:"price"`
+	Currency      string     `json:"currency" db:"currency"`
+	BillingPeriod string     `json:"billing_period" db:"billing_period"`
+	BillingMonths *int       `json:"billing_months,omitempty" db:"billing_months"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	StartDate     time.Time  `json:"start_date" db:"start_date"`
+	EndDate       *time.Time `json:"end_date,omitempty" db:"end_date"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Version растет при каждом изменении, из нее строится ETag
+	Version int `json:"version" db:"version"`
+
+	// PriceEffectiveFrom дата, с которой действует новая Price; заполняется при изменении цены
+	PriceEffectiveFrom *time.Time `json:"-" db:"-"`
+	// Overlaps действующие подписки пользователя на тот же сервис с пересекающимся периодом.
+	// Заполняется только в ответе на создание и изменение в режиме validation.overlap_mode: warn
+	Overlaps []uuid.UUID `json:"overlaps,omitempty" db:"-"`
+}
+
+// SubscriptionOverlap пара действующих подписок пользователя на один сервис с пересекающимися периодами.
+// OverlapEnd пуст, если обе подписки бессрочные
+type SubscriptionOverlap struct {
+	ServiceID      uuid.UUID  `json:"service_id" db:"service_id"`
+	ServiceName    string     `json:"service_name" db:"service_name"`
+	SubscriptionID uuid.UUID  `json:"subscription_id" db:"subscription_id"` // начавшаяся раньше
+	OverlappingID  uuid.UUID  `json:"overlapping_id" db:"overlapping_id"`
+	OverlapStart   time.Time  `json:"overlap_start" db:"overlap_start"`
+	OverlapEnd     *time.Time `json:"overlap_end,omitempty" db:"overlap_end"`
+}
+
+// PriceChange цена подписки, действующая с EffectiveFrom до следующего изменения
+type PriceChange struct {
+	SubscriptionID uuid.UUID `json:"subscription_id" db:"subscription_id"`
+	Price          int       `json:"price" db:"price"`
+	EffectiveFrom  time.Time `json:"effective_from" db:"effective_from"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
 
 type CreateSubscriptionReq struct {
-	ServiceName string `json:"service_name" binding:"required"`
-	Price       int    `json:"price" binding:"required,min=1"`
-	UserID      string `json:"user_id" binding:"required,uuid"`
-	StartDate   string `json:"start_date" binding:"required"`
-	EndDate     string `json:"end_date,omitempty"`
+	ServiceName   string `json:"service_name" binding:"required"`
+	Price         int    `json:"price" binding:"required,min=1"`
+	Currency      string `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	BillingPeriod string `json:"billing_period,omitempty" binding:"omitempty,oneof=weekly monthly quarterly yearly custom"`
+	BillingMonths int    `json:"billing_months,omitempty" binding:"omitempty,min=1,max=120"`
+	UserID        string `json:"user_id" binding:"required,uuid"`
+	StartDate     string `json:"start_date" binding:"required"`
+	EndDate       string `json:"end_date,omitempty"`
 }
 
+// UpdateSubscriptionReq полная замена подписки (PUT): не переданные необязательные поля
+// получают значения по умолчанию, как при создании. Владелец подписки не меняется
 type UpdateSubscriptionReq struct {
-	ServiceName string `json:"service_name,omitempty"`
-	Price       int    `json:"price,omitempty" binding:"omitempty,min=1"`
-	StartDate   string `json:"start_date,omitempty"`
-	EndDate     string `json:"end_date,omitempty"`
+	ServiceName        string `json:"service_name" binding:"required"`
+	Price              int    `json:"price" binding:"required,min=1"`
+	PriceEffectiveFrom string `json:"price_effective_from,omitempty"`
+	Currency           string `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	BillingPeriod      string `json:"billing_period,omitempty" binding:"omitempty,oneof=weekly monthly quarterly yearly custom"`
+	BillingMonths      int    `json:"billing_months,omitempty" binding:"omitempty,min=1,max=120"`
+	StartDate          string `json:"start_date" binding:"required"`
+	EndDate            string `json:"end_date,omitempty"`
+}
+
+// PatchSubscriptionReq частичное изменение (PATCH) по JSON Merge Patch, RFC 7396:
+// отсутствующее поле не меняется, null сбрасывает его (end_date — бессрочная подписка,
+// currency и billing_period — значения по умолчанию)
+type PatchSubscriptionReq struct {
+	ServiceName        Nullable[string] `json:"service_name" swaggertype:"string"`
+	Price              Nullable[int]    `json:"price" swaggertype:"integer"`
+	PriceEffectiveFrom Nullable[string] `json:"price_effective_from" swaggertype:"string"`
+	Currency           Nullable[string] `json:"currency" swaggertype:"string"`
+	BillingPeriod      Nullable[string] `json:"billing_period" swaggertype:"string"`
+	BillingMonths      Nullable[int]    `json:"billing_months" swaggertype:"integer"`
+	StartDate          Nullable[string] `json:"start_date" swaggertype:"string"`
+	EndDate            Nullable[string] `json:"end_date" swaggertype:"string"`
 }
 
 type SubscriptionFilter struct {
-	UserID      *uuid.UUID
-	ServiceName string
-	Limit       int
-	Offset      int
+	UserID           *uuid.UUID
+	UserIDs          []uuid.UUID // подписки любого из пользователей
+	ServiceID        *uuid.UUID
+	ServiceName      string
+	ServiceNameExact bool // сервис с этим названием или псевдонимом вместо поиска подстроки без учета регистра
+	PriceMin         *int
+	PriceMax         *int
+	ActiveAt         *time.Time // подписка действует в этот день
+	StartFrom        *time.Time
+	StartTo          *time.Time
+	EndFrom          *time.Time
+	EndTo            *time.Time
+	HasEndDate       *bool
+	Deleted          bool   // true — только подписки в корзине
+	Sort             string // поле сортировки из SubscriptionSortFields, "-" перед полем — по убыванию
+	Limit            int
+	Offset           int    // устаревший режим постраничного вывода, при курсоре не используется
+	Cursor           string // next_cursor предыдущей страницы
+	// After позиция, с которой продолжается выдача; сервис заполняет ее из Cursor
+	After *SubscriptionCursor
 }
 
+// Поля, по которым можно сортировать список подписок. deleted_at — только для корзины
+const (
+	SortPrice       = "price"
+	SortStartDate   = "start_date"
+	SortServiceName = "service_name"
+	SortCreatedAt   = "created_at"
+	SortDeletedAt   = "deleted_at"
+)
+
+// SortBy поле и направление сортировки. По умолчанию новые первыми: -created_at, в корзине -deleted_at
+func (f *SubscriptionFilter) SortBy() (field string, desc bool) {
+	switch {
+	case f.Sort == "" && f.Deleted:
+		return SortDeletedAt, true
+	case f.Sort == "":
+		return SortCreatedAt, true
+	case strings.HasPrefix(f.Sort, "-"):
+		return f.Sort[1:], true
+	default:
+		return f.Sort, false
+	}
+}
+
+// SubscriptionCursor позиция в списке подписок: значение поля сортировки и id последней выданной строки.
+// Sort — сортировка, для которой курсор выдан, с другой он не действителен
+type SubscriptionCursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// SubscriptionPage страница списка подписок. Total — сколько всего подписок под фильтром,
+// NextCursor пуст на последней странице
+type SubscriptionPage struct {
+	Items      []Subscription `json:"items"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// Допустимые значения CostFilter.GroupBy
+const (
+	CostGroupByServiceName = "service_name"
+	CostGroupByUserID      = "user_id"
+)
+
+// Режимы начисления (CostFilter.Proration)
+const (
+	ProrationNone  = "none"  // каждое списание в периоде учитывается полной ценой
+	ProrationDaily = "daily" // цикл учитывается пропорционально дням, попавшим в период и срок подписки
+)
+
 type CostFilter struct {
-	UserID      *uuid.UUID
-	ServiceName string
-	StartDate   time.Time
-	EndDate     time.Time
+	UserID         *uuid.UUID
+	ServiceID      *uuid.UUID
+	ServiceName    string
+	Currency       string
+	TargetCurrency string // валюта, в которую пересчитывается итог
+	GroupBy        string // разбивка стоимости по service_name или user_id
+	Top            int    // сколько первых групп вернуть по каждой валюте, 0 — все
+	Proration      string // режим начисления, по умолчанию ProrationNone
+	StartDate      time.Time
+	EndDate        time.Time
+}
+
+// UserSummary сводка по подпискам пользователя на дату AsOf. Суммы — отдельно по каждой валюте
+type UserSummary struct {
+	UserID            uuid.UUID        `json:"user_id"`
+	AsOf              time.Time        `json:"as_of"`
+	ActiveCount       int              `json:"active_count"`        // подписки, действующие в AsOf
+	CurrentMonthSpend []CurrencyCost   `json:"current_month_spend"` // списания текущего календарного месяца
+	LifetimeSpend     []CurrencyCost   `json:"lifetime_spend"`      // все списания по AsOf включительно
+	NextRenewals      []UpcomingCharge `json:"next_renewals"`       // ближайшее списание каждой подписки, по дате
+}
+
+// UpcomingCharge ближайшее будущее списание подписки
+type UpcomingCharge struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	ServiceName    string    `json:"service_name"`
+	Date           time.Time `json:"date"`
+	Amount         int       `json:"amount"`
+	Currency       string    `json:"currency"`
+}
+
+// CurrencyCost сумма подписок в одной валюте
+type CurrencyCost struct {
+	Currency  string `json:"currency" db:"currency"`
+	TotalCost int    `json:"total_cost" db:"total_cost"`
 }
 
+// TotalCostResponse итог по периоду. TotalCost и Currency заполняются,
+// если все подписки в выборке в одной валюте или запрошен пересчёт в target_currency,
+// иначе смотрите Totals
 type TotalCostResponse struct {
-	TotalCost int    `json:"total_cost"`
+	TotalCost    int            `json:"total_cost"`
+	Currency     string         `json:"currency,omitempty"`
+	Totals       []CurrencyCost `json:"totals"`
+	RatesUsed    []AppliedRate  `json:"rates_used,omitempty"`
+	MissingRates []MissingRate  `json:"missing_rates,omitempty"`
+	Groups       []CostGroup    `json:"groups,omitempty"`
+}
+
+// CostGroup строка рейтинга стоимости по сервису или пользователю.
+// Months — число оплаченных месяцев по подпискам группы (пар подписка–месяц: несколько списаний недельной
+// подписки в одном месяце считаются одним), Rank — место внутри валюты
+type CostGroup struct {
+	Key               string `json:"key" db:"group_key"`
+	Currency          string `json:"currency" db:"currency"`
+	TotalCost         int    `json:"total_cost" db:"total_cost"`
+	Months            int    `json:"months" db:"months"`
+	SubscriptionCount int    `json:"subscription_count" db:"subscription_count"`
+	Rank              int    `json:"rank" db:"rank"`
+}
+
+// MonthlyCost сумма подписок в одной валюте за один месяц.
+// Key — значение группировки (CostFilter.GroupBy), пусто без группировки
+type MonthlyCost struct {
+	Month     time.Time `db:"month"`
+	Key       string    `db:"group_key"`
+	Currency  string    `db:"currency"`
+	TotalCost int       `db:"total_cost"`
+}
+
+// CostBreakdownItem сумма внутри месяца
+type CostBreakdownItem struct {
+	Key       string `json:"key,omitempty"`
 	Currency  string `json:"currency"`
+	TotalCost int    `json:"total_cost"`
+}
+
+// CostBreakdownMonth строка временного ряда: месяц в формате MM-YYYY
+type CostBreakdownMonth struct {
+	Month string              `json:"month"`
+	Items []CostBreakdownItem `json:"items"`
+}
+
+type CostBreakdownResponse struct {
+	GroupBy string               `json:"group_by,omitempty"`
+	Months  []CostBreakdownMonth `json:"months"`
 }
@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"context"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/reqctx"
+	"em_tz_anvar/internal/service"
+
+	"github.com/google/uuid"
+)
+
+type apiKeyPolicy struct {
+	next service.APIKeyService
+}
+
+func NewAPIKeyPolicy(next service.APIKeyService) service.APIKeyService {
+	return &apiKeyPolicy{next: next}
+}
+
+func (p *apiKeyPolicy) Create(ctx context.Context, req *models.CreateAPIKeyReq) (*models.APIKeySecret, error) {
+	if _, err := Authorize(ctx, ManageAPIKeys); err != nil {
+		return nil, err
+	}
+	return p.next.Create(ctx, req)
+}
+
+func (p *apiKeyPolicy) List(ctx context.Context) ([]models.APIKey, error) {
+	if _, err := Authorize(ctx, ManageAPIKeys); err != nil {
+		return nil, err
+	}
+	return p.next.List(ctx)
+}
+
+func (p *apiKeyPolicy) Revoke(ctx context.Context, id uuid.UUID) error {
+	if _, err := Authorize(ctx, ManageAPIKeys); err != nil {
+		return err
+	}
+	return p.next.Revoke(ctx, id)
+}
+
+func (p *apiKeyPolicy) Rotate(ctx context.Context, id uuid.UUID) (*models.APIKeySecret, error) {
+	if _, err := Authorize(ctx, ManageAPIKeys); err != nil {
+		return nil, err
+	}
+	return p.next.Rotate(ctx, id)
+}
+
+// Authenticate вызывается до того, как личность известна
+func (p *apiKeyPolicy) Authenticate(ctx context.Context, key string) (*reqctx.Identity, error) {
+	return p.next.Authenticate(ctx, key)
+}
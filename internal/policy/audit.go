@@ -0,0 +1,33 @@
+package policy
+
+import (
+	"context"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// auditPolicy снимки в журнале содержат чужие подписки, поэтому журнал — только для тех, кто видит всех
+type auditPolicy struct {
+	next service.AuditService
+}
+
+func NewAuditPolicy(next service.AuditService) service.AuditService {
+	return &auditPolicy{next: next}
+}
+
+func (p *auditPolicy) List(ctx context.Context, filter *models.AuditFilter) ([]models.AuditEntry, error) {
+	if _, err := Authorize(ctx, ReadAudit); err != nil {
+		return nil, err
+	}
+	return p.next.List(ctx, filter)
+}
+
+func (p *auditPolicy) GetHistory(ctx context.Context, id uuid.UUID, limit, offset int) ([]models.AuditEntry, error) {
+	if _, err := Authorize(ctx, ReadAudit); err != nil {
+		return nil, err
+	}
+	return p.next.GetHistory(ctx, id, limit, offset)
+}
@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"context"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/service"
+
+	"github.com/google/uuid"
+)
+
+type catalogPolicy struct {
+	next service.CatalogService
+}
+
+func NewCatalogPolicy(next service.CatalogService) service.CatalogService {
+	return &catalogPolicy{next: next}
+}
+
+func (p *catalogPolicy) Create(ctx context.Context, req *models.ServiceReq) (*models.Service, error) {
+	if _, err := Authorize(ctx, WriteServices); err != nil {
+		return nil, err
+	}
+	return p.next.Create(ctx, req)
+}
+
+func (p *catalogPolicy) GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	if _, err := Authorize(ctx, ReadServices); err != nil {
+		return nil, err
+	}
+	return p.next.GetByID(ctx, id)
+}
+
+func (p *catalogPolicy) GetAll(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error) {
+	if _, err := Authorize(ctx, ReadServices); err != nil {
+		return nil, err
+	}
+	return p.next.GetAll(ctx, filter)
+}
+
+func (p *catalogPolicy) Update(ctx context.Context, id uuid.UUID, req *models.ServiceReq) (*models.Service, error) {
+	if _, err := Authorize(ctx, WriteServices); err != nil {
+		return nil, err
+	}
+	return p.next.Update(ctx, id, req)
+}
+
+func (p *catalogPolicy) Delete(ctx context.Context, id uuid.UUID, mergeInto *uuid.UUID) error {
+	if _, err := Authorize(ctx, WriteServices); err != nil {
+		return err
+	}
+	return p.next.Delete(ctx, id, mergeInto)
+}
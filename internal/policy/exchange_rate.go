@@ -0,0 +1,38 @@
+package policy
+
+import (
+	"context"
+	"io"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/service"
+)
+
+type exchangeRatePolicy struct {
+	next service.ExchangeRateService
+}
+
+func NewExchangeRatePolicy(next service.ExchangeRateService) service.ExchangeRateService {
+	return &exchangeRatePolicy{next: next}
+}
+
+func (p *exchangeRatePolicy) Save(ctx context.Context, reqs []models.CreateExchangeRateReq) (int, error) {
+	if _, err := Authorize(ctx, WriteRates); err != nil {
+		return 0, err
+	}
+	return p.next.Save(ctx, reqs)
+}
+
+func (p *exchangeRatePolicy) Import(ctx context.Context, r io.Reader) (int, error) {
+	if _, err := Authorize(ctx, WriteRates); err != nil {
+		return 0, err
+	}
+	return p.next.Import(ctx, r)
+}
+
+func (p *exchangeRatePolicy) GetAll(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error) {
+	if _, err := Authorize(ctx, ReadRates); err != nil {
+		return nil, err
+	}
+	return p.next.GetAll(ctx, filter)
+}
@@ -0,0 +1,125 @@
+// Package policy решает, что вызывающему разрешено, по его роли. Решения собраны в одной таблице,
+// а декораторы применяют их к сервисам, так что ни хендлеры, ни сервисы проверок доступа не содержат
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"em_tz_anvar/internal/reqctx"
+	"em_tz_anvar/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// ErrForbidden роль вызывающего не допускает действие
+var ErrForbidden = errors.New("forbidden")
+
+// Action операция, доступ к которой решает политика
+type Action string
+
+const (
+	ReadSubscriptions  Action = "read subscriptions"
+	WriteSubscriptions Action = "modify subscriptions"
+	ReadCost           Action = "read cost reports"
+	ReadServices       Action = "read the service catalog"
+	WriteServices      Action = "modify the service catalog"
+	ReadRates          Action = "read exchange rates"
+	WriteRates         Action = "modify exchange rates"
+	ReadAudit          Action = "read the audit log"
+	ManageAPIKeys      Action = "manage api keys"
+)
+
+type grant int
+
+const (
+	deny grant = iota
+	own        // только подписки самого вызывающего
+	all        // данные всех пользователей
+)
+
+// rules кому что можно. Чего нет в таблице — запрещено
+var rules = map[string]map[Action]grant{
+	reqctx.RoleAdmin: {
+		ReadSubscriptions:  all,
+		WriteSubscriptions: all,
+		ReadCost:           all,
+		ReadServices:       all,
+		WriteServices:      all,
+		ReadRates:          all,
+		WriteRates:         all,
+		ReadAudit:          all,
+		ManageAPIKeys:      all,
+	},
+	reqctx.RoleAnalyst: {
+		ReadSubscriptions: own,
+		ReadCost:          all,
+		ReadServices:      all,
+		ReadRates:         all,
+	},
+	reqctx.RoleUser: {
+		ReadSubscriptions:  own,
+		WriteSubscriptions: own,
+		ReadCost:           own,
+		ReadServices:       all,
+		ReadRates:          all,
+	},
+}
+
+// Access итог проверки: Own — доступны только подписки пользователя UserID
+type Access struct {
+	Own    bool
+	UserID uuid.UUID
+}
+
+// Authorize решает, может ли вызывающий выполнить действие.
+// Без личности в контексте (auth выключен, внутренние вызовы) разрешено все.
+// API-ключ ограничен скоупами на маршрутах, поэтому здесь ему закрыто только управление ключами
+func Authorize(ctx context.Context, action Action) (Access, error) {
+	id, ok := reqctx.IdentityFrom(ctx)
+	if !ok {
+		return Access{}, nil
+	}
+
+	if id.APIKey {
+		if action == ManageAPIKeys {
+			return Access{}, fmt.Errorf("%w: api keys cannot %s", ErrForbidden, action)
+		}
+		return Access{}, nil
+	}
+
+	switch rules[id.Role][action] {
+	case all:
+		return Access{}, nil
+	case own:
+		return Access{Own: true, UserID: id.UserID}, nil
+	default:
+		return Access{}, fmt.Errorf("%w: role %q may not %s", ErrForbidden, id.Role, action)
+	}
+}
+
+// ScopeUserID фильтр по пользователю с учетом доступа: свой user_id подставляется, чужой — ErrForbidden
+func (a Access) ScopeUserID(requested *uuid.UUID) (*uuid.UUID, error) {
+	if !a.Own {
+		return requested, nil
+	}
+	if requested != nil && *requested != a.UserID {
+		return nil, fmt.Errorf("%w: access to another user's subscriptions", ErrForbidden)
+	}
+	userID := a.UserID
+	return &userID, nil
+}
+
+// Wrap оборачивает сервисы проверками доступа. owners нужен, чтобы узнать владельца подписки до операции
+func Wrap(services *service.Service, owners Owners) *service.Service {
+	return &service.Service{
+		Subscription: NewSubscriptionPolicy(services.Subscription, owners),
+		Catalog:      NewCatalogPolicy(services.Catalog),
+		ExchangeRate: NewExchangeRatePolicy(services.ExchangeRate),
+		Audit:        NewAuditPolicy(services.Audit),
+		APIKey:       NewAPIKeyPolicy(services.APIKey),
+		// Ключ идемпотентности привязан к вызывающему, отдельных прав не требует
+		Idempotency: services.Idempotency,
+	}
+}
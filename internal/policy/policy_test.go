@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func roleCtx(role string, userID uuid.UUID) context.Context {
+	return reqctx.WithIdentity(context.Background(), &reqctx.Identity{Subject: userID.String(), UserID: userID, Role: role})
+}
+
+func TestAuthorize(t *testing.T) {
+	me := uuid.New()
+	apiKey := reqctx.WithIdentity(context.Background(), &reqctx.Identity{Subject: "api-key:batch", APIKey: true})
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		action Action
+		want   Access
+		denied bool
+	}{
+		{name: "anonymous", ctx: context.Background(), action: ManageAPIKeys, want: Access{}},
+		{name: "admin writes any", ctx: roleCtx(reqctx.RoleAdmin, me), action: WriteSubscriptions, want: Access{}},
+		{name: "admin reads audit", ctx: roleCtx(reqctx.RoleAdmin, me), action: ReadAudit, want: Access{}},
+		{name: "analyst reads all costs", ctx: roleCtx(reqctx.RoleAnalyst, me), action: ReadCost, want: Access{}},
+		{name: "analyst reads own subscriptions", ctx: roleCtx(reqctx.RoleAnalyst, me), action: ReadSubscriptions, want: Access{Own: true, UserID: me}},
+		{name: "analyst never mutates", ctx: roleCtx(reqctx.RoleAnalyst, me), action: WriteSubscriptions, denied: true},
+		{name: "analyst no rates write", ctx: roleCtx(reqctx.RoleAnalyst, me), action: WriteRates, denied: true},
+		{name: "user writes own", ctx: roleCtx(reqctx.RoleUser, me), action: WriteSubscriptions, want: Access{Own: true, UserID: me}},
+		{name: "user reads own costs", ctx: roleCtx(reqctx.RoleUser, me), action: ReadCost, want: Access{Own: true, UserID: me}},
+		{name: "user reads rates", ctx: roleCtx(reqctx.RoleUser, me), action: ReadRates, want: Access{}},
+		{name: "user reads catalog", ctx: roleCtx(reqctx.RoleUser, me), action: ReadServices, want: Access{}},
+		{name: "user no catalog write", ctx: roleCtx(reqctx.RoleUser, me), action: WriteServices, denied: true},
+		{name: "analyst no catalog write", ctx: roleCtx(reqctx.RoleAnalyst, me), action: WriteServices, denied: true},
+		{name: "user no audit", ctx: roleCtx(reqctx.RoleUser, me), action: ReadAudit, denied: true},
+		{name: "user no keys", ctx: roleCtx(reqctx.RoleUser, me), action: ManageAPIKeys, denied: true},
+		{name: "unknown role", ctx: roleCtx("guest", me), action: ReadSubscriptions, denied: true},
+		{name: "api key within scopes", ctx: apiKey, action: WriteSubscriptions, want: Access{}},
+		{name: "api key no keys", ctx: apiKey, action: ManageAPIKeys, denied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, err := Authorize(tt.ctx, tt.action)
+			if tt.denied {
+				assert.ErrorIs(t, err, ErrForbidden)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, access)
+		})
+	}
+}
+
+func TestAccess_ScopeUserID(t *testing.T) {
+	me, other := uuid.New(), uuid.New()
+
+	userID, err := Access{}.ScopeUserID(&other)
+	require.NoError(t, err)
+	assert.Equal(t, &other, userID)
+
+	userID, err = Access{Own: true, UserID: me}.ScopeUserID(nil)
+	require.NoError(t, err)
+	assert.Equal(t, me, *userID)
+
+	_, err = Access{Own: true, UserID: me}.ScopeUserID(&other)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestAuditPolicy_AdminOnly(t *testing.T) {
+	p := NewAuditPolicy(nil)
+
+	_, err := p.List(roleCtx(reqctx.RoleUser, uuid.New()), &models.AuditFilter{})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = p.GetHistory(roleCtx(reqctx.RoleAnalyst, uuid.New()), uuid.New(), 10, 0)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestAPIKeyPolicy_AdminOnly(t *testing.T) {
+	p := NewAPIKeyPolicy(nil)
+	req := &models.CreateAPIKeyReq{Name: "batch", Scopes: []string{models.ScopeCostRead}}
+
+	_, err := p.Create(roleCtx(reqctx.RoleUser, uuid.New()), req)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	keyCtx := reqctx.WithIdentity(context.Background(), &reqctx.Identity{Subject: "api-key:batch", APIKey: true, Scopes: models.APIKeyScopes})
+	_, err = p.Create(keyCtx, req)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = p.List(keyCtx)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
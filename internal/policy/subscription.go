@@ -0,0 +1,182 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// Owners владелец подписки, в том числе из корзины
+type Owners interface {
+	GetOwner(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
+}
+
+type subscriptionPolicy struct {
+	next   service.SubscriptionService
+	owners Owners
+}
+
+func NewSubscriptionPolicy(next service.SubscriptionService, owners Owners) service.SubscriptionService {
+	return &subscriptionPolicy{next: next, owners: owners}
+}
+
+func (p *subscriptionPolicy) Create(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error) {
+	access, err := Authorize(ctx, WriteSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	// Некорректный user_id отклонит сервис
+	if userID, err := uuid.Parse(req.UserID); err == nil && access.Own && userID != access.UserID {
+		return nil, fmt.Errorf("%w: cannot create subscription for another user", ErrForbidden)
+	}
+	return p.next.Create(ctx, req)
+}
+
+func (p *subscriptionPolicy) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	if err := p.authorizeOwned(ctx, ReadSubscriptions, id); err != nil {
+		return nil, err
+	}
+	return p.next.GetByID(ctx, id)
+}
+
+func (p *subscriptionPolicy) GetAll(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+	access, err := Authorize(ctx, ReadSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	if filter.UserID, err = access.ScopeUserID(filter.UserID); err != nil {
+		return nil, err
+	}
+	// Список user_id под своим доступом может содержать только самого вызывающего
+	for _, userID := range filter.UserIDs {
+		if access.Own && userID != access.UserID {
+			return nil, fmt.Errorf("%w: access to another user's subscriptions", ErrForbidden)
+		}
+	}
+	return p.next.GetAll(ctx, filter)
+}
+
+func (p *subscriptionPolicy) Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
+	if err := p.authorizeOwned(ctx, WriteSubscriptions, id); err != nil {
+		return nil, err
+	}
+	return p.next.Update(ctx, id, req, version)
+}
+
+func (p *subscriptionPolicy) Patch(ctx context.Context, id uuid.UUID, req *models.PatchSubscriptionReq, version int) (*models.Subscription, error) {
+	if err := p.authorizeOwned(ctx, WriteSubscriptions, id); err != nil {
+		return nil, err
+	}
+	return p.next.Patch(ctx, id, req, version)
+}
+
+func (p *subscriptionPolicy) Delete(ctx context.Context, id uuid.UUID, version int) error {
+	if err := p.authorizeOwned(ctx, WriteSubscriptions, id); err != nil {
+		return err
+	}
+	return p.next.Delete(ctx, id, version)
+}
+
+func (p *subscriptionPolicy) Restore(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	if err := p.authorizeOwned(ctx, WriteSubscriptions, id); err != nil {
+		return nil, err
+	}
+	return p.next.Restore(ctx, id)
+}
+
+func (p *subscriptionPolicy) Purge(ctx context.Context, id uuid.UUID) error {
+	if err := p.authorizeOwned(ctx, WriteSubscriptions, id); err != nil {
+		return err
+	}
+	return p.next.Purge(ctx, id)
+}
+
+func (p *subscriptionPolicy) GetTotalCost(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error) {
+	if err := scopeCost(ctx, filter); err != nil {
+		return nil, err
+	}
+	return p.next.GetTotalCost(ctx, filter)
+}
+
+func (p *subscriptionPolicy) GetCostBreakdown(ctx context.Context, filter *models.CostFilter) (*models.CostBreakdownResponse, error) {
+	if err := scopeCost(ctx, filter); err != nil {
+		return nil, err
+	}
+	return p.next.GetCostBreakdown(ctx, filter)
+}
+
+func (p *subscriptionPolicy) GetCharges(ctx context.Context, id uuid.UUID) ([]models.Charge, error) {
+	if err := p.authorizeOwned(ctx, ReadSubscriptions, id); err != nil {
+		return nil, err
+	}
+	return p.next.GetCharges(ctx, id)
+}
+
+// RebuildCharges затрагивает подписки всех пользователей
+func (p *subscriptionPolicy) RebuildCharges(ctx context.Context) (int, error) {
+	access, err := Authorize(ctx, WriteSubscriptions)
+	if err != nil {
+		return 0, err
+	}
+	if access.Own {
+		return 0, fmt.Errorf("%w: rebuilding charges requires access to all subscriptions", ErrForbidden)
+	}
+	return p.next.RebuildCharges(ctx)
+}
+
+// GetOverlaps под своим доступом — только свои подписки
+func (p *subscriptionPolicy) GetOverlaps(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error) {
+	access, err := Authorize(ctx, ReadSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := access.ScopeUserID(&userID); err != nil {
+		return nil, err
+	}
+	return p.next.GetOverlaps(ctx, userID)
+}
+
+// GetUserSummary включает траты пользователя, поэтому нужны права и на подписки, и на отчеты по стоимости
+func (p *subscriptionPolicy) GetUserSummary(ctx context.Context, userID uuid.UUID) (*models.UserSummary, error) {
+	for _, action := range []Action{ReadSubscriptions, ReadCost} {
+		access, err := Authorize(ctx, action)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := access.ScopeUserID(&userID); err != nil {
+			return nil, err
+		}
+	}
+	return p.next.GetUserSummary(ctx, userID)
+}
+
+// authorizeOwned проверка действия над одной подпиской. Чужая подписка для вызывающего не существует:
+// ErrNotFound, а не ErrForbidden, чтобы не раскрывать чужие ID
+func (p *subscriptionPolicy) authorizeOwned(ctx context.Context, action Action, id uuid.UUID) error {
+	access, err := Authorize(ctx, action)
+	if err != nil || !access.Own {
+		return err
+	}
+	owner, err := p.owners.GetOwner(ctx, id)
+	if err != nil {
+		return err
+	}
+	if owner != access.UserID {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func scopeCost(ctx context.Context, filter *models.CostFilter) error {
+	access, err := Authorize(ctx, ReadCost)
+	if err != nil {
+		return err
+	}
+	filter.UserID, err = access.ScopeUserID(filter.UserID)
+	return err
+}
@@ -0,0 +1,216 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSubscriptionService запоминает, какие методы дошли до сервиса
+type mockSubscriptionService struct {
+	calls      []string
+	costFilter *models.CostFilter
+	listFilter *models.SubscriptionFilter
+}
+
+func (m *mockSubscriptionService) Create(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error) {
+	m.calls = append(m.calls, "Create")
+	return &models.Subscription{}, nil
+}
+
+func (m *mockSubscriptionService) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	m.calls = append(m.calls, "GetByID")
+	return &models.Subscription{ID: id}, nil
+}
+
+func (m *mockSubscriptionService) GetAll(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
+	m.calls = append(m.calls, "GetAll")
+	m.listFilter = filter
+	return &models.SubscriptionPage{Items: []models.Subscription{}}, nil
+}
+
+func (m *mockSubscriptionService) Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
+	m.calls = append(m.calls, "Update")
+	return &models.Subscription{ID: id}, nil
+}
+
+func (m *mockSubscriptionService) Patch(ctx context.Context, id uuid.UUID, req *models.PatchSubscriptionReq, version int) (*models.Subscription, error) {
+	m.calls = append(m.calls, "Patch")
+	return &models.Subscription{ID: id}, nil
+}
+
+func (m *mockSubscriptionService) Delete(ctx context.Context, id uuid.UUID, version int) error {
+	m.calls = append(m.calls, "Delete")
+	return nil
+}
+
+func (m *mockSubscriptionService) Restore(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	m.calls = append(m.calls, "Restore")
+	return &models.Subscription{ID: id}, nil
+}
+
+func (m *mockSubscriptionService) Purge(ctx context.Context, id uuid.UUID) error {
+	m.calls = append(m.calls, "Purge")
+	return nil
+}
+
+func (m *mockSubscriptionService) GetTotalCost(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error) {
+	m.calls = append(m.calls, "GetTotalCost")
+	m.costFilter = filter
+	return &models.TotalCostResponse{}, nil
+}
+
+func (m *mockSubscriptionService) GetCostBreakdown(ctx context.Context, filter *models.CostFilter) (*models.CostBreakdownResponse, error) {
+	m.calls = append(m.calls, "GetCostBreakdown")
+	m.costFilter = filter
+	return &models.CostBreakdownResponse{}, nil
+}
+
+func (m *mockSubscriptionService) GetCharges(ctx context.Context, id uuid.UUID) ([]models.Charge, error) {
+	m.calls = append(m.calls, "GetCharges")
+	return []models.Charge{}, nil
+}
+
+func (m *mockSubscriptionService) RebuildCharges(ctx context.Context) (int, error) {
+	m.calls = append(m.calls, "RebuildCharges")
+	return 0, nil
+}
+
+func (m *mockSubscriptionService) GetOverlaps(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error) {
+	m.calls = append(m.calls, "GetOverlaps")
+	return []models.SubscriptionOverlap{}, nil
+}
+
+func (m *mockSubscriptionService) GetUserSummary(ctx context.Context, userID uuid.UUID) (*models.UserSummary, error) {
+	m.calls = append(m.calls, "GetUserSummary")
+	return &models.UserSummary{UserID: userID}, nil
+}
+
+type ownersFunc func(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
+
+func (f ownersFunc) GetOwner(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	return f(ctx, id)
+}
+
+func ownedBy(owner uuid.UUID) Owners {
+	return ownersFunc(func(ctx context.Context, id uuid.UUID) (uuid.UUID, error) { return owner, nil })
+}
+
+func TestSubscriptionPolicy_UserOwnRowsOnly(t *testing.T) {
+	me, other := uuid.New(), uuid.New()
+	id := uuid.New()
+	ctx := roleCtx(reqctx.RoleUser, me)
+
+	next := &mockSubscriptionService{}
+	p := NewSubscriptionPolicy(next, ownedBy(other))
+
+	// Чужая подписка для пользователя не существует
+	_, err := p.GetByID(ctx, id)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = p.Update(ctx, id, &models.UpdateSubscriptionReq{ServiceName: "Stolen"}, 0)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = p.Patch(ctx, id, &models.PatchSubscriptionReq{}, 0)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.ErrorIs(t, p.Delete(ctx, id, 0), repository.ErrNotFound)
+	_, err = p.Restore(ctx, id)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.ErrorIs(t, p.Purge(ctx, id), repository.ErrNotFound)
+	_, err = p.GetCharges(ctx, id)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Empty(t, next.calls)
+
+	_, err = p.Create(ctx, &models.CreateSubscriptionReq{UserID: other.String()})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = p.GetAll(ctx, &models.SubscriptionFilter{UserID: &other})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = p.GetAll(ctx, &models.SubscriptionFilter{UserIDs: []uuid.UUID{me, other}})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = p.GetTotalCost(ctx, &models.CostFilter{UserID: &other})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = p.RebuildCharges(ctx)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = p.GetOverlaps(ctx, other)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = p.GetUserSummary(ctx, other)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.Empty(t, next.calls)
+
+	// Свои подписки
+	p = NewSubscriptionPolicy(next, ownedBy(me))
+	require.NoError(t, p.Delete(ctx, id, 0))
+	_, err = p.Create(ctx, &models.CreateSubscriptionReq{UserID: me.String()})
+	require.NoError(t, err)
+
+	_, err = p.GetAll(ctx, &models.SubscriptionFilter{})
+	require.NoError(t, err)
+	require.NotNil(t, next.listFilter.UserID)
+	assert.Equal(t, me, *next.listFilter.UserID)
+
+	_, err = p.GetCostBreakdown(ctx, &models.CostFilter{})
+	require.NoError(t, err)
+	require.NotNil(t, next.costFilter.UserID)
+	assert.Equal(t, me, *next.costFilter.UserID)
+
+	_, err = p.GetOverlaps(ctx, me)
+	require.NoError(t, err)
+	_, err = p.GetUserSummary(ctx, me)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Delete", "Create", "GetAll", "GetCostBreakdown", "GetOverlaps", "GetUserSummary"}, next.calls)
+}
+
+func TestSubscriptionPolicy_AnalystReadsCostNeverMutates(t *testing.T) {
+	analyst, alice := uuid.New(), uuid.New()
+	ctx := roleCtx(reqctx.RoleAnalyst, analyst)
+
+	next := &mockSubscriptionService{}
+	p := NewSubscriptionPolicy(next, ownedBy(analyst))
+
+	_, err := p.GetTotalCost(ctx, &models.CostFilter{UserID: &alice})
+	require.NoError(t, err)
+	assert.Equal(t, &alice, next.costFilter.UserID)
+
+	_, err = p.GetTotalCost(ctx, &models.CostFilter{})
+	require.NoError(t, err)
+	assert.Nil(t, next.costFilter.UserID)
+
+	_, err = p.Create(ctx, &models.CreateSubscriptionReq{UserID: analyst.String()})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = p.Update(ctx, uuid.New(), &models.UpdateSubscriptionReq{}, 0)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, p.Delete(ctx, uuid.New(), 0), ErrForbidden)
+	assert.ErrorIs(t, p.Purge(ctx, uuid.New()), ErrForbidden)
+
+	// В сводке есть подписки, а их аналитик видит только свои
+	_, err = p.GetUserSummary(ctx, alice)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	assert.Equal(t, []string{"GetTotalCost", "GetTotalCost"}, next.calls)
+}
+
+func TestSubscriptionPolicy_AdminDoesEverything(t *testing.T) {
+	ctx := roleCtx(reqctx.RoleAdmin, uuid.Nil)
+	next := &mockSubscriptionService{}
+	owners := ownersFunc(func(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+		t.Fatal("owner lookup is not needed for admin")
+		return uuid.Nil, nil
+	})
+	p := NewSubscriptionPolicy(next, owners)
+
+	require.NoError(t, p.Delete(ctx, uuid.New(), 0))
+	_, err := p.GetAll(ctx, &models.SubscriptionFilter{})
+	require.NoError(t, err)
+	assert.Nil(t, next.listFilter.UserID)
+	_, err = p.RebuildCharges(ctx)
+	require.NoError(t, err)
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+type apiKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+// Create
+func (r *apiKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (id, name, key_prefix, key_hash, scopes, expires_at, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		key.ID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		key.Scopes,
+		key.ExpiresAt,
+		key.CreatedBy,
+		key.CreatedAt,
+		key.UpdatedAt,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("api_key_id", key.ID.String()).Msg("Failed to create api key")
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// GetByHash ключ по SHA-256, в том числе отозванный и истекший — проверяет вызывающий
+func (r *apiKeyRepository) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := `
+		SELECT id, name, key_prefix, key_hash, scopes, expires_at, revoked_at, last_used_at, created_by, created_at, updated_at
+		FROM api_keys
+		WHERE key_hash = $1
+	`
+
+	var key models.APIKey
+	err := r.db.GetContext(ctx, &key, query, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		log.Error().Err(err).Msg("Failed to get api key")
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// GetAll ключи, новые первыми
+func (r *apiKeyRepository) GetAll(ctx context.Context) ([]models.APIKey, error) {
+	query := `
+		SELECT id, name, key_prefix, key_hash, scopes, expires_at, revoked_at, last_used_at, created_by, created_at, updated_at
+		FROM api_keys
+		ORDER BY created_at DESC
+	`
+
+	keys := []models.APIKey{}
+	if err := r.db.SelectContext(ctx, &keys, query); err != nil {
+		log.Error().Err(err).Msg("Failed to get api keys")
+		return nil, fmt.Errorf("failed to get api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// Revoke отзывает ключ; отозванный повторно — ErrAPIKeyNotFound
+func (r *apiKeyRepository) Revoke(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE api_keys SET revoked_at = NOW(), updated_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		log.Error().Err(err).Str("api_key_id", id.String()).Msg("Failed to revoke api key")
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Rotate заменяет секрет действующего ключа, старый перестает работать сразу
+func (r *apiKeyRepository) Rotate(ctx context.Context, id uuid.UUID, prefix, hash string) (*models.APIKey, error) {
+	query := `
+		UPDATE api_keys SET key_prefix = $1, key_hash = $2, updated_at = NOW()
+		WHERE id = $3 AND revoked_at IS NULL
+		RETURNING id, name, key_prefix, key_hash, scopes, expires_at, revoked_at, last_used_at, created_by, created_at, updated_at
+	`
+
+	var key models.APIKey
+	err := r.db.GetContext(ctx, &key, query, prefix, hash, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		log.Error().Err(err).Str("api_key_id", id.String()).Msg("Failed to rotate api key")
+		return nil, fmt.Errorf("failed to rotate api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// TouchLastUsed отмечает время последнего запроса с ключом
+func (r *apiKeyRepository) TouchLastUsed(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to update api key last use: %w", err)
+	}
+	return nil
+}
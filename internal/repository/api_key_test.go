@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiKeyColumns = []string{"id", "name", "key_prefix", "key_hash", "scopes", "expires_at", "revoked_at", "last_used_at", "created_by", "created_at", "updated_at"}
+
+func TestAPIKeyRepository_Create(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewAPIKeyRepository(db)
+	ctx := context.Background()
+
+	key := &models.APIKey{
+		ID:        uuid.MustParse("11111111-1111-1111-1111-111111111111"),
+		Name:      "batch",
+		Prefix:    "sk_abcdefgh",
+		KeyHash:   "hash",
+		Scopes:    pq.StringArray{models.ScopeCostRead},
+		CreatedBy: "admin",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	mock.ExpectExec("INSERT INTO api_keys").
+		WithArgs(key.ID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt, key.CreatedBy, key.CreatedAt, key.UpdatedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, repo.Create(ctx, key))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyRepository_GetByHash(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewAPIKeyRepository(db)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	rows := sqlmock.NewRows(apiKeyColumns).
+		AddRow(id, "batch", "sk_abcdefgh", "hash", "{subscriptions:read,cost:read}", nil, nil, nil, "admin", time.Now(), time.Now())
+	mock.ExpectQuery("SELECT .+ FROM api_keys WHERE key_hash = \\$1").
+		WithArgs("hash").
+		WillReturnRows(rows)
+
+	key, err := repo.GetByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, id, key.ID)
+	assert.Equal(t, pq.StringArray{models.ScopeSubscriptionsRead, models.ScopeCostRead}, key.Scopes)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyRepository_GetByHash_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewAPIKeyRepository(db)
+
+	mock.ExpectQuery("FROM api_keys WHERE key_hash").
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+
+	_, err := repo.GetByHash(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func TestAPIKeyRepository_Revoke_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewAPIKeyRepository(db)
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	// Уже отозванный ключ повторно не отзывается
+	mock.ExpectExec("UPDATE api_keys SET revoked_at = NOW\\(\\)(.+)revoked_at IS NULL").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.Revoke(context.Background(), id)
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyRepository_Rotate(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewAPIKeyRepository(db)
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	rows := sqlmock.NewRows(apiKeyColumns).
+		AddRow(id, "batch", "sk_newprefx", "newhash", "{cost:read}", nil, nil, nil, "admin", time.Now(), time.Now())
+	mock.ExpectQuery("UPDATE api_keys SET key_prefix = \\$1, key_hash = \\$2(.+)revoked_at IS NULL(.+)RETURNING").
+		WithArgs("sk_newprefx", "newhash", id).
+		WillReturnRows(rows)
+
+	key, err := repo.Rotate(context.Background(), id, "sk_newprefx", "newhash")
+	require.NoError(t, err)
+	assert.Equal(t, "sk_newprefx", key.Prefix)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
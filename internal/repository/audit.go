@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type auditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+// writeAudit записывает изменение подписки в журнал в той же транзакции, что и само изменение.
+// Автор и идентификатор запроса берутся из контекста
+func writeAudit(ctx context.Context, tx *sqlx.Tx, action string, id uuid.UUID, before, after *models.Subscription) error {
+	beforeJSON, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO subscription_audit (subscription_id, action, actor, request_id, before, after)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5::jsonb, $6::jsonb)
+	`
+
+	_, err = tx.ExecContext(ctx, query, id, action, reqctx.Actor(ctx), reqctx.RequestID(ctx), beforeJSON, afterJSON)
+	if err != nil {
+		log.Error().Err(err).Str("subscription_id", id.String()).Str("action", action).Msg("Failed to write audit entry")
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// snapshot сериализует подписку для журнала; nil — NULL
+func snapshot(sub *models.Subscription) (sql.NullString, error) {
+	if sub == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to marshal audit snapshot: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// List записи журнала по фильтру, новые первыми
+func (r *auditRepository) List(ctx context.Context, filter *models.AuditFilter) ([]models.AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+
+	query := `
+		SELECT id, subscription_id, action, actor, COALESCE(request_id, '') AS request_id,
+			COALESCE(before, 'null'::jsonb) AS before, COALESCE(after, 'null'::jsonb) AS after, created_at
+		FROM subscription_audit
+	`
+
+	if filter.SubscriptionID != nil {
+		args = append(args, *filter.SubscriptionID)
+		conditions = append(conditions, fmt.Sprintf("subscription_id = $%d", len(args)))
+	}
+
+	if filter.Actor != "" {
+		args = append(args, filter.Actor)
+		conditions = append(conditions, fmt.Sprintf("actor = $%d", len(args)))
+	}
+
+	if filter.Action != "" {
+		args = append(args, filter.Action)
+		conditions = append(conditions, fmt.Sprintf("action = $%d", len(args)))
+	}
+
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY created_at DESC, id DESC"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	entries := []models.AuditEntry{}
+	err := r.db.SelectContext(ctx, &entries, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get audit entries")
+		return nil, fmt.Errorf("failed to get audit entries: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRepository_List(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewAuditRepository(db)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"id", "subscription_id", "action", "actor", "request_id", "before", "after", "created_at"}).
+		AddRow(2, id, "update", "alice", "req-2", []byte(`{"price":100}`), []byte(`{"price":200}`), time.Now()).
+		AddRow(1, id, "create", "alice", "", []byte(`null`), []byte(`{"price":100}`), time.Now())
+	mock.ExpectQuery("FROM subscription_audit WHERE subscription_id = \\$1 AND actor = \\$2 AND created_at >= \\$3 ORDER BY created_at DESC, id DESC LIMIT \\$4").
+		WithArgs(id, "alice", from, 50).
+		WillReturnRows(rows)
+
+	filter := &models.AuditFilter{SubscriptionID: &id, Actor: "alice", From: &from, Limit: 50}
+	entries, err := repo.List(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.AuditUpdate, entries[0].Action)
+	assert.JSONEq(t, `{"price":200}`, string(entries[0].After))
+	assert.JSONEq(t, `null`, string(entries[1].Before))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrServiceNotFound = errors.New("service not found")
+
+// ErrServiceNameTaken название или псевдоним уже принадлежит другому сервису
+var ErrServiceNameTaken = errors.New("service name is already taken")
+
+// ErrServiceInUse на сервис ссылаются подписки, в том числе из корзины
+var ErrServiceInUse = errors.New("service is used by subscriptions")
+
+type catalogRepository struct {
+	db *sqlx.DB
+}
+
+func NewCatalogRepository(db *sqlx.DB) CatalogRepository {
+	return &catalogRepository{db: db}
+}
+
+// serviceSelect сервисы с псевдонимами; каноническое название в псевдонимы не входит
+const serviceSelect = `
+	SELECT s.id, s.name, s.category, s.default_price, s.currency, s.created_at, s.updated_at,
+		COALESCE(array_agg(a.alias ORDER BY a.alias) FILTER (WHERE a.alias_key <> s.name_key), '{}') AS aliases
+	FROM services s
+	LEFT JOIN service_aliases a ON a.service_id = s.id
+`
+
+// Create сохраняет сервис и все его названия одной транзакцией
+func (r *catalogRepository) Create(ctx context.Context, service *models.Service) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO services (id, name, name_key, category, default_price, currency, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		service.ID,
+		service.Name,
+		models.ServiceKey(service.Name),
+		service.Category,
+		service.DefaultPrice,
+		service.Currency,
+		service.CreatedAt,
+		service.UpdatedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			err = fmt.Errorf("%w: %q", ErrServiceNameTaken, service.Name)
+			return err
+		}
+		log.Error().Err(err).Str("service_id", service.ID.String()).Msg("Failed to create service")
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+
+	if err = saveServiceNames(ctx, tx, service); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID
+func (r *catalogRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	query := serviceSelect + " WHERE s.id = $1 GROUP BY s.id"
+
+	var service models.Service
+	err := r.db.GetContext(ctx, &service, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrServiceNotFound
+		}
+		log.Error().Err(err).Str("service_id", id.String()).Msg("Failed to get service")
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	return &service, nil
+}
+
+// GetAll сервисы по алфавиту
+func (r *catalogRepository) GetAll(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Search != "" {
+		args = append(args, "%"+likeEscaper.Replace(models.ServiceKey(filter.Search))+"%")
+		conditions = append(conditions, fmt.Sprintf("s.id IN (SELECT service_id FROM service_aliases WHERE alias_key LIKE $%d)", len(args)))
+	}
+
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		conditions = append(conditions, fmt.Sprintf("s.category = $%d", len(args)))
+	}
+
+	query := serviceSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " GROUP BY s.id ORDER BY s.name_key"
+
+	services := []models.Service{}
+	if err := r.db.SelectContext(ctx, &services, query, args...); err != nil {
+		log.Error().Err(err).Msg("Failed to get services")
+		return nil, fmt.Errorf("failed to get services: %w", err)
+	}
+
+	return services, nil
+}
+
+// Update заменяет сервис и его названия. Каноническое название переходит в service_name подписок сервиса,
+// их версия растет, чтобы ETag сменился, и каждая получает запись в журнале изменений
+func (r *catalogRepository) Update(ctx context.Context, service *models.Service) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE services
+		SET name = $1, name_key = $2, category = $3, default_price = $4, currency = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING created_at, updated_at
+	`
+
+	err = tx.QueryRowxContext(ctx, query,
+		service.Name,
+		models.ServiceKey(service.Name),
+		service.Category,
+		service.DefaultPrice,
+		service.Currency,
+		service.ID,
+	).Scan(&service.CreatedAt, &service.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrServiceNotFound
+			return err
+		}
+		if isUniqueViolation(err) {
+			err = fmt.Errorf("%w: %q", ErrServiceNameTaken, service.Name)
+			return err
+		}
+		log.Error().Err(err).Str("service_id", service.ID.String()).Msg("Failed to update service")
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM service_aliases WHERE service_id = $1`, service.ID); err != nil {
+		log.Error().Err(err).Str("service_id", service.ID.String()).Msg("Failed to delete service aliases")
+		return fmt.Errorf("failed to delete service aliases: %w", err)
+	}
+
+	if err = saveServiceNames(ctx, tx, service); err != nil {
+		return err
+	}
+
+	if err = renameSubscriptions(ctx, tx, service.ID, service.ID, service.Name); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Delete удаляет сервис вместе с псевдонимами. Сервис, на который ссылаются подписки, удаляется только
+// слиянием: с mergeInto его подписки и все названия переходят к сервису mergeInto
+func (r *catalogRepository) Delete(ctx context.Context, id uuid.UUID, mergeInto *uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	log.Debug().Str("service_id", id.String()).Msg("Deleting service")
+
+	if mergeInto != nil {
+		var name string
+		err = tx.GetContext(ctx, &name, `SELECT name FROM services WHERE id = $1 FOR UPDATE`, *mergeInto)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = ErrServiceNotFound
+				return err
+			}
+			log.Error().Err(err).Str("service_id", mergeInto.String()).Msg("Failed to lock service")
+			return fmt.Errorf("failed to get service: %w", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, `UPDATE service_aliases SET service_id = $1 WHERE service_id = $2`, *mergeInto, id); err != nil {
+			log.Error().Err(err).Str("service_id", id.String()).Msg("Failed to move service aliases")
+			return fmt.Errorf("failed to move service aliases: %w", err)
+		}
+
+		if err = renameSubscriptions(ctx, tx, id, *mergeInto, name); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM services WHERE id = $1`, id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			err = ErrServiceInUse
+			return err
+		}
+		log.Error().Err(err).Str("service_id", id.String()).Msg("Failed to delete service")
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		err = ErrServiceNotFound
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// saveServiceNames записывает каноническое название и псевдонимы сервиса в service_aliases
+func saveServiceNames(ctx context.Context, tx *sqlx.Tx, service *models.Service) error {
+	query := `INSERT INTO service_aliases (alias_key, alias, service_id) VALUES ($1, $2, $3)`
+
+	for _, name := range append([]string{service.Name}, service.Aliases...) {
+		if _, err := tx.ExecContext(ctx, query, models.ServiceKey(name), name, service.ID); err != nil {
+			if isUniqueViolation(err) {
+				return fmt.Errorf("%w: %q", ErrServiceNameTaken, name)
+			}
+			log.Error().Err(err).Str("service_id", service.ID.String()).Msg("Failed to save service alias")
+			return fmt.Errorf("failed to save service alias: %w", err)
+		}
+	}
+	return nil
+}
+
+// renameSubscriptions переводит подписки сервиса from на сервис to с названием name. Каждая измененная
+// подписка получает запись в журнале изменений в той же транзакции
+func renameSubscriptions(ctx context.Context, tx *sqlx.Tx, from, to uuid.UUID, name string) error {
+	lock := `
+		SELECT id, service_name, service_id, price, currency, billing_period, billing_months, user_id, start_date, end_date, created_at, updated_at, deleted_at, version
+		FROM subscriptions
+		WHERE service_id = $1 AND (service_id <> $2 OR service_name <> $3)
+		ORDER BY id
+		FOR UPDATE
+	`
+
+	var before []models.Subscription
+	if err := tx.SelectContext(ctx, &before, lock, from, to, name); err != nil {
+		log.Error().Err(err).Str("service_id", from.String()).Msg("Failed to lock service subscriptions")
+		return fmt.Errorf("failed to get service subscriptions: %w", err)
+	}
+	if len(before) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(before))
+	for i := range before {
+		ids[i] = before[i].ID.String()
+	}
+
+	query := `
+		UPDATE subscriptions
+		SET service_id = $1, service_name = $2, updated_at = NOW(), version = version + 1
+		WHERE id = ANY($3::uuid[])
+		RETURNING id, updated_at, version
+	`
+
+	var renamed []models.Subscription
+	if err := tx.SelectContext(ctx, &renamed, query, to, name, pq.Array(ids)); err != nil {
+		log.Error().Err(err).Str("service_id", from.String()).Msg("Failed to rename subscriptions")
+		return fmt.Errorf("failed to rename subscriptions: %w", err)
+	}
+
+	updated := make(map[uuid.UUID]models.Subscription, len(renamed))
+	for _, sub := range renamed {
+		updated[sub.ID] = sub
+	}
+
+	for i := range before {
+		after := before[i]
+		after.ServiceID = &to
+		after.ServiceName = name
+		after.UpdatedAt = updated[after.ID].UpdatedAt
+		after.Version = updated[after.ID].Version
+		if err := writeAudit(ctx, tx, models.AuditUpdate, after.ID, &before[i], &after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveService находит сервис каталога по названию подписки или его псевдониму, неизвестное название
+// заводит в каталог новым сервисом. Подписке записываются ID сервиса и его каноническое название
+func resolveService(ctx context.Context, q sqlx.ExtContext, subscription *models.Subscription) error {
+	key := models.ServiceKey(subscription.ServiceName)
+	if key == "" {
+		subscription.ServiceID = nil
+		return nil
+	}
+
+	lookup := `
+		SELECT s.id, s.name
+		FROM service_aliases a
+		JOIN services s ON s.id = a.service_id
+		WHERE a.alias_key = $1
+	`
+
+	var found models.Service
+	err := sqlx.GetContext(ctx, q, &found, lookup, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Параллельный запрос мог завести тот же сервис: ON CONFLICT дождется его и ничего не вставит
+		name := strings.Join(strings.Fields(subscription.ServiceName), " ")
+		insert := `
+			WITH created AS (
+				INSERT INTO services (id, name, name_key) VALUES ($1, $2, $3)
+				ON CONFLICT (name_key) DO NOTHING
+				RETURNING id, name, name_key
+			)
+			INSERT INTO service_aliases (alias_key, alias, service_id)
+			SELECT name_key, name, id FROM created
+			ON CONFLICT (alias_key) DO NOTHING
+		`
+		if _, err = q.ExecContext(ctx, insert, uuid.New(), name, key); err != nil {
+			log.Error().Err(err).Str("service_name", name).Msg("Failed to create catalog service")
+			return fmt.Errorf("failed to create catalog service: %w", err)
+		}
+		err = sqlx.GetContext(ctx, q, &found, lookup, key)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("service_name", subscription.ServiceName).Msg("Failed to resolve catalog service")
+		return fmt.Errorf("failed to resolve catalog service: %w", err)
+	}
+
+	subscription.ServiceID = &found.ID
+	subscription.ServiceName = found.Name
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditSnapshot снимок подписки в журнале, содержащий все фрагменты JSON
+type auditSnapshot []string
+
+func (a auditSnapshot) Match(v driver.Value) bool {
+	data, ok := v.(string)
+	if !ok {
+		return false
+	}
+	for _, part := range a {
+		if !strings.Contains(data, part) {
+			return false
+		}
+	}
+	return true
+}
+
+// expectServiceLookup ожидает поиск сервиса каталога по нормализованному названию подписки
+func expectServiceLookup(mock sqlmock.Sqlmock, key string, id uuid.UUID, name string) {
+	mock.ExpectQuery(`FROM service_aliases a JOIN services s ON s.id = a.service_id WHERE a.alias_key = \$1`).
+		WithArgs(key).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(id, name))
+}
+
+func TestResolveService_NewName(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctx := context.Background()
+	serviceID := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+
+	// Неизвестное название заводится в каталог, подписка получает нормализованное написание
+	mock.ExpectQuery(`WHERE a.alias_key = \$1`).
+		WithArgs("yandex plus").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectExec(`INSERT INTO services \(id, name, name_key\) VALUES \(\$1, \$2, \$3\) ON CONFLICT \(name_key\) DO NOTHING(.+)INSERT INTO service_aliases`).
+		WithArgs(sqlmock.AnyArg(), "Yandex Plus", "yandex plus").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectServiceLookup(mock, "yandex plus", serviceID, "Yandex Plus")
+
+	sub := &models.Subscription{ServiceName: " Yandex   Plus "}
+	require.NoError(t, resolveService(ctx, db, sub))
+	assert.Equal(t, "Yandex Plus", sub.ServiceName)
+	assert.Equal(t, &serviceID, sub.ServiceID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveService_Alias(t *testing.T) {
+	db, mock := newMockDB(t)
+	serviceID := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+
+	// Псевдоним заменяется каноническим названием
+	expectServiceLookup(mock, "яндекс плюс", serviceID, "Yandex Plus")
+
+	sub := &models.Subscription{ServiceName: "Яндекс Плюс"}
+	require.NoError(t, resolveService(context.Background(), db, sub))
+	assert.Equal(t, "Yandex Plus", sub.ServiceName)
+	assert.Equal(t, &serviceID, sub.ServiceID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatalogRepository_Create(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewCatalogRepository(db)
+	price := 299
+	service := &models.Service{
+		ID:           uuid.MustParse("33333333-3333-3333-3333-333333333333"),
+		Name:         "Yandex Plus",
+		Aliases:      []string{"Яндекс Плюс"},
+		Category:     "music",
+		DefaultPrice: &price,
+		Currency:     "RUB",
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO services").
+		WithArgs(service.ID, "Yandex Plus", "yandex plus", "music", &price, "RUB", service.CreatedAt, service.UpdatedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO service_aliases").
+		WithArgs("yandex plus", "Yandex Plus", service.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO service_aliases").
+		WithArgs("яндекс плюс", "Яндекс Плюс", service.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.Create(context.Background(), service))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatalogRepository_Create_NameTaken(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewCatalogRepository(db)
+	service := &models.Service{ID: uuid.New(), Name: "Okko", Aliases: []string{"Yandex Plus"}, Currency: "RUB"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO services").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO service_aliases").
+		WithArgs("okko", "Okko", service.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO service_aliases").
+		WithArgs("yandex plus", "Yandex Plus", service.ID).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	err := repo.Create(context.Background(), service)
+	assert.ErrorIs(t, err, ErrServiceNameTaken)
+	assert.Contains(t, err.Error(), `"Yandex Plus"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatalogRepository_GetAll(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewCatalogRepository(db)
+	id := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+
+	// Поиск идет по всем названиям сервиса
+	mock.ExpectQuery(`WHERE s.id IN \(SELECT service_id FROM service_aliases WHERE alias_key LIKE \$1\) AND s.category = \$2 GROUP BY s.id ORDER BY s.name_key$`).
+		WithArgs("%плюс%", "music").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "aliases", "category", "default_price", "currency", "created_at", "updated_at"}).
+			AddRow(id, "Yandex Plus", "{Яндекс Плюс}", "music", nil, "RUB", time.Now(), time.Now()))
+
+	services, err := repo.GetAll(context.Background(), &models.ServiceFilter{Search: "Плюс", Category: "music"})
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, []string{"Яндекс Плюс"}, []string(services[0].Aliases))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatalogRepository_Update(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewCatalogRepository(db)
+	service := &models.Service{ID: uuid.MustParse("33333333-3333-3333-3333-333333333333"), Name: "Кинопоиск", Aliases: []string{"Kinopoisk"}, Currency: "RUB"}
+
+	// Новое каноническое название переходит в подписки сервиса
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE services SET name = \\$1, name_key = \\$2(.+)RETURNING created_at, updated_at").
+		WithArgs("Кинопоиск", "кинопоиск", "", nil, "RUB", service.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+	mock.ExpectExec("DELETE FROM service_aliases WHERE service_id = \\$1").
+		WithArgs(service.ID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO service_aliases").
+		WithArgs("кинопоиск", "Кинопоиск", service.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO service_aliases").
+		WithArgs("kinopoisk", "Kinopoisk", service.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Каждая переименованная подписка попадает в журнал изменений
+	subID := uuid.New()
+	mock.ExpectQuery("SELECT .+ FROM subscriptions WHERE service_id = \\$1 AND \\(service_id <> \\$2 OR service_name <> \\$3\\) ORDER BY id FOR UPDATE").
+		WithArgs(service.ID, service.ID, "Кинопоиск").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "service_name", "service_id", "price", "currency", "billing_period", "user_id", "start_date", "version"}).
+			AddRow(subID, "Kinopoisk", service.ID, 300, "RUB", "monthly", uuid.New(), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 2))
+	mock.ExpectQuery("UPDATE subscriptions SET service_id = \\$1, service_name = \\$2(.+)WHERE id = ANY\\(\\$3::uuid\\[\\]\\) RETURNING id, updated_at, version").
+		WithArgs(service.ID, "Кинопоиск", pq.Array([]string{subID.String()})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at", "version"}).AddRow(subID, time.Now(), 3))
+	mock.ExpectExec("INSERT INTO subscription_audit").
+		WithArgs(subID, models.AuditUpdate, reqctx.SystemActor, "", sqlmock.AnyArg(), auditSnapshot{`"service_name":"Кинопоиск"`, `"version":3`}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.Update(context.Background(), service))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatalogRepository_Delete_InUse(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewCatalogRepository(db)
+	id := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM services WHERE id = \\$1").
+		WithArgs(id).
+		WillReturnError(&pq.Error{Code: "23503"})
+	mock.ExpectRollback()
+
+	assert.ErrorIs(t, repo.Delete(context.Background(), id, nil), ErrServiceInUse)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatalogRepository_Delete_Merge(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewCatalogRepository(db)
+	id, target := uuid.New(), uuid.New()
+
+	// Подписки и названия переходят к целевому сервису, затем исходный удаляется
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM services WHERE id = \\$1 FOR UPDATE").
+		WithArgs(target).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Yandex Plus"))
+	mock.ExpectExec("UPDATE service_aliases SET service_id = \\$1 WHERE service_id = \\$2").
+		WithArgs(target, id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Подписок у сервиса нет: переименовывать и писать в журнал нечего
+	mock.ExpectQuery("SELECT .+ FROM subscriptions WHERE service_id = \\$1(.+)FOR UPDATE").
+		WithArgs(id, target, "Yandex Plus").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec("DELETE FROM services WHERE id = \\$1").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.Delete(context.Background(), id, &target))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCatalogRepository_Delete_MergeTargetNotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewCatalogRepository(db)
+	id, target := uuid.New(), uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM services WHERE id = \\$1 FOR UPDATE").
+		WithArgs(target).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	mock.ExpectRollback()
+
+	assert.ErrorIs(t, repo.Delete(context.Background(), id, &target), ErrServiceNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type chargeRepository struct {
+	db *sqlx.DB
+}
+
+func NewChargeRepository(db *sqlx.DB) ChargeRepository {
+	return &chargeRepository{db: db}
+}
+
+// replaceCharges заменяет начисления подписки в транзакции tx
+func replaceCharges(ctx context.Context, tx *sqlx.Tx, subscriptionID uuid.UUID, charges []models.Charge) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM charges WHERE subscription_id = $1`, subscriptionID)
+	if err != nil {
+		log.Error().Err(err).Str("subscription_id", subscriptionID.String()).Msg("Failed to delete charges")
+		return fmt.Errorf("failed to delete charges: %w", err)
+	}
+
+	query := `
+		INSERT INTO charges (subscription_id, period_start, period_end, cycle_days, amount, currency)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	for _, charge := range charges {
+		_, err = tx.ExecContext(ctx, query,
+			subscriptionID,
+			charge.PeriodStart,
+			charge.PeriodEnd,
+			charge.CycleDays,
+			charge.Amount,
+			charge.Currency,
+		)
+		if err != nil {
+			log.Error().Err(err).Str("subscription_id", subscriptionID.String()).Msg("Failed to save charge")
+			return fmt.Errorf("failed to save charge: %w", err)
+		}
+	}
+
+	log.Debug().
+		Str("subscription_id", subscriptionID.String()).
+		Int("count", len(charges)).
+		Msg("Charges replaced")
+	return nil
+}
+
+// GetBySubscription начисления подписки по возрастанию даты
+func (r *chargeRepository) GetBySubscription(ctx context.Context, subscriptionID uuid.UUID) ([]models.Charge, error) {
+	query := `
+		SELECT subscription_id, period_start, period_end, cycle_days, amount, currency
+		FROM charges
+		WHERE subscription_id = $1
+		ORDER BY period_start
+	`
+
+	var charges []models.Charge
+	err := r.db.SelectContext(ctx, &charges, query, subscriptionID)
+	if err != nil {
+		log.Error().Err(err).Str("subscription_id", subscriptionID.String()).Msg("Failed to get charges")
+		return nil, fmt.Errorf("failed to get charges: %w", err)
+	}
+
+	return charges, nil
+}
+
+// NextByUser одним запросом вместо GetBySubscription на каждую подписку пользователя
+func (r *chargeRepository) NextByUser(ctx context.Context, userID uuid.UUID, after time.Time) ([]models.Charge, error) {
+	query := `
+		SELECT DISTINCT ON (c.subscription_id) c.subscription_id, c.period_start, c.period_end, c.cycle_days, c.amount, c.currency
+		FROM charges c
+		JOIN subscriptions s ON s.id = c.subscription_id
+		WHERE s.user_id = $1 AND s.deleted_at IS NULL AND c.period_start > $2
+		ORDER BY c.subscription_id, c.period_start
+	`
+
+	charges := []models.Charge{}
+	err := r.db.SelectContext(ctx, &charges, query, userID, after)
+	if err != nil {
+		log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to get next charges")
+		return nil, fmt.Errorf("failed to get next charges: %w", err)
+	}
+
+	return charges, nil
+}
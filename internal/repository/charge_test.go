@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceCharges(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctx := context.Background()
+	subID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	jan := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC)
+
+	charges := []models.Charge{
+		{SubscriptionID: subID, PeriodStart: jan, PeriodEnd: feb.AddDate(0, 0, -1), CycleDays: 31, Amount: 400, Currency: "RUB"},
+		{SubscriptionID: subID, PeriodStart: feb, PeriodEnd: feb.AddDate(0, 1, -1), CycleDays: 28, Amount: 400, Currency: "RUB"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM charges WHERE subscription_id").
+		WithArgs(subID).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("INSERT INTO charges").
+		WithArgs(subID, jan, feb.AddDate(0, 0, -1), 31, 400, "RUB").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO charges").
+		WithArgs(subID, feb, feb.AddDate(0, 1, -1), 28, 400, "RUB").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tx, err := db.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, replaceCharges(ctx, tx, subID, charges))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplaceCharges_Error(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctx := context.Background()
+	subID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM charges").
+		WithArgs(subID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO charges").
+		WillReturnError(sql.ErrConnDone)
+
+	tx, err := db.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	err = replaceCharges(ctx, tx, subID, []models.Charge{{PeriodStart: time.Now(), PeriodEnd: time.Now(), CycleDays: 30, Amount: 1, Currency: "RUB"}})
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChargeRepository_GetBySubscription(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewChargeRepository(db)
+	ctx := context.Background()
+	subID := uuid.New()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"subscription_id", "period_start", "period_end", "cycle_days", "amount", "currency"}).
+		AddRow(subID, start, start.AddDate(1, 0, -1), 365, 1200, "RUB")
+	mock.ExpectQuery("SELECT .+ FROM charges WHERE subscription_id = \\$1 ORDER BY period_start").
+		WithArgs(subID).
+		WillReturnRows(rows)
+
+	charges, err := repo.GetBySubscription(ctx, subID)
+	require.NoError(t, err)
+	require.Len(t, charges, 1)
+	assert.Equal(t, 1200, charges[0].Amount)
+	assert.Equal(t, 365, charges[0].CycleDays)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChargeRepository_NextByUser(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewChargeRepository(db)
+	userID := uuid.New()
+	subID := uuid.New()
+	today := time.Date(2025, 5, 15, 0, 0, 0, 0, time.UTC)
+	next := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// Одно ближайшее начисление на подписку, без запроса на каждую
+	rows := sqlmock.NewRows([]string{"subscription_id", "period_start", "period_end", "cycle_days", "amount", "currency"}).
+		AddRow(subID, next, next.AddDate(0, 1, -1), 30, 400, "RUB")
+	mock.ExpectQuery(`SELECT DISTINCT ON \(c.subscription_id\) .+ WHERE s.user_id = \$1 AND s.deleted_at IS NULL AND c.period_start > \$2 ORDER BY c.subscription_id, c.period_start`).
+		WithArgs(userID, today).
+		WillReturnRows(rows)
+
+	charges, err := repo.NextByUser(context.Background(), userID, today)
+	require.NoError(t, err)
+	require.Len(t, charges, 1)
+	assert.Equal(t, subID, charges[0].SubscriptionID)
+	assert.Equal(t, next, charges[0].PeriodStart)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+type exchangeRateRepository struct {
+	db *sqlx.DB
+}
+
+func NewExchangeRateRepository(db *sqlx.DB) ExchangeRateRepository {
+	return &exchangeRateRepository{db: db}
+}
+
+// Upsert сохраняет курсы одной транзакцией, курс на ту же дату перезаписывается
+func (r *exchangeRateRepository) Upsert(ctx context.Context, rates []models.ExchangeRate) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO exchange_rates (base_currency, quote_currency, rate_date, rate)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (base_currency, quote_currency, rate_date) DO UPDATE SET rate = EXCLUDED.rate
+	`
+
+	for _, rate := range rates {
+		_, err = tx.ExecContext(ctx, query, rate.BaseCurrency, rate.QuoteCurrency, rate.Date, rate.Rate)
+		if err != nil {
+			log.Error().Err(err).
+				Str("base_currency", rate.BaseCurrency).
+				Str("quote_currency", rate.QuoteCurrency).
+				Msg("Failed to save exchange rate")
+			return fmt.Errorf("failed to save exchange rate: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Debug().Int("count", len(rates)).Msg("Exchange rates saved")
+	return nil
+}
+
+// GetAll with filters
+func (r *exchangeRateRepository) GetAll(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error) {
+	var conditions []string
+	var args []interface{}
+
+	query := `
+		SELECT base_currency, quote_currency, rate_date, rate
+		FROM exchange_rates
+	`
+
+	if filter.BaseCurrency != "" {
+		args = append(args, filter.BaseCurrency)
+		conditions = append(conditions, fmt.Sprintf("base_currency = $%d", len(args)))
+	}
+
+	if filter.QuoteCurrency != "" {
+		args = append(args, filter.QuoteCurrency)
+		conditions = append(conditions, fmt.Sprintf("quote_currency = $%d", len(args)))
+	}
+
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("rate_date >= $%d", len(args)))
+	}
+
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("rate_date <= $%d", len(args)))
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY rate_date DESC, base_currency, quote_currency"
+
+	rates := []models.ExchangeRate{}
+	err := r.db.SelectContext(ctx, &rates, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get exchange rates")
+		return nil, fmt.Errorf("failed to get exchange rates: %w", err)
+	}
+
+	return rates, nil
+}
+
+// GetLatest
+func (r *exchangeRateRepository) GetLatest(ctx context.Context, base, quote string, on time.Time) (*models.ExchangeRate, error) {
+	query := `
+		SELECT base_currency, quote_currency, rate_date, rate
+		FROM exchange_rates
+		WHERE base_currency = $1 AND quote_currency = $2 AND rate_date <= $3
+		ORDER BY rate_date DESC
+		LIMIT 1
+	`
+
+	var rate models.ExchangeRate
+	err := r.db.GetContext(ctx, &rate, query, base, quote, on)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRateNotFound
+		}
+		log.Error().Err(err).Str("base_currency", base).Str("quote_currency", quote).Msg("Failed to get exchange rate")
+		return nil, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+
+	return &rate, nil
+}
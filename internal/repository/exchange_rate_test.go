@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeRateRepository_Upsert(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewExchangeRateRepository(db)
+	ctx := context.Background()
+	date := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	rates := []models.ExchangeRate{
+		{BaseCurrency: "USD", QuoteCurrency: "RUB", Date: date, Rate: 92.5},
+		{BaseCurrency: "EUR", QuoteCurrency: "RUB", Date: date, Rate: 100.1},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO exchange_rates .+ ON CONFLICT").
+		WithArgs("USD", "RUB", date, 92.5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO exchange_rates .+ ON CONFLICT").
+		WithArgs("EUR", "RUB", date, 100.1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.Upsert(ctx, rates)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExchangeRateRepository_Upsert_Error(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewExchangeRateRepository(db)
+	ctx := context.Background()
+	date := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO exchange_rates").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	err := repo.Upsert(ctx, []models.ExchangeRate{{BaseCurrency: "USD", QuoteCurrency: "RUB", Date: date, Rate: 92.5}})
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExchangeRateRepository_GetAll_Empty(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewExchangeRateRepository(db)
+
+	mock.ExpectQuery("SELECT .+ FROM exchange_rates WHERE base_currency = \\$1 ORDER BY rate_date DESC").
+		WithArgs("USD").
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency", "quote_currency", "rate_date", "rate"}))
+
+	rates, err := repo.GetAll(context.Background(), &models.ExchangeRateFilter{BaseCurrency: "USD"})
+	require.NoError(t, err)
+	// Пустой список отдается как [], а не null
+	data, err := json.Marshal(rates)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(data))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExchangeRateRepository_GetLatest(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewExchangeRateRepository(db)
+	ctx := context.Background()
+	on := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	date := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"base_currency", "quote_currency", "rate_date", "rate"}).
+		AddRow("USD", "RUB", date, "92.5000000000")
+	mock.ExpectQuery("SELECT .+ FROM exchange_rates .+ ORDER BY rate_date DESC LIMIT 1").
+		WithArgs("USD", "RUB", on).
+		WillReturnRows(rows)
+
+	rate, err := repo.GetLatest(ctx, "USD", "RUB", on)
+	require.NoError(t, err)
+	assert.Equal(t, date, rate.Date)
+	assert.Equal(t, 92.5, rate.Rate)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExchangeRateRepository_GetLatest_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewExchangeRateRepository(db)
+	ctx := context.Background()
+	on := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT .+ FROM exchange_rates").
+		WithArgs("USD", "RUB", on).
+		WillReturnError(sql.ErrNoRows)
+
+	rate, err := repo.GetLatest(ctx, "USD", "RUB", on)
+	assert.ErrorIs(t, err, ErrRateNotFound)
+	assert.Nil(t, rate)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
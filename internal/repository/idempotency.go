@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type idempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve занимает ключ за запросом. Истекшая запись с тем же ключом перезаписывается.
+// Если ключ уже занят, возвращает существующую запись; nil — ключ занят этим вызовом
+func (r *idempotencyRepository) Reserve(ctx context.Context, rec *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	query := `
+		INSERT INTO idempotency_keys (owner, key, request_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (owner, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status_code = NULL, response = NULL,
+			created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+	`
+
+	result, err := r.db.ExecContext(ctx, query, rec.Owner, rec.Key, rec.RequestHash, rec.CreatedAt, rec.ExpiresAt)
+	if err != nil {
+		log.Error().Err(err).Str("idempotency_key", rec.Key).Msg("Failed to reserve idempotency key")
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected > 0 {
+		return nil, nil
+	}
+
+	var existing models.IdempotencyRecord
+	err = r.db.GetContext(ctx, &existing, `
+		SELECT owner, key, request_hash, status_code, response, created_at, expires_at
+		FROM idempotency_keys
+		WHERE owner = $1 AND key = $2
+	`, rec.Owner, rec.Key)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Ключ освободили между запросами: для вызывающего он все еще занят, повтор его получит
+		busy := *rec
+		return &busy, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("idempotency_key", rec.Key).Msg("Failed to get idempotency key")
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	return &existing, nil
+}
+
+// Complete сохраняет ответ на запрос
+func (r *idempotencyRepository) Complete(ctx context.Context, owner, key string, status int, response []byte) error {
+	query := `UPDATE idempotency_keys SET status_code = $1, response = $2 WHERE owner = $3 AND key = $4`
+
+	if _, err := r.db.ExecContext(ctx, query, status, response, owner, key); err != nil {
+		log.Error().Err(err).Str("idempotency_key", key).Msg("Failed to save idempotent response")
+		return fmt.Errorf("failed to save idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release освобождает ключ незавершенного запроса, чтобы клиент мог повторить его
+func (r *idempotencyRepository) Release(ctx context.Context, owner, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE owner = $1 AND key = $2 AND status_code IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, owner, key); err != nil {
+		log.Error().Err(err).Str("idempotency_key", key).Msg("Failed to release idempotency key")
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired удаляет истекшие ключи, возвращает их число
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete expired idempotency keys")
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
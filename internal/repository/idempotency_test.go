@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyRepository_Reserve(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewIdempotencyRepository(db)
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rec := &models.IdempotencyRecord{Owner: "alice", Key: "k1", RequestHash: "hash", CreatedAt: now, ExpiresAt: now.Add(24 * time.Hour)}
+
+	// Ключ свободен
+	mock.ExpectExec("INSERT INTO idempotency_keys .+ ON CONFLICT \\(owner, key\\) DO UPDATE .+ WHERE idempotency_keys.expires_at <= EXCLUDED.created_at").
+		WithArgs(rec.Owner, rec.Key, rec.RequestHash, rec.CreatedAt, rec.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	existing, err := repo.Reserve(ctx, rec)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// Ключ занят завершенным запросом
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT .+ FROM idempotency_keys WHERE owner = \\$1 AND key = \\$2").
+		WithArgs("alice", "k1").
+		WillReturnRows(sqlmock.NewRows([]string{"owner", "key", "request_hash", "status_code", "response", "created_at", "expires_at"}).
+			AddRow("alice", "k1", "hash", 201, []byte(`{"id":"1"}`), now, now.Add(24*time.Hour)))
+
+	existing, err = repo.Reserve(ctx, rec)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	require.NotNil(t, existing.StatusCode)
+	assert.Equal(t, 201, *existing.StatusCode)
+	assert.JSONEq(t, `{"id":"1"}`, string(existing.Response))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotencyRepository_CompleteAndRelease(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewIdempotencyRepository(db)
+	ctx := context.Background()
+
+	mock.ExpectExec("UPDATE idempotency_keys SET status_code = \\$1, response = \\$2 WHERE owner = \\$3 AND key = \\$4").
+		WithArgs(201, []byte(`{}`), "alice", "k1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, repo.Complete(ctx, "alice", "k1", 201, []byte(`{}`)))
+
+	// Завершенный запрос освобождение не затрагивает
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE owner = \\$1 AND key = \\$2 AND status_code IS NULL").
+		WithArgs("alice", "k1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, repo.Release(ctx, "alice", "k1"))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,30 +3,122 @@ package repository
 import (
 	"context"
 	"em_tz_anvar/internal/models"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
-// SubscriptionRepository interface to work with subs
+// SubscriptionRepository interface to work with subs.
+// Create, Update и UpdateAtomically сверяют service_name с каталогом: подписка получает service_id
+// и каноническое название, неизвестное название заводится в каталог новым сервисом
 type SubscriptionRepository interface {
 	Create(ctx context.Context, subscription *models.Subscription) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	// GetOwner user_id подписки, в том числе удаленной в корзину
+	GetOwner(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
 	GetAll(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error)
-	Update(ctx context.Context, subscription *models.Subscription) error
+	// Count число подписок под фильтром GetAll без учета страницы
+	Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error)
 	// UpdateAtomically выполняет атомарное обновление подписки с SELECT FOR UPDATE
 	UpdateAtomically(ctx context.Context, id uuid.UUID, updateFn func(*models.Subscription) error) (*models.Subscription, error)
-	Delete(ctx context.Context, id uuid.UUID) error
-	GetTotalCost(ctx context.Context, filter *models.CostFilter) (int, error)
+	// Delete переносит подписку в корзину, Restore возвращает, Purge удаляет из корзины окончательно.
+	// Create, UpdateAtomically, Delete, Restore и Purge пишут запись в журнал изменений в той же транзакции
+	// и увеличивают Version. Delete с version != 0 при несовпадении версии возвращает ErrVersionMismatch
+	Delete(ctx context.Context, id uuid.UUID, version int) error
+	Restore(ctx context.Context, id uuid.UUID) error
+	Purge(ctx context.Context, id uuid.UUID) error
+	// GetPriceHistory история цен подписки, записывается в Create и UpdateAtomically
+	GetPriceHistory(ctx context.Context, id uuid.UUID) ([]models.PriceChange, error)
+	// StaleCharges ID действующих подписок, начавшихся не позже until, чей журнал начислений
+	// кончается раньше until (или раньше их end_date)
+	StaleCharges(ctx context.Context, until time.Time) ([]uuid.UUID, error)
+	// RebuildCharges перестраивает начисления подписки под блокировкой ее строки
+	RebuildCharges(ctx context.Context, id uuid.UUID) error
+	// FindOverlaps действующие подписки пользователя на тот же сервис, пересекающиеся с sub по периоду
+	FindOverlaps(ctx context.Context, sub *models.Subscription) ([]uuid.UUID, error)
+	// GetOverlaps все такие пересечения среди действующих подписок пользователя, по паре на пересечение
+	GetOverlaps(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error)
+	GetTotalCost(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error)
+	GetMonthlyCost(ctx context.Context, filter *models.CostFilter) ([]models.MonthlyCost, error)
+	GetCostGroups(ctx context.Context, filter *models.CostFilter) ([]models.CostGroup, error)
+}
+
+// ChargeBuilder раскладывает подписку на начисления по ее истории цен. SubscriptionRepository вызывает его
+// в транзакциях Create, UpdateAtomically и Restore, поэтому журнал начислений меняется вместе с подпиской
+type ChargeBuilder func(sub *models.Subscription, prices []models.PriceChange) []models.Charge
+
+// CatalogRepository каталог сервисов. Подписки заводят в него новые названия сами, см. SubscriptionRepository
+type CatalogRepository interface {
+	// Create и Update с названием или псевдонимом другого сервиса возвращают ErrServiceNameTaken
+	Create(ctx context.Context, service *models.Service) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error)
+	GetAll(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error)
+	Update(ctx context.Context, service *models.Service) error
+	// Delete с mergeInto != nil переносит подписки и названия сервиса в mergeInto, без него
+	// сервис с подписками не удаляется (ErrServiceInUse)
+	Delete(ctx context.Context, id uuid.UUID, mergeInto *uuid.UUID) error
+}
+
+// ExchangeRateRepository таблица курсов валют
+type ExchangeRateRepository interface {
+	Upsert(ctx context.Context, rates []models.ExchangeRate) error
+	GetAll(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error)
+	// GetLatest возвращает последний курс base->quote, действовавший на дату on
+	GetLatest(ctx context.Context, base, quote string, on time.Time) (*models.ExchangeRate, error)
+}
+
+// ChargeRepository журнал начислений по циклам подписок
+// Начисления пишет SubscriptionRepository в транзакциях изменения подписки, см. ChargeBuilder
+type ChargeRepository interface {
+	GetBySubscription(ctx context.Context, subscriptionID uuid.UUID) ([]models.Charge, error)
+	// NextByUser первое начисление после after у каждой подписки пользователя вне корзины
+	NextByUser(ctx context.Context, userID uuid.UUID, after time.Time) ([]models.Charge, error)
+}
+
+// AuditRepository журнал изменений подписок; записи пишет SubscriptionRepository в своих транзакциях
+type AuditRepository interface {
+	List(ctx context.Context, filter *models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+// APIKeyRepository ключи сервисных клиентов
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	GetAll(ctx context.Context) ([]models.APIKey, error)
+	Revoke(ctx context.Context, id uuid.UUID) error
+	Rotate(ctx context.Context, id uuid.UUID, prefix, hash string) (*models.APIKey, error)
+	TouchLastUsed(ctx context.Context, id uuid.UUID) error
+}
+
+// IdempotencyRepository ключи идемпотентности и сохраненные ответы
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, rec *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, owner, key string, status int, response []byte) error
+	Release(ctx context.Context, owner, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
 }
 
 // All repositories
 type Repository struct {
 	Subscription SubscriptionRepository
+	Catalog      CatalogRepository
+	Charge       ChargeRepository
+	ExchangeRate ExchangeRateRepository
+	Audit        AuditRepository
+	APIKey       APIKeyRepository
+	Idempotency  IdempotencyRepository
 }
 
-func NewRepository(db *sqlx.DB) *Repository {
+// NewRepository charges строит журнал начислений при изменении подписок, nil — журнал не ведется
+func NewRepository(db *sqlx.DB, charges ChargeBuilder) *Repository {
 	return &Repository{
-		Subscription: NewSubscriptionRepository(db),
+		Subscription: NewSubscriptionRepository(db, charges),
+		Catalog:      NewCatalogRepository(db),
+		Charge:       NewChargeRepository(db),
+		ExchangeRate: NewExchangeRateRepository(db),
+		Audit:        NewAuditRepository(db),
+		APIKey:       NewAPIKeyRepository(db),
+		Idempotency:  NewIdempotencyRepository(db),
 	}
 }
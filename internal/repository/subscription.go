@@ -6,29 +6,57 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"em_tz_anvar/internal/models"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 )
 
 var ErrNotFound = errors.New("subscription not found")
 
+// ErrNotDeleted подписка не в корзине
+var ErrNotDeleted = errors.New("subscription is not deleted")
+
+// ErrInvalidSort поле сортировки не из белого списка
+var ErrInvalidSort = errors.New("invalid sort")
+
+// ErrVersionMismatch подписку изменили после того, как клиент ее прочитал (If-Match не совпал)
+var ErrVersionMismatch = errors.New("subscription version mismatch")
+
 type subscriptionRepository struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	charges ChargeBuilder
 }
 
-func NewSubscriptionRepository(db *sqlx.DB) SubscriptionRepository {
-	return &subscriptionRepository{db: db}
+// NewSubscriptionRepository charges == nil — начисления не перестраиваются
+func NewSubscriptionRepository(db *sqlx.DB, charges ChargeBuilder) SubscriptionRepository {
+	return &subscriptionRepository{db: db, charges: charges}
 }
 
-// Create
+// Create сохраняет подписку, начальную цену в истории цен, начисления и запись журнала одной транзакцией
 func (r *subscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = resolveService(ctx, tx, subscription); err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO subscriptions (id, service_name, price, user_id, start_date, end_date, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO subscriptions (id, service_name, service_id, price, currency, billing_period, billing_months, user_id, start_date, end_date, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 
 	log.Debug().
@@ -36,15 +64,20 @@ func (r *subscriptionRepository) Create(ctx context.Context, subscription *model
 		Str("service_name", subscription.ServiceName).
 		Msg("Creating subscription")
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		subscription.ID,
 		subscription.ServiceName,
+		subscription.ServiceID,
 		subscription.Price,
+		subscription.Currency,
+		subscription.BillingPeriod,
+		subscription.BillingMonths,
 		subscription.UserID,
 		subscription.StartDate,
 		subscription.EndDate,
 		subscription.CreatedAt,
 		subscription.UpdatedAt,
+		subscription.Version,
 	)
 
 	if err != nil {
@@ -52,15 +85,32 @@ func (r *subscriptionRepository) Create(ctx context.Context, subscription *model
 		return fmt.Errorf("failed to create subscription: %w", err)
 	}
 
+	if err = savePrice(ctx, tx, subscription.ID, subscription.Price, subscription.StartDate); err != nil {
+		return err
+	}
+
+	if err = r.syncCharges(ctx, tx, subscription); err != nil {
+		return err
+	}
+
+	if err = writeAudit(ctx, tx, models.AuditCreate, subscription.ID, nil, subscription); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
 // GetByID
 func (r *subscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
 	query := `
-		SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at
+		SELECT id, service_name, service_id, price, currency, billing_period, billing_months, user_id, start_date, end_date, created_at, updated_at, deleted_at, version
 		FROM subscriptions
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	log.Debug().Str("subscription_id", id.String()).Msg("Getting subscription by ID")
@@ -78,34 +128,58 @@ func (r *subscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*mo
 	return &subscription, nil
 }
 
-// GetAll with filters
-func (r *subscriptionRepository) GetAll(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
-	var conditions []string
-	var args []interface{}
-	argNum := 1
+// GetOwner
+func (r *subscriptionRepository) GetOwner(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := r.db.GetContext(ctx, &userID, `SELECT user_id FROM subscriptions WHERE id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, ErrNotFound
+		}
+		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to get subscription owner")
+		return uuid.Nil, fmt.Errorf("failed to get subscription owner: %w", err)
+	}
+	return userID, nil
+}
 
-	query := `
-		SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at
-		FROM subscriptions
-	`
+// subscriptionSortColumns белый список сортировки: в SQL попадают только эти столбцы
+var subscriptionSortColumns = map[string]string{
+	models.SortPrice:       "price",
+	models.SortStartDate:   "start_date",
+	models.SortServiceName: "service_name",
+	models.SortCreatedAt:   "created_at",
+	models.SortDeletedAt:   "deleted_at",
+}
 
-	if filter.UserID != nil {
-		conditions = append(conditions, fmt.Sprintf("user_id = $%d", argNum))
-		args = append(args, *filter.UserID)
-		argNum++
+// GetAll with filters
+func (r *subscriptionRepository) GetAll(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
+	field, desc := filter.SortBy()
+	column, ok := subscriptionSortColumns[field]
+	// У активных подписок deleted_at пуст, сортировать по нему нечего
+	if !ok || (field == models.SortDeletedAt && !filter.Deleted) {
+		return nil, fmt.Errorf("%w: unsupported sort field %q", ErrInvalidSort, field)
 	}
-
-	if filter.ServiceName != "" {
-		conditions = append(conditions, fmt.Sprintf("service_name ILIKE $%d", argNum))
-		args = append(args, "%"+filter.ServiceName+"%")
-		argNum++
+	direction, compare := "ASC", ">"
+	if desc {
+		direction, compare = "DESC", "<"
 	}
 
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
+	conditions, args := subscriptionConditions(filter)
+	argNum := len(args) + 1
+
+	// Keyset: строки строго после последней выданной, id различает строки с одинаковым значением поля
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)", column, compare, argNum, argNum+1))
+		args = append(args, filter.After.Value, filter.After.ID)
+		argNum += 2
 	}
 
-	query += " ORDER BY created_at DESC"
+	query := `
+		SELECT id, service_name, service_id, price, currency, billing_period, billing_months, user_id, start_date, end_date, created_at, updated_at, deleted_at, version
+		FROM subscriptions
+	`
+	query += " WHERE " + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction)
 
 	if filter.Limit > 0 {
 		query += fmt.Sprintf(" LIMIT $%d", argNum)
@@ -113,7 +187,7 @@ func (r *subscriptionRepository) GetAll(ctx context.Context, filter *models.Subs
 		argNum++
 	}
 
-	if filter.Offset > 0 {
+	if filter.Offset > 0 && filter.After == nil {
 		query += fmt.Sprintf(" OFFSET $%d", argNum)
 		args = append(args, filter.Offset)
 	}
@@ -133,42 +207,96 @@ func (r *subscriptionRepository) GetAll(ctx context.Context, filter *models.Subs
 	return subscriptions, nil
 }
 
-// Update
-func (r *subscriptionRepository) Update(ctx context.Context, subscription *models.Subscription) error {
-	query := `
-		UPDATE subscriptions
-		SET service_name = $1, price = $2, start_date = $3, end_date = $4, updated_at = $5
-		WHERE id = $6
-	`
+// Count число подписок под фильтром без учета страницы (Limit, Offset, After) и сортировки
+func (r *subscriptionRepository) Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+	conditions, args := subscriptionConditions(filter)
+	query := "SELECT COUNT(*) FROM subscriptions WHERE " + strings.Join(conditions, " AND ")
 
-	log.Debug().
-		Str("subscription_id", subscription.ID.String()).
-		Msg("Updating subscription")
+	var total int
+	if err := r.db.GetContext(ctx, &total, query, args...); err != nil {
+		log.Error().Err(err).Msg("Failed to count subscriptions")
+		return 0, fmt.Errorf("failed to count subscriptions: %w", err)
+	}
+	return total, nil
+}
 
-	result, err := r.db.ExecContext(ctx, query,
-		subscription.ServiceName,
-		subscription.Price,
-		subscription.StartDate,
-		subscription.EndDate,
-		subscription.UpdatedAt,
-		subscription.ID,
-	)
+// likeEscaper экранирует спецсимволы LIKE, чтобы service_name искался как обычная подстрока
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
 
-	if err != nil {
-		log.Error().Err(err).Str("subscription_id", subscription.ID.String()).Msg("Failed to update subscription")
-		return fmt.Errorf("failed to update subscription: %w", err)
+// subscriptionConditions условия отбора списка. Значения фильтра передаются только параметрами
+func subscriptionConditions(filter *models.SubscriptionFilter) ([]string, []interface{}) {
+	var args []interface{}
+	// arg добавляет параметр и возвращает его плейсхолдер
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	// Корзина и активные подписки показываются раздельно
+	conditions := []string{"deleted_at IS NULL"}
+	if filter.Deleted {
+		conditions = []string{"deleted_at IS NOT NULL"}
 	}
 
-	if rowsAffected == 0 {
-		return ErrNotFound
+	if filter.UserID != nil {
+		conditions = append(conditions, "user_id = "+arg(*filter.UserID))
 	}
 
-	return nil
+	if len(filter.UserIDs) > 0 {
+		ids := make([]string, len(filter.UserIDs))
+		for i, id := range filter.UserIDs {
+			ids[i] = id.String()
+		}
+		conditions = append(conditions, "user_id = ANY("+arg(pq.Array(ids))+"::uuid[])")
+	}
+
+	if filter.ServiceID != nil {
+		conditions = append(conditions, "service_id = "+arg(*filter.ServiceID))
+	}
+
+	if filter.ServiceName != "" {
+		if filter.ServiceNameExact {
+			// Название или любой псевдоним сервиса каталога
+			conditions = append(conditions, "service_id IN (SELECT service_id FROM service_aliases WHERE alias_key = "+arg(models.ServiceKey(filter.ServiceName))+")")
+		} else {
+			conditions = append(conditions, "service_name ILIKE "+arg("%"+likeEscaper.Replace(filter.ServiceName)+"%"))
+		}
+	}
+
+	if filter.PriceMin != nil {
+		conditions = append(conditions, "price >= "+arg(*filter.PriceMin))
+	}
+	if filter.PriceMax != nil {
+		conditions = append(conditions, "price <= "+arg(*filter.PriceMax))
+	}
+
+	if filter.ActiveAt != nil {
+		p := arg(*filter.ActiveAt)
+		conditions = append(conditions, fmt.Sprintf("start_date <= %s AND (end_date IS NULL OR end_date >= %s)", p, p))
+	}
+
+	if filter.StartFrom != nil {
+		conditions = append(conditions, "start_date >= "+arg(*filter.StartFrom))
+	}
+	if filter.StartTo != nil {
+		conditions = append(conditions, "start_date <= "+arg(*filter.StartTo))
+	}
+	if filter.EndFrom != nil {
+		conditions = append(conditions, "end_date >= "+arg(*filter.EndFrom))
+	}
+	if filter.EndTo != nil {
+		conditions = append(conditions, "end_date <= "+arg(*filter.EndTo))
+	}
+
+	if filter.HasEndDate != nil {
+		if *filter.HasEndDate {
+			conditions = append(conditions, "end_date IS NOT NULL")
+		} else {
+			conditions = append(conditions, "end_date IS NULL")
+		}
+	}
+
+	return conditions, args
 }
 
 // UpdateAtomically выполняет атомарное обновление подписки в транзакции с SELECT FOR UPDATE
@@ -186,9 +314,9 @@ func (r *subscriptionRepository) UpdateAtomically(ctx context.Context, id uuid.U
 
 	// SELECT FOR UPDATE блокирует строку до завершения транзакции
 	query := `
-		SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at
+		SELECT id, service_name, service_id, price, currency, billing_period, billing_months, user_id, start_date, end_date, created_at, updated_at, deleted_at, version
 		FROM subscriptions
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 		FOR UPDATE
 	`
 
@@ -202,24 +330,42 @@ func (r *subscriptionRepository) UpdateAtomically(ctx context.Context, id uuid.U
 		return nil, fmt.Errorf("failed to get subscription: %w", err)
 	}
 
+	before := subscription
+
 	//Функция обновления
 	if err = updateFn(&subscription); err != nil {
 		return nil, err
 	}
 
+	// Строка заблокирована, версия не могла измениться с момента чтения
+	subscription.Version = before.Version + 1
+
+	// Новое название сверяется с каталогом, прежнее уже в нем
+	if subscription.ServiceName != before.ServiceName || subscription.ServiceID == nil {
+		if err = resolveService(ctx, tx, &subscription); err != nil {
+			return nil, err
+		}
+	}
+
 	// Обновляем запись
 	updateQuery := `
 		UPDATE subscriptions
-		SET service_name = $1, price = $2, start_date = $3, end_date = $4, updated_at = $5
-		WHERE id = $6
+		SET service_name = $1, service_id = $2, price = $3, currency = $4, billing_period = $5, billing_months = $6,
+			start_date = $7, end_date = $8, updated_at = $9, version = $10
+		WHERE id = $11
 	`
 
 	_, err = tx.ExecContext(ctx, updateQuery,
 		subscription.ServiceName,
+		subscription.ServiceID,
 		subscription.Price,
+		subscription.Currency,
+		subscription.BillingPeriod,
+		subscription.BillingMonths,
 		subscription.StartDate,
 		subscription.EndDate,
 		subscription.UpdatedAt,
+		subscription.Version,
 		subscription.ID,
 	)
 	if err != nil {
@@ -227,6 +373,25 @@ func (r *subscriptionRepository) UpdateAtomically(ctx context.Context, id uuid.U
 		return nil, fmt.Errorf("failed to update subscription: %w", err)
 	}
 
+	// Новая цена действует с PriceEffectiveFrom (по умолчанию с сегодняшнего дня), прошлые периоды не меняются
+	if subscription.Price != before.Price || subscription.PriceEffectiveFrom != nil {
+		effectiveFrom := time.Now().UTC().Truncate(24 * time.Hour)
+		if subscription.PriceEffectiveFrom != nil {
+			effectiveFrom = *subscription.PriceEffectiveFrom
+		}
+		if err = savePrice(ctx, tx, subscription.ID, subscription.Price, effectiveFrom); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = r.syncCharges(ctx, tx, &subscription); err != nil {
+		return nil, err
+	}
+
+	if err = writeAudit(ctx, tx, models.AuditUpdate, id, &before, &subscription); err != nil {
+		return nil, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		log.Error().Err(err).Msg("Failed to commit transaction")
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
@@ -236,76 +401,493 @@ func (r *subscriptionRepository) UpdateAtomically(ctx context.Context, id uuid.U
 	return &subscription, nil
 }
 
-// Delete
-func (r *subscriptionRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM subscriptions WHERE id = $1`
+// savePrice записывает цену в историю: цена действует с effectiveFrom и дальше, поэтому цена с той же
+// датой начала перезаписывается, а записи с более поздними датами удаляются
+func savePrice(ctx context.Context, tx *sqlx.Tx, id uuid.UUID, price int, effectiveFrom time.Time) error {
+	query := `
+		WITH superseded AS (
+			DELETE FROM subscription_price_history
+			WHERE subscription_id = $1 AND effective_from > $3
+		)
+		INSERT INTO subscription_price_history (subscription_id, price, effective_from)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (subscription_id, effective_from) DO UPDATE SET price = EXCLUDED.price, created_at = NOW()
+	`
 
-	log.Debug().Str("subscription_id", id.String()).Msg("Deleting subscription")
+	if _, err := tx.ExecContext(ctx, query, id, price, effectiveFrom); err != nil {
+		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to save price history")
+		return fmt.Errorf("failed to save price history: %w", err)
+	}
+	return nil
+}
+
+// priceHistoryQuery история цен подписки по возрастанию даты начала действия
+const priceHistoryQuery = `
+	SELECT subscription_id, price, effective_from, created_at
+	FROM subscription_price_history
+	WHERE subscription_id = $1
+	ORDER BY effective_from
+`
+
+// syncCharges перестраивает начисления подписки в транзакции ее изменения по истории цен из той же транзакции
+func (r *subscriptionRepository) syncCharges(ctx context.Context, tx *sqlx.Tx, sub *models.Subscription) error {
+	if r.charges == nil {
+		return nil
+	}
+
+	var prices []models.PriceChange
+	if err := tx.SelectContext(ctx, &prices, priceHistoryQuery, sub.ID); err != nil {
+		log.Error().Err(err).Str("subscription_id", sub.ID.String()).Msg("Failed to get price history")
+		return fmt.Errorf("failed to get price history: %w", err)
+	}
+
+	return replaceCharges(ctx, tx, sub.ID, r.charges(sub, prices))
+}
+
+// StaleCharges находит подписки, у которых нет начисления, покрывающего until (у завершенных — end_date):
+// горизонт бессрочной подписки устаревает со временем, а у подписок до появления журнала начислений нет вовсе
+func (r *subscriptionRepository) StaleCharges(ctx context.Context, until time.Time) ([]uuid.UUID, error) {
+	query := `
+		SELECT s.id
+		FROM subscriptions s
+		WHERE s.deleted_at IS NULL AND s.start_date <= $1
+			AND NOT EXISTS (
+				SELECT 1 FROM charges c
+				WHERE c.subscription_id = s.id AND c.period_end >= LEAST(s.end_date, $1)
+			)
+	`
+
+	var ids []uuid.UUID
+	if err := r.db.SelectContext(ctx, &ids, query, until); err != nil {
+		log.Error().Err(err).Msg("Failed to find stale charges")
+		return nil, fmt.Errorf("failed to find stale charges: %w", err)
+	}
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	return ids, nil
+}
+
+// RebuildCharges перестраивает начисления подписки; блокировка строки не дает параллельному
+// изменению подписки записать начисления по устаревшему состоянию
+func (r *subscriptionRepository) RebuildCharges(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to delete subscription")
-		return fmt.Errorf("failed to delete subscription: %w", err)
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
 
-	rowsAffected, err := result.RowsAffected()
+	sub, err := lockSubscription(ctx, tx, id)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return err
+	}
+
+	if err = r.syncCharges(ctx, tx, sub); err != nil {
+		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrNotFound
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	return nil
 }
 
-// GetTotalCost
-func (r *subscriptionRepository) GetTotalCost(ctx context.Context, filter *models.CostFilter) (int, error) {
-	var conditions []string
-	var args []interface{}
-	argNum := 1
+// GetPriceHistory история цен подписки по возрастанию даты начала действия
+func (r *subscriptionRepository) GetPriceHistory(ctx context.Context, id uuid.UUID) ([]models.PriceChange, error) {
+	var history []models.PriceChange
+	err := r.db.SelectContext(ctx, &history, priceHistoryQuery, id)
+	if err != nil {
+		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to get price history")
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
 
-	// Base query
+	return history, nil
+}
+
+// FindOverlaps ID действующих подписок того же пользователя на сервис с названием sub.ServiceName
+// (или его псевдонимом), период которых пересекается с периодом sub. Сама sub не учитывается
+func (r *subscriptionRepository) FindOverlaps(ctx context.Context, sub *models.Subscription) ([]uuid.UUID, error) {
 	query := `
-		SELECT COALESCE(SUM(price * 
-			(EXTRACT(YEAR FROM LEAST(COALESCE(end_date, $1::timestamp), $1::timestamp)) * 12 + 
-			 EXTRACT(MONTH FROM LEAST(COALESCE(end_date, $1::timestamp), $1::timestamp)) -
-			 EXTRACT(YEAR FROM GREATEST(start_date, $2::timestamp)) * 12 - 
-			 EXTRACT(MONTH FROM GREATEST(start_date, $2::timestamp)) + 1)
-		), 0)::integer as total_cost
+		SELECT id
 		FROM subscriptions
-		WHERE start_date <= $1 AND (end_date IS NULL OR end_date >= $2)
+		WHERE user_id = $1 AND id <> $2 AND deleted_at IS NULL
+			AND service_id IN (SELECT service_id FROM service_aliases WHERE alias_key = $3)
+			AND start_date <= COALESCE($4::date, 'infinity')
+			AND COALESCE(end_date, 'infinity') >= $5
+		ORDER BY start_date, id
 	`
 
-	args = append(args, filter.EndDate, filter.StartDate)
-	argNum = 3
+	var ids []uuid.UUID
+	err := r.db.SelectContext(ctx, &ids, query, sub.UserID, sub.ID, models.ServiceKey(sub.ServiceName), sub.EndDate, sub.StartDate)
+	if err != nil {
+		log.Error().Err(err).Str("user_id", sub.UserID.String()).Msg("Failed to find overlapping subscriptions")
+		return nil, fmt.Errorf("failed to find overlapping subscriptions: %w", err)
+	}
 
-	if filter.UserID != nil {
-		conditions = append(conditions, fmt.Sprintf("user_id = $%d", argNum))
-		args = append(args, *filter.UserID)
-		argNum++
+	return ids, nil
+}
+
+// GetOverlaps пары действующих подписок пользователя на один сервис с пересекающимися периодами
+func (r *subscriptionRepository) GetOverlaps(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error) {
+	// LEAST пропускает NULL: конец пересечения — более ранний из заданных концов
+	query := `
+		SELECT a.service_id, sv.name AS service_name, a.id AS subscription_id, b.id AS overlapping_id,
+			GREATEST(a.start_date, b.start_date) AS overlap_start,
+			LEAST(a.end_date, b.end_date) AS overlap_end
+		FROM subscriptions a
+		JOIN subscriptions b ON b.user_id = a.user_id AND b.service_id = a.service_id
+			AND (b.start_date, b.id) > (a.start_date, a.id)
+		JOIN services sv ON sv.id = a.service_id
+		WHERE a.user_id = $1 AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+			AND b.start_date <= COALESCE(a.end_date, 'infinity')
+		ORDER BY sv.name_key, overlap_start, a.id, b.id
+	`
+
+	var overlaps []models.SubscriptionOverlap
+	err := r.db.SelectContext(ctx, &overlaps, query, userID)
+	if err != nil {
+		log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to get overlapping subscriptions")
+		return nil, fmt.Errorf("failed to get overlapping subscriptions: %w", err)
 	}
 
-	if filter.ServiceName != "" {
-		conditions = append(conditions, fmt.Sprintf("service_name ILIKE $%d", argNum))
-		args = append(args, "%"+filter.ServiceName+"%")
+	return overlaps, nil
+}
+
+// lockSubscription блокирует строку подписки (в том числе удаленной) до конца транзакции
+func lockSubscription(ctx context.Context, tx *sqlx.Tx, id uuid.UUID) (*models.Subscription, error) {
+	query := `
+		SELECT id, service_name, service_id, price, currency, billing_period, billing_months, user_id, start_date, end_date, created_at, updated_at, deleted_at, version
+		FROM subscriptions
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	var subscription models.Subscription
+	if err := tx.GetContext(ctx, &subscription, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to lock subscription")
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// Delete переносит подписку в корзину: строка и журнал начислений сохраняются, но не видны в списках и отчетах.
+// version != 0 — удалить, только если подписка не менялась с этой версии
+func (r *subscriptionRepository) Delete(ctx context.Context, id uuid.UUID, version int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	log.Debug().Str("subscription_id", id.String()).Msg("Deleting subscription")
+
+	before, err := lockSubscription(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		err = ErrNotFound
+		return err
+	}
+	if version != 0 && before.Version != version {
+		err = ErrVersionMismatch
+		return err
+	}
+
+	after := *before
+	after.Version++
+	err = tx.GetContext(ctx, &after.DeletedAt, `UPDATE subscriptions SET deleted_at = NOW(), version = version + 1 WHERE id = $1 RETURNING deleted_at`, id)
+	if err != nil {
+		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to delete subscription")
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+
+	if err = writeAudit(ctx, tx, models.AuditDelete, id, before, &after); err != nil {
+		return err
 	}
 
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Restore возвращает подписку из корзины
+func (r *subscriptionRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	log.Debug().Str("subscription_id", id.String()).Msg("Restoring subscription")
+
+	before, err := lockSubscription(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt == nil {
+		err = ErrNotFound
+		return err
+	}
+
+	after := *before
+	after.DeletedAt = nil
+	after.Version++
+	err = tx.GetContext(ctx, &after.UpdatedAt, `UPDATE subscriptions SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE id = $1 RETURNING updated_at`, id)
+	if err != nil {
+		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to restore subscription")
+		return fmt.Errorf("failed to restore subscription: %w", err)
+	}
+
+	// Горизонт бессрочной подписки мог устареть, пока она была в корзине
+	if err = r.syncCharges(ctx, tx, &after); err != nil {
+		return err
+	}
+
+	if err = writeAudit(ctx, tx, models.AuditRestore, id, before, &after); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Purge окончательно удаляет подписку из корзины вместе с начислениями и историей цен.
+// Активную подписку сначала нужно удалить через Delete; журнал изменений сохраняется
+func (r *subscriptionRepository) Purge(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	log.Debug().Str("subscription_id", id.String()).Msg("Purging subscription")
+
+	before, err := lockSubscription(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt == nil {
+		err = ErrNotDeleted
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM subscriptions WHERE id = $1`, id); err != nil {
+		log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to purge subscription")
+		return fmt.Errorf("failed to purge subscription: %w", err)
+	}
+
+	if err = writeAudit(ctx, tx, models.AuditPurge, id, before, nil); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("Failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// costEntriesCTE выбирает из журнала charges начисления за период [$2, $1].
+// Какие начисления и в каком размере попадают в entries, задает entriesByProration.
+// Условия фильтра подставляются вместо %s
+const costEntriesCTE = `
+	WITH months AS (
+		SELECT m::date AS month_start, (m + interval '1 month' - interval '1 day')::date AS month_end
+		FROM generate_series(date_trunc('month', $2::date), $1::date, interval '1 month') AS m
+	), entries AS (%s)
+`
+
+// entriesByProration без пропорции цикл учитывается полной суммой в месяце списания, если списание попало
+// в период. При посуточном режиме сумма цикла делится по месяцам пропорционально оплаченным дням внутри периода
+func entriesByProration(proration string) string {
+	if proration == models.ProrationDaily {
+		return `
+		SELECT s.id, s.service_name, s.user_id, c.currency, month_start AS month,
+			c.amount * (
+				LEAST(c.period_end, month_end, $1::date) - GREATEST(c.period_start, month_start, $2::date) + 1
+			)::numeric / c.cycle_days AS amount
+		FROM charges c
+		JOIN subscriptions s ON s.id = c.subscription_id AND s.deleted_at IS NULL
+		JOIN months ON c.period_start <= month_end AND c.period_end >= month_start
+		WHERE c.period_start <= $1 AND c.period_end >= $2 %s`
+	}
+	return `
+		SELECT s.id, s.service_name, s.user_id, c.currency, date_trunc('month', c.period_start)::date AS month,
+			c.amount::numeric AS amount
+		FROM charges c
+		JOIN subscriptions s ON s.id = c.subscription_id AND s.deleted_at IS NULL
+		WHERE c.period_start BETWEEN $2 AND $1 %s`
+}
+
+// costQuery собирает запрос поверх CTE entries: filter задаёт период, режим и условия, selectSQL — итоговую выборку
+func costQuery(filter *models.CostFilter, selectSQL string) (string, []interface{}) {
+	args := []interface{}{filter.EndDate, filter.StartDate}
+	conditions, args := costConditions(filter, args)
+
+	where := ""
 	if len(conditions) > 0 {
-		query += " AND " + strings.Join(conditions, " AND ")
+		where = "AND " + strings.Join(conditions, " AND ")
 	}
 
+	return fmt.Sprintf(costEntriesCTE, fmt.Sprintf(entriesByProration(filter.Proration), where)) + selectSQL, args
+}
+
+// GetTotalCost считает стоимость за период отдельно по каждой валюте
+func (r *subscriptionRepository) GetTotalCost(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error) {
+	query, args := costQuery(filter, `
+		SELECT currency, ROUND(SUM(amount))::integer AS total_cost
+		FROM entries
+		GROUP BY currency
+		ORDER BY currency
+	`)
+
 	log.Debug().
 		Interface("filter", filter).
 		Msg("Calculating total cost")
 
-	var totalCost int
-	err := r.db.GetContext(ctx, &totalCost, query, args...)
+	var totals []models.CurrencyCost
+	err := r.db.SelectContext(ctx, &totals, query, args...)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to calculate total cost")
-		return 0, fmt.Errorf("failed to calculate total cost: %w", err)
+		return nil, fmt.Errorf("failed to calculate total cost: %w", err)
+	}
+
+	return totals, nil
+}
+
+// GetCostGroups считает стоимость за период в разрезе filter.GroupBy и валюты.
+// Группы ранжируются по убыванию суммы внутри своей валюты, filter.Top ограничивает число групп на валюту
+func (r *subscriptionRepository) GetCostGroups(ctx context.Context, filter *models.CostFilter) ([]models.CostGroup, error) {
+	col, ok := costGroupColumns[filter.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cost grouping %q", filter.GroupBy)
+	}
+
+	// Ранг внутри валюты: суммы в разных валютах между собой не сравниваются
+	query, args := costQuery(filter, fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT %s AS group_key, currency,
+				ROUND(SUM(amount))::integer AS total_cost,
+				COUNT(DISTINCT (id, month)) AS months,
+				COUNT(DISTINCT id) AS subscription_count,
+				ROW_NUMBER() OVER (PARTITION BY currency ORDER BY SUM(amount) DESC, %s) AS rank
+			FROM entries
+			GROUP BY %s, currency
+		) AS ranked
+	`, col, col, col))
+
+	if filter.Top > 0 {
+		args = append(args, filter.Top)
+		query += fmt.Sprintf(" WHERE rank <= $%d", len(args))
+	}
+
+	query += " ORDER BY currency, rank"
+
+	log.Debug().
+		Interface("filter", filter).
+		Msg("Calculating cost groups")
+
+	var groups []models.CostGroup
+	err := r.db.SelectContext(ctx, &groups, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to calculate cost groups")
+		return nil, fmt.Errorf("failed to calculate cost groups: %w", err)
+	}
+
+	return groups, nil
+}
+
+// costGroupColumns колонки, по которым разрешено группировать стоимость
+var costGroupColumns = map[string]string{
+	models.CostGroupByServiceName: "service_name",
+	models.CostGroupByUserID:      "user_id::text",
+}
+
+// GetMonthlyCost раскладывает стоимость по месяцам периода и валютам (и по filter.GroupBy, если задан)
+func (r *subscriptionRepository) GetMonthlyCost(ctx context.Context, filter *models.CostFilter) ([]models.MonthlyCost, error) {
+	keyExpr := "''"
+	groupBy := "month, currency"
+	if col, ok := costGroupColumns[filter.GroupBy]; ok {
+		keyExpr = col
+		groupBy = "month, " + col + ", currency"
+	}
+
+	query, args := costQuery(filter, fmt.Sprintf(`
+		SELECT month, %s AS group_key, currency, ROUND(SUM(amount))::integer AS total_cost
+		FROM entries
+		GROUP BY %s
+		ORDER BY %s
+	`, keyExpr, groupBy, groupBy))
+
+	log.Debug().
+		Interface("filter", filter).
+		Msg("Calculating monthly cost")
+
+	var months []models.MonthlyCost
+	err := r.db.SelectContext(ctx, &months, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to calculate monthly cost")
+		return nil, fmt.Errorf("failed to calculate monthly cost: %w", err)
+	}
+
+	return months, nil
+}
+
+// costConditions условия фильтра стоимости; плейсхолдеры нумеруются после уже собранных args
+func costConditions(filter *models.CostFilter, args []interface{}) ([]string, []interface{}) {
+	var conditions []string
+
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("s.user_id = $%d", len(args)))
+	}
+
+	if filter.ServiceID != nil {
+		args = append(args, *filter.ServiceID)
+		conditions = append(conditions, fmt.Sprintf("s.service_id = $%d", len(args)))
+	}
+
+	if filter.ServiceName != "" {
+		args = append(args, "%"+filter.ServiceName+"%")
+		conditions = append(conditions, fmt.Sprintf("s.service_name ILIKE $%d", len(args)))
+	}
+
+	if filter.Currency != "" {
+		args = append(args, filter.Currency)
+		conditions = append(conditions, fmt.Sprintf("c.currency = $%d", len(args)))
 	}
 
-	return totalCost, nil
+	return conditions, args
 }
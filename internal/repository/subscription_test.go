@@ -7,10 +7,12 @@ import (
 	"time"
 
 	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/reqctx"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,38 +27,111 @@ func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
 
 func TestSubscriptionRepository_Create(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
-	ctx := context.Background()
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := reqctx.WithActor(reqctx.WithRequestID(context.Background(), "req-1"), "alice")
 
 	sub := &models.Subscription{
-		ID:          uuid.MustParse("11111111-1111-1111-1111-111111111111"),
-		ServiceName: "Test",
-		Price:       100,
-		UserID:      uuid.MustParse("22222222-2222-2222-2222-222222222222"),
-		StartDate:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
-		EndDate:     nil,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:            uuid.MustParse("11111111-1111-1111-1111-111111111111"),
+		ServiceName:   "Test",
+		Price:         100,
+		Currency:      "USD",
+		BillingPeriod: models.BillingYearly,
+		UserID:        uuid.MustParse("22222222-2222-2222-2222-222222222222"),
+		StartDate:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:       nil,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		Version:       1,
 	}
 
+	serviceID := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+
+	mock.ExpectBegin()
+	expectServiceLookup(mock, "test", serviceID, "Test")
 	mock.ExpectExec("INSERT INTO subscriptions").
-		WithArgs(sub.ID, sub.ServiceName, sub.Price, sub.UserID, sub.StartDate, sub.EndDate, sub.CreatedAt, sub.UpdatedAt).
+		WithArgs(sub.ID, sub.ServiceName, &serviceID, sub.Price, sub.Currency, sub.BillingPeriod, sub.BillingMonths, sub.UserID, sub.StartDate, sub.EndDate, sub.CreatedAt, sub.UpdatedAt, sub.Version).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO subscription_price_history").
+		WithArgs(sub.ID, sub.Price, sub.StartDate).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO subscription_audit").
+		WithArgs(sub.ID, models.AuditCreate, "alice", "req-1", nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	err := repo.Create(ctx, sub)
 	require.NoError(t, err)
+	assert.Equal(t, &serviceID, sub.ServiceID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_Create_Charges(t *testing.T) {
+	db, mock := newMockDB(t)
+	var built *models.Subscription
+	repo := NewSubscriptionRepository(db, func(sub *models.Subscription, prices []models.PriceChange) []models.Charge {
+		built = sub
+		require.Len(t, prices, 1)
+		return []models.Charge{{PeriodStart: sub.StartDate, PeriodEnd: sub.StartDate.AddDate(0, 1, -1), CycleDays: 31, Amount: prices[0].Price, Currency: sub.Currency}}
+	})
+	ctx := context.Background()
+
+	serviceID := uuid.New()
+	sub := &models.Subscription{ID: uuid.New(), ServiceName: "Test", Price: 100, Currency: "RUB", BillingPeriod: models.BillingMonthly, StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Version: 1}
+
+	mock.ExpectBegin()
+	expectServiceLookup(mock, "test", serviceID, "Test")
+	mock.ExpectExec("INSERT INTO subscriptions").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO subscription_price_history").WillReturnResult(sqlmock.NewResult(0, 1))
+	// Начисления строятся по истории цен, прочитанной в той же транзакции
+	mock.ExpectQuery("SELECT .+ FROM subscription_price_history").
+		WithArgs(sub.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "price", "effective_from", "created_at"}).
+			AddRow(sub.ID, 100, sub.StartDate, time.Now()))
+	mock.ExpectExec("DELETE FROM charges").WithArgs(sub.ID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO charges").
+		WithArgs(sub.ID, sub.StartDate, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), 31, 100, "RUB").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO subscription_audit").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.Create(ctx, sub))
+	assert.Same(t, sub, built)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_Create_ChargesError(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, func(sub *models.Subscription, prices []models.PriceChange) []models.Charge {
+		return []models.Charge{{PeriodStart: sub.StartDate}}
+	})
+	ctx := context.Background()
+
+	sub := &models.Subscription{ID: uuid.New(), ServiceName: "Test", Price: 100, Currency: "RUB", BillingPeriod: models.BillingMonthly, StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Version: 1}
+
+	mock.ExpectBegin()
+	expectServiceLookup(mock, "test", uuid.New(), "Test")
+	mock.ExpectExec("INSERT INTO subscriptions").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO subscription_price_history").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT .+ FROM subscription_price_history").
+		WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "price", "effective_from", "created_at"}))
+	mock.ExpectExec("DELETE FROM charges").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO charges").WillReturnError(sql.ErrConnDone)
+	// Подписка без начислений не сохраняется, повтор запроса не создаст дубль
+	mock.ExpectRollback()
+
+	assert.Error(t, repo.Create(ctx, sub))
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSubscriptionRepository_GetByID(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
 	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
 
-	rows := sqlmock.NewRows([]string{"id", "service_name", "price", "user_id", "start_date", "end_date", "created_at", "updated_at"}).
-		AddRow(id, "Yandex", 300, uuid.MustParse("22222222-2222-2222-2222-222222222222"),
-			time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, time.Now(), time.Now())
+	rows := sqlmock.NewRows([]string{"id", "service_name", "price", "currency", "billing_period", "billing_months", "user_id", "start_date", "end_date", "created_at", "updated_at", "deleted_at"}).
+		AddRow(id, "Yandex", 300, "RUB", "monthly", nil, uuid.MustParse("22222222-2222-2222-2222-222222222222"),
+			time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, time.Now(), time.Now(), nil)
 
 	mock.ExpectQuery("SELECT .+ FROM subscriptions WHERE id").
 		WithArgs(id).
@@ -67,12 +142,13 @@ func TestSubscriptionRepository_GetByID(t *testing.T) {
 	assert.Equal(t, id, sub.ID)
 	assert.Equal(t, "Yandex", sub.ServiceName)
 	assert.Equal(t, 300, sub.Price)
+	assert.Equal(t, "RUB", sub.Currency)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSubscriptionRepository_GetByID_NotFound(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
 	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
 
@@ -86,14 +162,31 @@ func TestSubscriptionRepository_GetByID_NotFound(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSubscriptionRepository_GetOwner(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	owner := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+
+	mock.ExpectQuery("SELECT user_id FROM subscriptions WHERE id = \\$1$").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(owner))
+
+	userID, err := repo.GetOwner(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, owner, userID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestSubscriptionRepository_GetAll(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
 	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
 
-	rows := sqlmock.NewRows([]string{"id", "service_name", "price", "user_id", "start_date", "end_date", "created_at", "updated_at"}).
-		AddRow(id, "Yandex", 300, id, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, time.Now(), time.Now())
+	rows := sqlmock.NewRows([]string{"id", "service_name", "price", "currency", "billing_period", "billing_months", "user_id", "start_date", "end_date", "created_at", "updated_at", "deleted_at"}).
+		AddRow(id, "Yandex", 300, "RUB", "monthly", nil, id, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, time.Now(), time.Now(), nil)
 
 	mock.ExpectQuery("SELECT .+ FROM subscriptions").
 		WillReturnRows(rows)
@@ -106,81 +199,305 @@ func TestSubscriptionRepository_GetAll(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestSubscriptionRepository_Update(t *testing.T) {
+func TestSubscriptionRepository_GetAll_Keyset(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
-	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
-
-	sub := &models.Subscription{
-		ID:          id,
-		ServiceName: "Updated",
-		Price:       500,
-		UserID:      id,
-		StartDate:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
-		EndDate:     nil,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	after := &models.SubscriptionCursor{
+		Value: "2025-05-01T12:00:00Z",
+		ID:    uuid.MustParse("11111111-1111-1111-1111-111111111111"),
 	}
 
-	mock.ExpectExec("UPDATE subscriptions").
-		WithArgs(sub.ServiceName, sub.Price, sub.StartDate, sub.EndDate, sub.UpdatedAt, sub.ID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	// С курсором OFFSET не используется, порядок однозначен благодаря id
+	mock.ExpectQuery(`WHERE deleted_at IS NULL AND \(created_at, id\) < \(\$1, \$2\) ORDER BY created_at DESC, id DESC LIMIT \$3$`).
+		WithArgs(after.Value, after.ID, 11).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := repo.GetAll(ctx, &models.SubscriptionFilter{Limit: 11, Offset: 40, After: after})
+	require.NoError(t, err)
+
+	// Корзина листается по deleted_at
+	mock.ExpectQuery(`WHERE deleted_at IS NOT NULL AND \(deleted_at, id\) < \(\$1, \$2\) ORDER BY deleted_at DESC, id DESC`).
+		WithArgs(after.Value, after.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
-	err := repo.Update(ctx, sub)
+	_, err = repo.GetAll(ctx, &models.SubscriptionFilter{Deleted: true, After: after})
 	require.NoError(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestSubscriptionRepository_Update_NotFound(t *testing.T) {
+func TestSubscriptionRepository_GetAll_Filters(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
-	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	alice := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	bob := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	priceMin, priceMax := 100, 500
+	activeAt := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	startFrom := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTo := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+	hasEndDate := true
+
+	mock.ExpectQuery(`WHERE deleted_at IS NULL AND user_id = ANY\(\$1::uuid\[\]\) `+
+		`AND service_id IN \(SELECT service_id FROM service_aliases WHERE alias_key = \$2\) `+
+		`AND price >= \$3 AND price <= \$4 AND start_date <= \$5 AND \(end_date IS NULL OR end_date >= \$5\) `+
+		`AND start_date >= \$6 AND end_date <= \$7 AND end_date IS NOT NULL ORDER BY price ASC, id ASC LIMIT \$8$`).
+		WithArgs(pq.Array([]string{alice.String(), bob.String()}), "yandex plus", priceMin, priceMax, activeAt, startFrom, endTo, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := repo.GetAll(ctx, &models.SubscriptionFilter{
+		UserIDs:          []uuid.UUID{alice, bob},
+		ServiceName:      " Yandex  Plus",
+		ServiceNameExact: true,
+		PriceMin:         &priceMin,
+		PriceMax:         &priceMax,
+		ActiveAt:         &activeAt,
+		StartFrom:        &startFrom,
+		EndTo:            &endTo,
+		HasEndDate:       &hasEndDate,
+		Sort:             models.SortPrice,
+		Limit:            20,
+	})
+	require.NoError(t, err)
+
+	// Спецсимволы LIKE в названии ищутся как обычные символы
+	mock.ExpectQuery(`WHERE deleted_at IS NULL AND service_name ILIKE \$1 AND end_date IS NULL `+
+		`AND \(start_date, id\) < \(\$2, \$3\) ORDER BY start_date DESC, id DESC$`).
+		WithArgs(`%50\%\_off%`, "2025-02-01", alice).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	hasEndDate = false
+	_, err = repo.GetAll(ctx, &models.SubscriptionFilter{
+		ServiceName: "50%_off",
+		HasEndDate:  &hasEndDate,
+		Sort:        "-start_date",
+		After:       &models.SubscriptionCursor{Value: "2025-02-01", ID: alice},
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
 
-	sub := &models.Subscription{ID: id, ServiceName: "X", Price: 1, UserID: id, StartDate: time.Now(), UpdatedAt: time.Now()}
+func TestSubscriptionRepository_GetAll_InvalidSort(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
 
-	mock.ExpectExec("UPDATE subscriptions").
-		WithArgs(sub.ServiceName, sub.Price, sub.StartDate, sub.EndDate, sub.UpdatedAt, sub.ID).
-		WillReturnResult(sqlmock.NewResult(0, 0))
+	// Ни одно значение sort не попадает в SQL мимо белого списка
+	for _, sort := range []string{"user_id", "price; DROP TABLE subscriptions", "-", "deleted_at"} {
+		_, err := repo.GetAll(ctx, &models.SubscriptionFilter{Sort: sort})
+		assert.ErrorIs(t, err, ErrInvalidSort, sort)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
 
-	err := repo.Update(ctx, sub)
-	assert.ErrorIs(t, err, ErrNotFound)
+func TestSubscriptionRepository_Count(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	userID := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+
+	// Позиция страницы на итог не влияет
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM subscriptions WHERE deleted_at IS NULL AND user_id = \$1 AND service_name ILIKE \$2$`).
+		WithArgs(userID, "%okko%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+	total, err := repo.Count(ctx, &models.SubscriptionFilter{
+		UserID:      &userID,
+		ServiceName: "okko",
+		Limit:       10,
+		Offset:      20,
+		Sort:        "-price",
+		After:       &models.SubscriptionCursor{Value: "100", ID: userID},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 42, total)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSubscriptionRepository_UpdateAtomically(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
 	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	effectiveFrom := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
 
 	mock.ExpectBegin()
-	rows := sqlmock.NewRows([]string{"id", "service_name", "price", "user_id", "start_date", "end_date", "created_at", "updated_at"}).
-		AddRow(id, "Old", 100, id, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, time.Now(), time.Now())
+	rows := sqlmock.NewRows([]string{"id", "service_name", "price", "currency", "billing_period", "billing_months", "user_id", "start_date", "end_date", "created_at", "updated_at", "deleted_at", "version"}).
+		AddRow(id, "Old", 100, "RUB", "monthly", nil, id, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, time.Now(), time.Now(), nil, 3)
 	mock.ExpectQuery("SELECT .+ FOR UPDATE").
 		WithArgs(id).
 		WillReturnRows(rows)
+	serviceID := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+	expectServiceLookup(mock, "new", serviceID, "New")
 	mock.ExpectExec("UPDATE subscriptions").
-		WithArgs("New", 200, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, sqlmock.AnyArg(), id).
+		WithArgs("New", &serviceID, 200, "RUB", "monthly", nil, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, sqlmock.AnyArg(), 4, id).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Задним числом: более поздние записи истории заменяются новой ценой
+	mock.ExpectExec(`DELETE FROM subscription_price_history WHERE subscription_id = \$1 AND effective_from > \$3 \) INSERT INTO subscription_price_history(.+)ON CONFLICT`).
+		WithArgs(id, 200, effectiveFrom).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO subscription_audit").
+		WithArgs(id, models.AuditUpdate, reqctx.SystemActor, "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
 	updated, err := repo.UpdateAtomically(ctx, id, func(s *models.Subscription) error {
 		s.ServiceName = "New"
 		s.Price = 200
+		s.PriceEffectiveFrom = &effectiveFrom
 		s.UpdatedAt = time.Now()
 		return nil
 	})
 	require.NoError(t, err)
 	assert.Equal(t, "New", updated.ServiceName)
 	assert.Equal(t, 200, updated.Price)
+	assert.Equal(t, 4, updated.Version)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_UpdateAtomically_SamePrice(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	// Цена не менялась — история цен не пишется
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"id", "service_name", "price", "currency", "billing_period", "billing_months", "user_id", "start_date", "end_date", "created_at", "updated_at", "deleted_at"}).
+		AddRow(id, "Old", 100, "RUB", "monthly", nil, id, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, time.Now(), time.Now(), nil)
+	mock.ExpectQuery("SELECT .+ FOR UPDATE").
+		WithArgs(id).
+		WillReturnRows(rows)
+	expectServiceLookup(mock, "new", uuid.New(), "New")
+	mock.ExpectExec("UPDATE subscriptions").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO subscription_audit").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	_, err := repo.UpdateAtomically(ctx, id, func(s *models.Subscription) error {
+		s.ServiceName = "New"
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_GetPriceHistory(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	rows := sqlmock.NewRows([]string{"subscription_id", "price", "effective_from", "created_at"}).
+		AddRow(id, 400, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Now()).
+		AddRow(id, 500, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Now())
+	mock.ExpectQuery("SELECT .+ FROM subscription_price_history WHERE subscription_id = \\$1 ORDER BY effective_from").
+		WithArgs(id).
+		WillReturnRows(rows)
+
+	history, err := repo.GetPriceHistory(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 500, history[1].Price)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_StaleCharges(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	until := time.Date(2027, 10, 31, 0, 0, 0, 0, time.UTC)
+	id := uuid.New()
+
+	mock.ExpectQuery(`NOT EXISTS \(.+c.period_end >= LEAST\(s.end_date, \$1\)`).
+		WithArgs(until).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+
+	ids, err := repo.StaleCharges(ctx, until)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{id}, ids)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_RebuildCharges(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, func(sub *models.Subscription, prices []models.PriceChange) []models.Charge {
+		return []models.Charge{{PeriodStart: sub.StartDate, PeriodEnd: sub.StartDate.AddDate(0, 1, -1), CycleDays: 31, Amount: sub.Price, Currency: sub.Currency}}
+	})
+	ctx := context.Background()
+	id := uuid.New()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FROM subscriptions WHERE id = \\$1 FOR UPDATE").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "service_name", "price", "currency", "billing_period", "user_id", "start_date", "version"}).
+			AddRow(id, "Okko", 300, "RUB", "monthly", uuid.New(), start, 2))
+	mock.ExpectQuery("SELECT .+ FROM subscription_price_history").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "price", "effective_from", "created_at"}))
+	mock.ExpectExec("DELETE FROM charges").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO charges").
+		WithArgs(id, start, start.AddDate(0, 1, -1), 31, 300, "RUB").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.RebuildCharges(ctx, id))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_FindOverlaps(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	other := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+
+	sub := &models.Subscription{
+		ID:          uuid.MustParse("11111111-1111-1111-1111-111111111111"),
+		ServiceName: " Yandex  Plus",
+		UserID:      uuid.MustParse("22222222-2222-2222-2222-222222222222"),
+		StartDate:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	// Бессрочная подписка: конец периода — NULL, то есть бесконечность
+	mock.ExpectQuery("SELECT id FROM subscriptions WHERE user_id = \\$1 AND id <> \\$2 AND deleted_at IS NULL "+
+		"AND service_id IN \\(SELECT service_id FROM service_aliases WHERE alias_key = \\$3\\) "+
+		"AND start_date <= COALESCE\\(\\$4::date, 'infinity'\\) AND COALESCE\\(end_date, 'infinity'\\) >= \\$5").
+		WithArgs(sub.UserID, sub.ID, "yandex plus", nil, sub.StartDate).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(other))
+
+	ids, err := repo.FindOverlaps(ctx, sub)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{other}, ids)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_GetOverlaps(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	userID := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	first, second := uuid.New(), uuid.New()
+
+	rows := sqlmock.NewRows([]string{"service_id", "service_name", "subscription_id", "overlapping_id", "overlap_start", "overlap_end"}).
+		AddRow(uuid.New(), "Okko", first, second, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), nil)
+	mock.ExpectQuery("FROM subscriptions a JOIN subscriptions b ON .+ WHERE a.user_id = \\$1 AND a.deleted_at IS NULL AND b.deleted_at IS NULL").
+		WithArgs(userID).
+		WillReturnRows(rows)
+
+	overlaps, err := repo.GetOverlaps(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, overlaps, 1)
+	assert.Equal(t, first, overlaps[0].SubscriptionID)
+	assert.Equal(t, second, overlaps[0].OverlappingID)
+	assert.Nil(t, overlaps[0].OverlapEnd)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSubscriptionRepository_UpdateAtomically_NotFound(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
 	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
 
@@ -196,50 +513,291 @@ func TestSubscriptionRepository_UpdateAtomically_NotFound(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+// lockedRow строка подписки для SELECT ... FOR UPDATE; deletedAt nil — подписка активна
+func lockedRow(id uuid.UUID, deletedAt interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "service_name", "price", "currency", "billing_period", "billing_months", "user_id", "start_date", "end_date", "created_at", "updated_at", "deleted_at", "version"}).
+		AddRow(id, "Yandex", 300, "RUB", "monthly", nil, id, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), nil, time.Now(), time.Now(), deletedAt, 2)
+}
+
 func TestSubscriptionRepository_Delete(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
 	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
 
-	mock.ExpectExec("DELETE FROM subscriptions WHERE id").
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FROM subscriptions WHERE id = \\$1 FOR UPDATE").
 		WithArgs(id).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+		WillReturnRows(lockedRow(id, nil))
+	mock.ExpectQuery("UPDATE subscriptions SET deleted_at = NOW\\(\\), version = version \\+ 1 WHERE id = \\$1 RETURNING deleted_at").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at"}).AddRow(time.Now()))
+	mock.ExpectExec("INSERT INTO subscription_audit").
+		WithArgs(id, models.AuditDelete, reqctx.SystemActor, "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	err := repo.Delete(ctx, id)
+	err := repo.Delete(ctx, id, 2)
 	require.NoError(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSubscriptionRepository_Delete_VersionMismatch(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	// Подписку успели изменить после чтения клиентом — удалять нельзя
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FOR UPDATE").
+		WithArgs(id).
+		WillReturnRows(lockedRow(id, nil))
+	mock.ExpectRollback()
+
+	err := repo.Delete(ctx, id, 1)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestSubscriptionRepository_Delete_NotFound(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	// Уже в корзине — для Delete подписки нет
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FOR UPDATE").
+		WithArgs(id).
+		WillReturnRows(lockedRow(id, time.Now()))
+	mock.ExpectRollback()
+
+	err := repo.Delete(ctx, id, 0)
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_Restore(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
 	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
 
-	mock.ExpectExec("DELETE FROM subscriptions WHERE id").
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FOR UPDATE").
+		WithArgs(id).
+		WillReturnRows(lockedRow(id, time.Now()))
+	mock.ExpectQuery("UPDATE subscriptions SET deleted_at = NULL(.+)RETURNING updated_at").
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+	mock.ExpectExec("INSERT INTO subscription_audit").
+		WithArgs(id, models.AuditRestore, reqctx.SystemActor, "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.Restore(ctx, id)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_Restore_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FOR UPDATE").
 		WithArgs(id).
-		WillReturnResult(sqlmock.NewResult(0, 0))
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
 
-	err := repo.Delete(ctx, id)
+	err := repo.Restore(ctx, id)
 	assert.ErrorIs(t, err, ErrNotFound)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSubscriptionRepository_Purge(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	// Журнал изменений переживает удаление: after = NULL
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FOR UPDATE").
+		WithArgs(id).
+		WillReturnRows(lockedRow(id, time.Now()))
+	mock.ExpectExec("DELETE FROM subscriptions WHERE id = \\$1").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO subscription_audit").
+		WithArgs(id, models.AuditPurge, reqctx.SystemActor, "", sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.Purge(ctx, id)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_Purge_NotDeleted(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	id := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .+ FOR UPDATE").
+		WithArgs(id).
+		WillReturnRows(lockedRow(id, nil))
+	mock.ExpectRollback()
+
+	err := repo.Purge(ctx, id)
+	assert.ErrorIs(t, err, ErrNotDeleted)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestSubscriptionRepository_GetTotalCost(t *testing.T) {
 	db, mock := newMockDB(t)
-	repo := NewSubscriptionRepository(db)
+	repo := NewSubscriptionRepository(db, nil)
 	ctx := context.Background()
 	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
 	end := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
 
-	rows := sqlmock.NewRows([]string{"total_cost"}).AddRow(3600)
-	mock.ExpectQuery("SELECT COALESCE").
+	rows := sqlmock.NewRows([]string{"currency", "total_cost"}).
+		AddRow("RUB", 3600).
+		AddRow("USD", 120)
+	mock.ExpectQuery("FROM charges c(.+)WHERE c.period_start BETWEEN \\$2 AND \\$1(.+)SELECT currency, ROUND\\(SUM\\(amount\\)\\)(.+)GROUP BY currency").
+		WithArgs(end, start).
 		WillReturnRows(rows)
 
 	filter := &models.CostFilter{StartDate: start, EndDate: end}
-	cost, err := repo.GetTotalCost(ctx, filter)
+	totals, err := repo.GetTotalCost(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []models.CurrencyCost{
+		{Currency: "RUB", TotalCost: 3600},
+		{Currency: "USD", TotalCost: 120},
+	}, totals)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_GetTotalCost_DailyProration(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"currency", "total_cost"}).AddRow("RUB", 955)
+	mock.ExpectQuery("LEAST\\(c.period_end, month_end, \\$1::date\\) - GREATEST\\(c.period_start, month_start, \\$2::date\\)(.+)/ c.cycle_days").
+		WithArgs(end, start).
+		WillReturnRows(rows)
+
+	filter := &models.CostFilter{StartDate: start, EndDate: end, Proration: models.ProrationDaily}
+	totals, err := repo.GetTotalCost(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []models.CurrencyCost{{Currency: "RUB", TotalCost: 955}}, totals)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_GetTotalCost_CurrencyFilter(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	serviceID := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+
+	rows := sqlmock.NewRows([]string{"currency", "total_cost"}).AddRow("USD", 120)
+	mock.ExpectQuery("AND s.service_id = \\$3 AND c.currency = \\$4\\)(.+)GROUP BY currency").
+		WithArgs(end, start, serviceID, "USD").
+		WillReturnRows(rows)
+
+	filter := &models.CostFilter{StartDate: start, EndDate: end, ServiceID: &serviceID, Currency: "USD"}
+	totals, err := repo.GetTotalCost(ctx, filter)
 	require.NoError(t, err)
-	assert.Equal(t, 3600, cost)
+	require.Len(t, totals, 1)
+	assert.Equal(t, "USD", totals[0].Currency)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_GetMonthlyCost(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	userID := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+
+	rows := sqlmock.NewRows([]string{"month", "group_key", "currency", "total_cost"}).
+		AddRow(start, "", "RUB", 400).
+		AddRow(end, "", "RUB", 400)
+	mock.ExpectQuery("FROM generate_series(.+)AND s.user_id = \\$3\\)(.+)GROUP BY month, currency").
+		WithArgs(end, start, userID).
+		WillReturnRows(rows)
+
+	filter := &models.CostFilter{StartDate: start, EndDate: end, UserID: &userID}
+	months, err := repo.GetMonthlyCost(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, months, 2)
+	assert.Equal(t, end, months[1].Month)
+	assert.Equal(t, 400, months[1].TotalCost)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_GetMonthlyCost_GroupBy(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"month", "group_key", "currency", "total_cost"}).
+		AddRow(start, "Netflix", "USD", 10).
+		AddRow(start, "Yandex Plus", "RUB", 400)
+	mock.ExpectQuery("SELECT month, service_name AS group_key(.+)GROUP BY month, service_name, currency").
+		WithArgs(start, start).
+		WillReturnRows(rows)
+
+	filter := &models.CostFilter{StartDate: start, EndDate: start, GroupBy: models.CostGroupByServiceName}
+	months, err := repo.GetMonthlyCost(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, months, 2)
+	assert.Equal(t, "Netflix", months[0].Key)
+	assert.Equal(t, "Yandex Plus", months[1].Key)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_GetCostGroups(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"group_key", "currency", "total_cost", "months", "subscription_count", "rank"}).
+		AddRow("Yandex Plus", "RUB", 4800, 12, 1, 1).
+		AddRow("Kinopoisk", "RUB", 1200, 4, 2, 2)
+	mock.ExpectQuery("SELECT service_name AS group_key(.+)COUNT\\(DISTINCT \\(id, month\\)\\) AS months(.+)PARTITION BY currency(.+)GROUP BY service_name, currency(.+)WHERE rank <= \\$3 ORDER BY currency, rank").
+		WithArgs(end, start, 2).
+		WillReturnRows(rows)
+
+	filter := &models.CostFilter{StartDate: start, EndDate: end, GroupBy: models.CostGroupByServiceName, Top: 2}
+	groups, err := repo.GetCostGroups(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, models.CostGroup{Key: "Yandex Plus", Currency: "RUB", TotalCost: 4800, Months: 12, SubscriptionCount: 1, Rank: 1}, groups[0])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscriptionRepository_GetCostGroups_UnknownGroup(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewSubscriptionRepository(db, nil)
+
+	groups, err := repo.GetCostGroups(context.Background(), &models.CostFilter{GroupBy: "price"})
+	assert.Error(t, err)
+	assert.Nil(t, groups)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -0,0 +1,100 @@
+// Package reqctx хранит в context.Context данные запроса, нужные ниже хендлеров:
+// идентификатор запроса, автора изменения и проверенную личность вызывающего
+package reqctx
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	actorKey
+	identityKey
+)
+
+// SystemActor автор изменений, сделанных не из HTTP-запроса
+const SystemActor = "system"
+
+// MaxActorLen длина subscription_audit.actor в символах
+const MaxActorLen = 255
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID идентификатор запроса или пустая строка
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithActor автор длиннее MaxActorLen символов (X-Actor, sub токена) обрезается, иначе запись журнала не поместится
+func WithActor(ctx context.Context, actor string) context.Context {
+	if len(actor) > MaxActorLen {
+		if runes := []rune(actor); len(runes) > MaxActorLen {
+			actor = string(runes[:MaxActorLen])
+		}
+	}
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor автор изменения; без него — SystemActor
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+// Роли пользователей с токеном. Что разрешено каждой роли, решает пакет policy
+const (
+	RoleAdmin   = "admin"
+	RoleAnalyst = "analyst"
+	RoleUser    = "user"
+)
+
+// Identity вызывающий, подтвержденный токеном или API-ключом
+type Identity struct {
+	Subject string    // уникален: у API-ключа строится из его ID, ключом ограничителя и идемпотентности
+	Name    string    // только для журнала: у API-ключа — его название, оно не уникально
+	UserID  uuid.UUID // пустой у админа и аналитика без user_id в токене
+	Role    string    // у API-ключа пустая
+	// APIKey сервисный клиент: видит подписки всех пользователей, но только в пределах Scopes
+	APIKey bool
+	Scopes []string
+}
+
+// HasScope у пользователей с токеном скоупов нет — доступ определяется ролью
+func (i *Identity) HasScope(scope string) bool {
+	if !i.APIKey {
+		return true
+	}
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor автор изменений для журнала: Subject, у API-ключа — с названием
+func (i *Identity) Actor() string {
+	if i.Name == "" {
+		return i.Subject
+	}
+	return i.Subject + " (" + i.Name + ")"
+}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, id)
+}
+
+// IdentityFrom личность вызывающего; false — вызов без аутентификации (внутренний или auth выключен)
+func IdentityFrom(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey).(*Identity)
+	return id, ok && id != nil
+}
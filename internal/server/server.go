@@ -14,15 +14,21 @@ type Server struct {
 }
 
 // NewServer
-func NewServer(cfg *config.Config, handlers *handler.Handler) *Server {
+func NewServer(cfg *config.Config, handlers *handler.Handler) (*Server, error) {
+	router := handlers.InitRoutes()
+	// Без доверенных прокси X-Forwarded-For игнорируется: иначе клиент подменит IP и обойдет лимит
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid server.trusted_proxies: %w", err)
+	}
+
 	return &Server{
 		httpServer: &http.Server{
 			Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
-			Handler:      handlers.InitRoutes(),
+			Handler:      router,
 			ReadTimeout:  cfg.Server.ReadTimeout,
 			WriteTimeout: cfg.Server.WriteTimeout,
 		},
-	}
+	}, nil
 }
 
 func (s *Server) Run() error {
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidAPIKey ключ не найден, отозван или истек
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// ErrInvalidAPIKeyRequest неизвестный скоуп или срок действия в прошлом
+var ErrInvalidAPIKeyRequest = errors.New("invalid api key request")
+
+const (
+	apiKeyPrefix = "sk_"
+	// apiKeyShownLen сколько первых символов ключа хранится открыто для опознания
+	apiKeyShownLen = 11
+)
+
+type apiKeyService struct {
+	repo repository.APIKeyRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{repo: repo}
+}
+
+// Create выпускает ключ; секрет возвращается только в ответе
+func (s *apiKeyService) Create(ctx context.Context, req *models.CreateAPIKeyReq) (*models.APIKeySecret, error) {
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKeyRequest, scope)
+		}
+	}
+
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKeyRequest)
+	}
+
+	secret, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.APIKey{
+		ID:        uuid.New(),
+		Name:      req.Name,
+		Prefix:    secret[:apiKeyShownLen],
+		KeyHash:   hashAPIKey(secret),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: reqctx.Actor(ctx),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("api_key_id", key.ID.String()).Str("name", key.Name).Strs("scopes", key.Scopes).Msg("API key created")
+	return &models.APIKeySecret{APIKey: *key, Key: secret}, nil
+}
+
+// List все ключи без секретов
+func (s *apiKeyService) List(ctx context.Context) ([]models.APIKey, error) {
+	return s.repo.GetAll(ctx)
+}
+
+// Revoke
+func (s *apiKeyService) Revoke(ctx context.Context, id uuid.UUID) error {
+	if err := s.repo.Revoke(ctx, id); err != nil {
+		return err
+	}
+
+	log.Info().Str("api_key_id", id.String()).Msg("API key revoked")
+	return nil
+}
+
+// Rotate выдает ключу новый секрет с теми же скоупами и сроком
+func (s *apiKeyService) Rotate(ctx context.Context, id uuid.UUID) (*models.APIKeySecret, error) {
+	secret, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.repo.Rotate(ctx, id, secret[:apiKeyShownLen], hashAPIKey(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("api_key_id", id.String()).Msg("API key rotated")
+	return &models.APIKeySecret{APIKey: *key, Key: secret}, nil
+}
+
+// Authenticate проверяет ключ из запроса и возвращает личность сервисного клиента
+func (s *apiKeyService) Authenticate(ctx context.Context, secret string) (*reqctx.Identity, error) {
+	key, err := s.repo.GetByHash(ctx, hashAPIKey(secret))
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: revoked", ErrInvalidAPIKey)
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidAPIKey)
+	}
+
+	if err := s.repo.TouchLastUsed(ctx, key.ID); err != nil {
+		log.Warn().Err(err).Str("api_key_id", key.ID.String()).Msg("Failed to record api key use")
+	}
+
+	return &reqctx.Identity{
+		Subject: "api-key:" + key.ID.String(),
+		Name:    key.Name,
+		APIKey:  true,
+		Scopes:  key.Scopes,
+	}, nil
+}
+
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
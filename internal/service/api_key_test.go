@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockAPIKeyRepo struct {
+	created   *models.APIKey
+	byHash    map[string]*models.APIKey
+	rotateFn  func(ctx context.Context, id uuid.UUID, prefix, hash string) (*models.APIKey, error)
+	touchedID uuid.UUID
+}
+
+func (m *mockAPIKeyRepo) Create(ctx context.Context, key *models.APIKey) error {
+	m.created = key
+	return nil
+}
+
+func (m *mockAPIKeyRepo) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	if key, ok := m.byHash[hash]; ok {
+		return key, nil
+	}
+	return nil, repository.ErrAPIKeyNotFound
+}
+
+func (m *mockAPIKeyRepo) GetAll(ctx context.Context) ([]models.APIKey, error) {
+	return []models.APIKey{}, nil
+}
+
+func (m *mockAPIKeyRepo) Revoke(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (m *mockAPIKeyRepo) Rotate(ctx context.Context, id uuid.UUID, prefix, hash string) (*models.APIKey, error) {
+	if m.rotateFn != nil {
+		return m.rotateFn(ctx, id, prefix, hash)
+	}
+	return &models.APIKey{ID: id, Prefix: prefix, KeyHash: hash}, nil
+}
+
+func (m *mockAPIKeyRepo) TouchLastUsed(ctx context.Context, id uuid.UUID) error {
+	m.touchedID = id
+	return nil
+}
+
+func adminCtx() context.Context {
+	ctx := reqctx.WithIdentity(context.Background(), &reqctx.Identity{Subject: "root", Role: reqctx.RoleAdmin})
+	return reqctx.WithActor(ctx, "root")
+}
+
+func TestAPIKeyService_Create(t *testing.T) {
+	repo := &mockAPIKeyRepo{}
+	svc := NewAPIKeyService(repo)
+
+	req := &models.CreateAPIKeyReq{Name: "batch", Scopes: []string{models.ScopeCostRead, models.ScopeSubscriptionsRead, models.ScopeCostRead}}
+	key, err := svc.Create(adminCtx(), req)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(key.Key, apiKeyPrefix))
+	assert.Equal(t, key.Key[:apiKeyShownLen], key.Prefix)
+	// Хранится только хеш
+	require.NotNil(t, repo.created)
+	assert.Equal(t, hashAPIKey(key.Key), repo.created.KeyHash)
+	assert.NotContains(t, repo.created.KeyHash, key.Key)
+	assert.Equal(t, pq.StringArray{models.ScopeCostRead, models.ScopeSubscriptionsRead}, repo.created.Scopes)
+	assert.Equal(t, "root", repo.created.CreatedBy)
+}
+
+func TestAPIKeyService_Create_Invalid(t *testing.T) {
+	svc := NewAPIKeyService(&mockAPIKeyRepo{})
+
+	_, err := svc.Create(adminCtx(), &models.CreateAPIKeyReq{Name: "batch", Scopes: []string{"admin"}})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyRequest)
+
+	past := time.Now().Add(-time.Hour)
+	_, err = svc.Create(adminCtx(), &models.CreateAPIKeyReq{Name: "batch", Scopes: []string{models.ScopeCostRead}, ExpiresAt: &past})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyRequest)
+}
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	id := uuid.New()
+	expired := time.Now().Add(-time.Minute)
+	revoked := time.Now().Add(-time.Hour)
+	repo := &mockAPIKeyRepo{byHash: map[string]*models.APIKey{
+		hashAPIKey("sk_valid"):   {ID: id, Name: "batch", Scopes: pq.StringArray{models.ScopeCostRead}},
+		hashAPIKey("sk_expired"): {ID: uuid.New(), Name: "old", ExpiresAt: &expired},
+		hashAPIKey("sk_revoked"): {ID: uuid.New(), Name: "gone", RevokedAt: &revoked},
+	}}
+	svc := NewAPIKeyService(repo)
+	ctx := context.Background()
+
+	identity, err := svc.Authenticate(ctx, "sk_valid")
+	require.NoError(t, err)
+	assert.True(t, identity.APIKey)
+	assert.Equal(t, "api-key:"+id.String(), identity.Subject)
+	assert.Equal(t, "api-key:"+id.String()+" (batch)", identity.Actor())
+	assert.True(t, identity.HasScope(models.ScopeCostRead))
+	assert.False(t, identity.HasScope(models.ScopeSubscriptionsWrite))
+	assert.Equal(t, id, repo.touchedID)
+
+	for _, secret := range []string{"sk_expired", "sk_revoked", "sk_unknown"} {
+		_, err := svc.Authenticate(ctx, secret)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey, secret)
+	}
+}
+
+func TestAPIKeyService_Rotate(t *testing.T) {
+	var storedHash string
+	repo := &mockAPIKeyRepo{
+		rotateFn: func(ctx context.Context, id uuid.UUID, prefix, hash string) (*models.APIKey, error) {
+			storedHash = hash
+			return &models.APIKey{ID: id, Prefix: prefix}, nil
+		},
+	}
+	svc := NewAPIKeyService(repo)
+
+	key, err := svc.Rotate(adminCtx(), uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, hashAPIKey(key.Key), storedHash)
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type auditService struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditService(repo repository.AuditRepository) AuditService {
+	return &auditService{repo: repo}
+}
+
+// List записи журнала изменений по фильтру
+func (s *auditService) List(ctx context.Context, filter *models.AuditFilter) ([]models.AuditEntry, error) {
+	return s.repo.List(ctx, filter)
+}
+
+// GetHistory история изменений одной подписки, в том числе удаленной окончательно
+func (s *auditService) GetHistory(ctx context.Context, id uuid.UUID, limit, offset int) ([]models.AuditEntry, error) {
+	return s.repo.List(ctx, &models.AuditFilter{SubscriptionID: &id, Limit: limit, Offset: offset})
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidService пустое название или псевдоним, слияние сервиса с самим собой
+var ErrInvalidService = errors.New("invalid service")
+
+type catalogService struct {
+	repo repository.CatalogRepository
+}
+
+func NewCatalogService(repo repository.CatalogRepository) CatalogService {
+	return &catalogService{repo: repo}
+}
+
+// Create
+func (s *catalogService) Create(ctx context.Context, req *models.ServiceReq) (*models.Service, error) {
+	now := time.Now()
+	service := &models.Service{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+	if err := applyServiceReq(service, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, service); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("service_id", service.ID.String()).Str("name", service.Name).Msg("Catalog service created")
+	return service, nil
+}
+
+// GetByID
+func (s *catalogService) GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// GetAll
+func (s *catalogService) GetAll(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error) {
+	return s.repo.GetAll(ctx, filter)
+}
+
+// Update заменяет сервис целиком, псевдонимы — тоже
+func (s *catalogService) Update(ctx context.Context, id uuid.UUID, req *models.ServiceReq) (*models.Service, error) {
+	service := &models.Service{ID: id}
+	if err := applyServiceReq(service, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, service); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("service_id", id.String()).Str("name", service.Name).Msg("Catalog service updated")
+	return service, nil
+}
+
+// Delete удаляет сервис; mergeInto != nil — сначала переносит его подписки и названия в другой сервис
+func (s *catalogService) Delete(ctx context.Context, id uuid.UUID, mergeInto *uuid.UUID) error {
+	if mergeInto != nil && *mergeInto == id {
+		return fieldError("merge_into", fmt.Errorf("%w: cannot merge a service into itself", ErrInvalidService))
+	}
+
+	if err := s.repo.Delete(ctx, id, mergeInto); err != nil {
+		return err
+	}
+
+	log.Info().Str("service_id", id.String()).Msg("Catalog service deleted")
+	return nil
+}
+
+// applyServiceReq записывает запрос в сервис. Названия приводятся к виду без лишних пробелов,
+// псевдонимы, совпадающие с названием или друг с другом после нормализации, отбрасываются
+func applyServiceReq(service *models.Service, req *models.ServiceReq) error {
+	name := strings.Join(strings.Fields(req.Name), " ")
+	if name == "" {
+		return fieldError("name", fmt.Errorf("%w: name must not be blank", ErrInvalidService))
+	}
+
+	seen := map[string]bool{models.ServiceKey(name): true}
+	aliases := make([]string, 0, len(req.Aliases))
+	for _, alias := range req.Aliases {
+		alias = strings.Join(strings.Fields(alias), " ")
+		if alias == "" {
+			return fieldError("aliases", fmt.Errorf("%w: alias must not be blank", ErrInvalidService))
+		}
+		key := models.ServiceKey(alias)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		aliases = append(aliases, alias)
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	service.Name = name
+	service.Aliases = aliases
+	service.Category = strings.TrimSpace(req.Category)
+	service.DefaultPrice = req.DefaultPrice
+	service.Currency = currency
+	return nil
+}
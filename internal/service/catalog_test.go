@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCatalogRepo struct {
+	created *models.Service
+	updated *models.Service
+	deleted bool
+}
+
+func (m *mockCatalogRepo) Create(ctx context.Context, service *models.Service) error {
+	m.created = service
+	return nil
+}
+
+func (m *mockCatalogRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	return &models.Service{ID: id}, nil
+}
+
+func (m *mockCatalogRepo) GetAll(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error) {
+	return []models.Service{}, nil
+}
+
+func (m *mockCatalogRepo) Update(ctx context.Context, service *models.Service) error {
+	m.updated = service
+	return nil
+}
+
+func (m *mockCatalogRepo) Delete(ctx context.Context, id uuid.UUID, mergeInto *uuid.UUID) error {
+	m.deleted = true
+	return nil
+}
+
+func TestCatalogService_Create(t *testing.T) {
+	repo := &mockCatalogRepo{}
+	svc := NewCatalogService(repo)
+
+	// Пробелы схлопываются, повторы названия среди псевдонимов отбрасываются
+	service, err := svc.Create(context.Background(), &models.ServiceReq{
+		Name:     "  Yandex   Plus ",
+		Aliases:  []string{"Яндекс Плюс", "yandex plus", " ЯНДЕКС  ПЛЮС", "Plus"},
+		Category: " music ",
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, service.ID)
+	assert.Equal(t, "Yandex Plus", service.Name)
+	assert.Equal(t, []string{"Яндекс Плюс", "Plus"}, []string(service.Aliases))
+	assert.Equal(t, "music", service.Category)
+	assert.Equal(t, models.DefaultCurrency, service.Currency)
+	assert.Same(t, service, repo.created)
+}
+
+func TestCatalogService_Create_Blank(t *testing.T) {
+	repo := &mockCatalogRepo{}
+	svc := NewCatalogService(repo)
+
+	_, err := svc.Create(context.Background(), &models.ServiceReq{Name: "   "})
+	assert.ErrorIs(t, err, ErrInvalidService)
+	var fieldErr *FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "name", fieldErr.Field)
+
+	_, err = svc.Create(context.Background(), &models.ServiceReq{Name: "Okko", Aliases: []string{" "}})
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "aliases", fieldErr.Field)
+	assert.Nil(t, repo.created)
+}
+
+func TestCatalogService_Update(t *testing.T) {
+	repo := &mockCatalogRepo{}
+	svc := NewCatalogService(repo)
+	id := uuid.New()
+	price := 399
+
+	service, err := svc.Update(context.Background(), id, &models.ServiceReq{Name: "Okko", DefaultPrice: &price, Currency: "USD"})
+	require.NoError(t, err)
+	assert.Equal(t, id, repo.updated.ID)
+	assert.Equal(t, &price, service.DefaultPrice)
+	assert.Equal(t, "USD", service.Currency)
+	assert.Empty(t, service.Aliases)
+}
+
+func TestCatalogService_Delete_MergeIntoItself(t *testing.T) {
+	repo := &mockCatalogRepo{}
+	svc := NewCatalogService(repo)
+	id := uuid.New()
+
+	err := svc.Delete(context.Background(), id, &id)
+	assert.ErrorIs(t, err, ErrInvalidService)
+	assert.False(t, repo.deleted)
+
+	other := uuid.New()
+	require.NoError(t, svc.Delete(context.Background(), id, &other))
+	assert.True(t, repo.deleted)
+}
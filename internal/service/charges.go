@@ -0,0 +1,105 @@
+package service
+
+import (
+	"time"
+
+	"em_tz_anvar/internal/models"
+)
+
+// chargeHorizonMonths на сколько месяцев вперед от текущей даты строятся начисления бессрочной подписки.
+// Горизонт сдвигается при каждом изменении подписки и при пересборке журнала на старте приложения
+const chargeHorizonMonths = 24
+
+// BuildCharges начисления подписки с горизонтом от текущей даты, repository.ChargeBuilder для
+// транзакций изменения подписки
+func BuildCharges(sub *models.Subscription, prices []models.PriceChange) []models.Charge {
+	return buildCharges(sub, prices, chargeHorizon(time.Now()))
+}
+
+// buildCharges раскладывает подписку на циклы списания. k-й цикл начинается в годовщину start_date
+// (start_date + k периодов, 31-е число в коротком месяце сдвигается на последний день месяца).
+// Циклы строятся до end_date, у бессрочной подписки — до horizon. Сумма цикла — цена из prices,
+// действовавшая на дату списания
+func buildCharges(sub *models.Subscription, prices []models.PriceChange, horizon time.Time) []models.Charge {
+	last := horizon
+	if sub.EndDate != nil {
+		last = *sub.EndDate
+	}
+
+	var charges []models.Charge
+	for k := 0; ; k++ {
+		start := cycleStart(sub, k)
+		if start.After(last) {
+			break
+		}
+		next := cycleStart(sub, k+1)
+
+		end := next.AddDate(0, 0, -1)
+		if sub.EndDate != nil && sub.EndDate.Before(end) {
+			end = *sub.EndDate
+		}
+
+		charges = append(charges, models.Charge{
+			SubscriptionID: sub.ID,
+			PeriodStart:    start,
+			PeriodEnd:      end,
+			CycleDays:      int(next.Sub(start).Hours() / 24),
+			Amount:         priceAt(prices, start, sub.Price),
+			Currency:       sub.Currency,
+		})
+	}
+
+	return charges
+}
+
+// priceAt цена, действовавшая на дату on. prices отсортированы по EffectiveFrom; до первой записи действует
+// первая цена (начало подписки могли перенести раньше), без истории — текущая цена подписки
+func priceAt(prices []models.PriceChange, on time.Time, current int) int {
+	if len(prices) == 0 {
+		return current
+	}
+
+	price := prices[0].Price
+	for _, p := range prices {
+		if p.EffectiveFrom.After(on) {
+			break
+		}
+		price = p.Price
+	}
+	return price
+}
+
+// cycleStart дата начала k-го цикла подписки
+func cycleStart(sub *models.Subscription, k int) time.Time {
+	switch sub.BillingPeriod {
+	case models.BillingWeekly:
+		return sub.StartDate.AddDate(0, 0, 7*k)
+	case models.BillingQuarterly:
+		return addMonths(sub.StartDate, 3*k)
+	case models.BillingYearly:
+		return addMonths(sub.StartDate, 12*k)
+	case models.BillingCustom:
+		months := 1
+		if sub.BillingMonths != nil {
+			months = *sub.BillingMonths
+		}
+		return addMonths(sub.StartDate, months*k)
+	default:
+		return addMonths(sub.StartDate, k)
+	}
+}
+
+// addMonths прибавляет месяцы без переполнения: 31.01 + 1 месяц = 28.02 (29.02), а не 03.03
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	day := t.Day()
+	if last := endOfMonth(first).Day(); day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+// chargeHorizon граница журнала для бессрочных подписок
+func chargeHorizon(now time.Time) time.Time {
+	return endOfMonth(addMonths(startOfMonth(now), chargeHorizonMonths))
+}
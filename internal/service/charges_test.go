@@ -0,0 +1,117 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBuildCharges_Monthly(t *testing.T) {
+	end := date(2025, 3, 1)
+	sub := &models.Subscription{
+		ID:            uuid.New(),
+		Price:         310,
+		Currency:      "RUB",
+		BillingPeriod: models.BillingMonthly,
+		StartDate:     date(2025, 1, 15),
+		EndDate:       &end,
+	}
+
+	charges := buildCharges(sub, nil, date(2030, 1, 1))
+	require.Len(t, charges, 2)
+	assert.Equal(t, date(2025, 1, 15), charges[0].PeriodStart)
+	assert.Equal(t, date(2025, 2, 14), charges[0].PeriodEnd)
+	assert.Equal(t, 31, charges[0].CycleDays)
+	// последний цикл обрезан end_date, но длина цикла полная
+	assert.Equal(t, date(2025, 2, 15), charges[1].PeriodStart)
+	assert.Equal(t, date(2025, 3, 1), charges[1].PeriodEnd)
+	assert.Equal(t, 28, charges[1].CycleDays)
+	assert.Equal(t, 310, charges[1].Amount)
+	assert.Equal(t, "RUB", charges[1].Currency)
+}
+
+func TestBuildCharges_EndOfMonthAnchor(t *testing.T) {
+	end := date(2024, 4, 29)
+	sub := &models.Subscription{BillingPeriod: models.BillingMonthly, StartDate: date(2024, 1, 31), EndDate: &end}
+
+	charges := buildCharges(sub, nil, date(2030, 1, 1))
+	require.Len(t, charges, 3)
+	assert.Equal(t, date(2024, 2, 29), charges[1].PeriodStart)
+	// после короткого месяца списание возвращается на 31-е
+	assert.Equal(t, date(2024, 3, 31), charges[2].PeriodStart)
+}
+
+func TestBuildCharges_Periods(t *testing.T) {
+	months := 6
+	tests := []struct {
+		name   string
+		period string
+		months *int
+		want   []time.Time
+	}{
+		{name: "weekly", period: models.BillingWeekly, want: []time.Time{date(2024, 1, 1), date(2024, 1, 8), date(2024, 1, 15), date(2024, 1, 22), date(2024, 1, 29)}},
+		{name: "quarterly", period: models.BillingQuarterly, want: []time.Time{date(2024, 1, 1)}},
+		{name: "yearly", period: models.BillingYearly, want: []time.Time{date(2024, 1, 1)}},
+		{name: "custom", period: models.BillingCustom, months: &months, want: []time.Time{date(2024, 1, 1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := &models.Subscription{BillingPeriod: tt.period, BillingMonths: tt.months, StartDate: date(2024, 1, 1)}
+			charges := buildCharges(sub, nil, date(2024, 1, 31))
+			var starts []time.Time
+			for _, c := range charges {
+				starts = append(starts, c.PeriodStart)
+			}
+			assert.Equal(t, tt.want, starts)
+		})
+	}
+}
+
+func TestBuildCharges_OpenEndedUntilHorizon(t *testing.T) {
+	sub := &models.Subscription{BillingPeriod: models.BillingYearly, StartDate: date(2020, 2, 29)}
+
+	charges := buildCharges(sub, nil, date(2024, 12, 31))
+	require.Len(t, charges, 5)
+	assert.Equal(t, date(2021, 2, 28), charges[1].PeriodStart)
+	assert.Equal(t, date(2024, 2, 29), charges[4].PeriodStart)
+	assert.Equal(t, 365, charges[4].CycleDays)
+}
+
+func TestBuildCharges_PriceHistory(t *testing.T) {
+	end := date(2025, 4, 30)
+	sub := &models.Subscription{Price: 500, BillingPeriod: models.BillingMonthly, StartDate: date(2025, 1, 10), EndDate: &end}
+	prices := []models.PriceChange{
+		{Price: 400, EffectiveFrom: date(2025, 1, 10)},
+		{Price: 500, EffectiveFrom: date(2025, 3, 1)},
+	}
+
+	charges := buildCharges(sub, prices, date(2030, 1, 1))
+	require.Len(t, charges, 4)
+	assert.Equal(t, 400, charges[0].Amount)
+	assert.Equal(t, 400, charges[1].Amount)
+	// списание 10.03 уже по новой цене
+	assert.Equal(t, 500, charges[2].Amount)
+	assert.Equal(t, 500, charges[3].Amount)
+}
+
+func TestPriceAt(t *testing.T) {
+	prices := []models.PriceChange{
+		{Price: 300, EffectiveFrom: date(2025, 2, 1)},
+		{Price: 350, EffectiveFrom: date(2025, 6, 1)},
+	}
+
+	assert.Equal(t, 300, priceAt(prices, date(2025, 1, 15), 350))
+	assert.Equal(t, 300, priceAt(prices, date(2025, 5, 31), 350))
+	assert.Equal(t, 350, priceAt(prices, date(2025, 6, 1), 350))
+	assert.Equal(t, 999, priceAt(nil, date(2025, 6, 1), 999))
+}
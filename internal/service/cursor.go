@@ -0,0 +1,79 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor курсор не выдан сервисом, поврежден или выдан для другой сортировки
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortKey нормализованная сортировка, под которой выдан курсор: "-price", "start_date"
+func sortKey(field string, desc bool) string {
+	if desc {
+		return "-" + field
+	}
+	return field
+}
+
+// encodeCursor непрозрачный для клиента курсор: base64url от JSON с сортировкой,
+// значением поля сортировки и id последней строки
+func encodeCursor(sub *models.Subscription, field string, desc bool) string {
+	cursor := models.SubscriptionCursor{Sort: sortKey(field, desc), ID: sub.ID}
+	switch field {
+	case models.SortPrice:
+		cursor.Value = strconv.Itoa(sub.Price)
+	case models.SortServiceName:
+		cursor.Value = sub.ServiceName
+	case models.SortStartDate:
+		cursor.Value = sub.StartDate.Format(time.DateOnly)
+	case models.SortDeletedAt:
+		if sub.DeletedAt != nil {
+			cursor.Value = sub.DeletedAt.Format(time.RFC3339Nano)
+		}
+	default:
+		cursor.Value = sub.CreatedAt.Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор и проверяет, что он выдан для той же сортировки,
+// а значение имеет тип поля сортировки: иначе сравнение упадет в базе с 500
+func decodeCursor(s, field string, desc bool) (*models.SubscriptionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor models.SubscriptionCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == uuid.Nil || cursor.Value == "" {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sortKey(field, desc) || !validCursorValue(field, cursor.Value) {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// validCursorValue проверяет значение курсора в том формате, в котором его пишет encodeCursor
+func validCursorValue(field, value string) bool {
+	var err error
+	switch field {
+	case models.SortPrice:
+		// price в базе INTEGER
+		_, err = strconv.ParseInt(value, 10, 32)
+	case models.SortServiceName:
+	case models.SortStartDate:
+		_, err = time.Parse(time.DateOnly, value)
+	default:
+		_, err = time.Parse(time.RFC3339Nano, value)
+	}
+	return err == nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidDate дата не в формате YYYY-MM-DD или MM-YYYY
+var ErrInvalidDate = errors.New("invalid date, expected YYYY-MM-DD or MM-YYYY")
+
+// ErrInvalidUserID user_id не UUID
+var ErrInvalidUserID = errors.New("invalid user_id, expected UUID")
+
+// FieldError ошибка в значении поля запроса. Field — имя поля в JSON,
+// причина (ErrInvalidDate, ErrInvalidBillingPeriod, ...) доступна через errors.Is
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func fieldError(field string, err error) error {
+	return &FieldError{Field: field, Err: err}
+}
+
+// ErrBeyondChargeHorizon период отчета заканчивается позже горизонта журнала начислений
+var ErrBeyondChargeHorizon = errors.New("end_date is beyond the charges horizon")
+
+// ErrSubscriptionOverlap у пользователя уже есть подписка на этот сервис в пересекающийся период
+// (validation.overlap_mode: reject)
+var ErrSubscriptionOverlap = errors.New("subscription overlaps an existing subscription to the same service")
+
+// ErrRuleViolation подписка нарушает доменные правила: запрос разобран, но выполнить его нельзя
+var ErrRuleViolation = errors.New("subscription violates domain rules")
+
+// ValidationError все нарушенные доменные правила, по ошибке на поле
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i := range e.Fields {
+		msgs[i] = e.Fields[i].Error()
+	}
+	return ErrRuleViolation.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrRuleViolation
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidExchangeRate некорректные данные курса (формат, валюта, дата)
+var ErrInvalidExchangeRate = errors.New("invalid exchange rate")
+
+type exchangeRateService struct {
+	repo repository.ExchangeRateRepository
+}
+
+func NewExchangeRateService(repo repository.ExchangeRateRepository) ExchangeRateService {
+	return &exchangeRateService{repo: repo}
+}
+
+// Save
+func (s *exchangeRateService) Save(ctx context.Context, reqs []models.CreateExchangeRateReq) (int, error) {
+	log.Info().Int("count", len(reqs)).Msg("Saving exchange rates")
+
+	rates := make([]models.ExchangeRate, 0, len(reqs))
+	for i, req := range reqs {
+		rate, err := newExchangeRate(req.BaseCurrency, req.QuoteCurrency, req.Date, req.Rate)
+		if err != nil {
+			return 0, fmt.Errorf("%w: item %d: %v", ErrInvalidExchangeRate, i, err)
+		}
+		rates = append(rates, *rate)
+	}
+
+	if len(rates) == 0 {
+		return 0, fmt.Errorf("%w: no rates given", ErrInvalidExchangeRate)
+	}
+
+	if err := s.repo.Upsert(ctx, rates); err != nil {
+		return 0, err
+	}
+
+	return len(rates), nil
+}
+
+// Import
+func (s *exchangeRateService) Import(ctx context.Context, r io.Reader) (int, error) {
+	log.Info().Msg("Importing exchange rates from CSV")
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	var rates []models.ExchangeRate
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidExchangeRate, err)
+		}
+
+		// Заголовок необязателен
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "base_currency") {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: line %d: invalid rate %q", ErrInvalidExchangeRate, line, record[3])
+		}
+
+		rate, err := newExchangeRate(record[0], record[1], record[2], value)
+		if err != nil {
+			return 0, fmt.Errorf("%w: line %d: %v", ErrInvalidExchangeRate, line, err)
+		}
+		rates = append(rates, *rate)
+	}
+
+	if len(rates) == 0 {
+		return 0, fmt.Errorf("%w: no rates in file", ErrInvalidExchangeRate)
+	}
+
+	if err := s.repo.Upsert(ctx, rates); err != nil {
+		return 0, err
+	}
+
+	log.Info().Int("count", len(rates)).Msg("Exchange rates imported")
+	return len(rates), nil
+}
+
+// GetAll
+func (s *exchangeRateService) GetAll(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error) {
+	return s.repo.GetAll(ctx, filter)
+}
+
+// newExchangeRate проверяет и собирает курс из сырых значений
+func newExchangeRate(base, quote, date string, value float64) (*models.ExchangeRate, error) {
+	base = strings.TrimSpace(base)
+	quote = strings.TrimSpace(quote)
+
+	if !IsCurrencyCode(base) || !IsCurrencyCode(quote) {
+		return nil, fmt.Errorf("invalid currency pair %s/%s", base, quote)
+	}
+	if base == quote {
+		return nil, fmt.Errorf("base and quote currency are the same: %s", base)
+	}
+
+	rateDate, err := time.Parse("2006-01-02", strings.TrimSpace(date))
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+
+	// ParseFloat принимает NaN и Inf, такой курс сломал бы пересчет стоимости
+	if math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+		return nil, fmt.Errorf("rate must be a positive finite number")
+	}
+
+	return &models.ExchangeRate{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		Date:          rateDate,
+		Rate:          value,
+	}, nil
+}
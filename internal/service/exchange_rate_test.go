@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockExchangeRateRepo struct {
+	upsertFn    func(ctx context.Context, rates []models.ExchangeRate) error
+	getAllFn    func(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error)
+	getLatestFn func(ctx context.Context, base, quote string, on time.Time) (*models.ExchangeRate, error)
+}
+
+func (m *mockExchangeRateRepo) Upsert(ctx context.Context, rates []models.ExchangeRate) error {
+	if m.upsertFn != nil {
+		return m.upsertFn(ctx, rates)
+	}
+	return nil
+}
+
+func (m *mockExchangeRateRepo) GetAll(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error) {
+	if m.getAllFn != nil {
+		return m.getAllFn(ctx, filter)
+	}
+	return nil, nil
+}
+
+func (m *mockExchangeRateRepo) GetLatest(ctx context.Context, base, quote string, on time.Time) (*models.ExchangeRate, error) {
+	if m.getLatestFn != nil {
+		return m.getLatestFn(ctx, base, quote, on)
+	}
+	return nil, nil
+}
+
+func TestExchangeRateService_Save(t *testing.T) {
+	ctx := context.Background()
+	var saved []models.ExchangeRate
+	repo := &mockExchangeRateRepo{
+		upsertFn: func(ctx context.Context, rates []models.ExchangeRate) error {
+			saved = rates
+			return nil
+		},
+	}
+	svc := NewExchangeRateService(repo)
+
+	n, err := svc.Save(ctx, []models.CreateExchangeRateReq{
+		{BaseCurrency: "USD", QuoteCurrency: "RUB", Date: "2025-01-31", Rate: 92.5},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, saved, 1)
+	assert.Equal(t, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), saved[0].Date)
+	assert.Equal(t, 92.5, saved[0].Rate)
+}
+
+func TestExchangeRateService_Save_SameCurrency(t *testing.T) {
+	ctx := context.Background()
+	svc := NewExchangeRateService(&mockExchangeRateRepo{})
+
+	_, err := svc.Save(ctx, []models.CreateExchangeRateReq{
+		{BaseCurrency: "RUB", QuoteCurrency: "RUB", Date: "2025-01-31", Rate: 1},
+	})
+	assert.ErrorIs(t, err, ErrInvalidExchangeRate)
+}
+
+func TestExchangeRateService_Import(t *testing.T) {
+	ctx := context.Background()
+	var saved []models.ExchangeRate
+	repo := &mockExchangeRateRepo{
+		upsertFn: func(ctx context.Context, rates []models.ExchangeRate) error {
+			saved = rates
+			return nil
+		},
+	}
+	svc := NewExchangeRateService(repo)
+
+	csv := "base_currency,quote_currency,date,rate\nUSD,RUB,2025-01-31,92.5\nEUR, RUB, 2025-01-31, 100.1\n"
+	n, err := svc.Import(ctx, strings.NewReader(csv))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.Len(t, saved, 2)
+	assert.Equal(t, "EUR", saved[1].BaseCurrency)
+	assert.Equal(t, 100.1, saved[1].Rate)
+}
+
+func TestExchangeRateService_Import_InvalidLine(t *testing.T) {
+	ctx := context.Background()
+	svc := NewExchangeRateService(&mockExchangeRateRepo{})
+
+	n, err := svc.Import(ctx, strings.NewReader("USD,RUB,2025-01-31,92.5\nUSD,RUB,31.01.2025,93\n"))
+	assert.ErrorIs(t, err, ErrInvalidExchangeRate)
+	assert.Contains(t, err.Error(), "line 2")
+	assert.Equal(t, 0, n)
+
+	// Три заглавные буквы, но не код ISO 4217
+	_, err = svc.Import(ctx, strings.NewReader("ZZZ,RUB,2025-01-31,1.5\n"))
+	assert.ErrorIs(t, err, ErrInvalidExchangeRate)
+
+	for _, value := range []string{"NaN", "Inf", "-Inf", "0"} {
+		_, err = svc.Import(ctx, strings.NewReader("USD,RUB,2025-01-31,"+value+"\n"))
+		assert.ErrorIs(t, err, ErrInvalidExchangeRate, value)
+	}
+}
+
+func TestExchangeRateService_Import_RepoError(t *testing.T) {
+	ctx := context.Background()
+	repoErr := errors.New("db error")
+	svc := NewExchangeRateService(&mockExchangeRateRepo{
+		upsertFn: func(ctx context.Context, rates []models.ExchangeRate) error { return repoErr },
+	})
+
+	_, err := svc.Import(ctx, strings.NewReader("USD,RUB,2025-01-31,92.5\n"))
+	assert.ErrorIs(t, err, repoErr)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrIdempotencyKeyReused ключ уже использован с другим телом запроса
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+	// ErrIdempotencyInProgress запрос с этим ключом еще выполняется
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+// idempotencyTTL сколько хранится ответ на запрос с ключом
+const idempotencyTTL = 24 * time.Hour
+
+type idempotencyService struct {
+	repo repository.IdempotencyRepository
+	now  func() time.Time
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepository) IdempotencyService {
+	return &idempotencyService{repo: repo, now: time.Now}
+}
+
+// Begin занимает ключ за запросом с хешем requestHash. Если запрос с ключом уже выполнен,
+// возвращает сохраненный ответ; nil — запрос нужно выполнить и затем вызвать Complete или Release
+func (s *idempotencyService) Begin(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, error) {
+	now := s.now()
+	existing, err := s.repo.Reserve(ctx, &models.IdempotencyRecord{
+		Owner:       idempotencyOwner(ctx),
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyTTL),
+	})
+	if err != nil || existing == nil {
+		return nil, err
+	}
+
+	if existing.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if existing.StatusCode == nil {
+		return nil, ErrIdempotencyInProgress
+	}
+
+	log.Info().Str("idempotency_key", key).Int("status", *existing.StatusCode).Msg("Replaying idempotent response")
+	return existing, nil
+}
+
+// Complete сохраняет ответ для повторов
+func (s *idempotencyService) Complete(ctx context.Context, key string, status int, response []byte) error {
+	return s.repo.Complete(ctx, idempotencyOwner(ctx), key, status, response)
+}
+
+// Release освобождает ключ, если запрос не удался и его можно повторить
+func (s *idempotencyService) Release(ctx context.Context, key string) error {
+	return s.repo.Release(ctx, idempotencyOwner(ctx), key)
+}
+
+// PurgeExpired удаляет истекшие ключи
+func (s *idempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpired(ctx)
+}
+
+// idempotencyOwner ключи разных клиентов не пересекаются; без аутентификации владелец пустой
+func idempotencyOwner(ctx context.Context) string {
+	if id, ok := reqctx.IdentityFrom(ctx); ok {
+		return id.Subject
+	}
+	return ""
+}
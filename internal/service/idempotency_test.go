@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"em_tz_anvar/internal/models"
+	"em_tz_anvar/internal/reqctx"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockIdempotencyRepo struct {
+	records map[string]*models.IdempotencyRecord
+}
+
+func (m *mockIdempotencyRepo) Reserve(ctx context.Context, rec *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	if existing, ok := m.records[rec.Owner+"/"+rec.Key]; ok {
+		return existing, nil
+	}
+	m.records[rec.Owner+"/"+rec.Key] = rec
+	return nil, nil
+}
+
+func (m *mockIdempotencyRepo) Complete(ctx context.Context, owner, key string, status int, response []byte) error {
+	rec := m.records[owner+"/"+key]
+	rec.StatusCode = &status
+	rec.Response = response
+	return nil
+}
+
+func (m *mockIdempotencyRepo) Release(ctx context.Context, owner, key string) error {
+	delete(m.records, owner+"/"+key)
+	return nil
+}
+
+func (m *mockIdempotencyRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotencyService_Begin(t *testing.T) {
+	repo := &mockIdempotencyRepo{records: map[string]*models.IdempotencyRecord{}}
+	svc := NewIdempotencyService(repo)
+	ctx := context.Background()
+
+	saved, err := svc.Begin(ctx, "k1", "hash")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+
+	// Первый запрос еще выполняется
+	_, err = svc.Begin(ctx, "k1", "hash")
+	assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+
+	require.NoError(t, svc.Complete(ctx, "k1", 201, []byte(`{"id":"1"}`)))
+
+	saved, err = svc.Begin(ctx, "k1", "hash")
+	require.NoError(t, err)
+	require.NotNil(t, saved)
+	assert.Equal(t, 201, *saved.StatusCode)
+
+	_, err = svc.Begin(ctx, "k1", "other-hash")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	// Ключи разных клиентов не пересекаются
+	alice := reqctx.WithIdentity(ctx, &reqctx.Identity{Subject: "alice", Role: reqctx.RoleUser})
+	saved, err = svc.Begin(alice, "k1", "other-hash")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+	assert.Contains(t, repo.records, "alice/k1")
+
+	// Освобожденный ключ можно занять снова
+	require.NoError(t, svc.Release(alice, "k1"))
+	saved, err = svc.Begin(alice, "k1", "hash")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+}
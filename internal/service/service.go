@@ -2,9 +2,12 @@ package service
 
 import (
 	"context"
+	"io"
 
+	"em_tz_anvar/internal/config"
 	"em_tz_anvar/internal/models"
 	"em_tz_anvar/internal/repository"
+	"em_tz_anvar/internal/reqctx"
 
 	"github.com/google/uuid"
 )
@@ -12,18 +15,82 @@ import (
 type SubscriptionService interface {
 	Create(ctx context.Context, req *models.CreateSubscriptionReq) (*models.Subscription, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
-	GetAll(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error)
-	Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq) (*models.Subscription, error)
-	Delete(ctx context.Context, id uuid.UUID) error
+	// GetAll страница списка: с filter.Cursor — продолжение после предыдущей страницы
+	GetAll(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error)
+	// Update, Patch и Delete с version != 0 выполняются, только если подписка не менялась с этой версии (If-Match)
+	Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error)
+	Patch(ctx context.Context, id uuid.UUID, req *models.PatchSubscriptionReq, version int) (*models.Subscription, error)
+	Delete(ctx context.Context, id uuid.UUID, version int) error
+	Restore(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	Purge(ctx context.Context, id uuid.UUID) error
 	GetTotalCost(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error)
+	GetCostBreakdown(ctx context.Context, filter *models.CostFilter) (*models.CostBreakdownResponse, error)
+	GetCharges(ctx context.Context, id uuid.UUID) ([]models.Charge, error)
+	// RebuildCharges пересобирает журнал начислений всех подписок
+	RebuildCharges(ctx context.Context) (int, error)
+	// GetOverlaps пересекающиеся по периоду действующие подписки пользователя на один сервис
+	GetOverlaps(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error)
+	// GetUserSummary число действующих подписок пользователя, его траты и ближайшие списания на сегодня
+	GetUserSummary(ctx context.Context, userID uuid.UUID) (*models.UserSummary, error)
+}
+
+// CatalogService каталог сервисов, на которые ссылаются подписки
+type CatalogService interface {
+	Create(ctx context.Context, req *models.ServiceReq) (*models.Service, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error)
+	GetAll(ctx context.Context, filter *models.ServiceFilter) ([]models.Service, error)
+	Update(ctx context.Context, id uuid.UUID, req *models.ServiceReq) (*models.Service, error)
+	// Delete с mergeInto != nil сливает сервис с mergeInto: подписки и названия переходят к нему
+	Delete(ctx context.Context, id uuid.UUID, mergeInto *uuid.UUID) error
+}
+
+type ExchangeRateService interface {
+	Save(ctx context.Context, reqs []models.CreateExchangeRateReq) (int, error)
+	// Import загружает курсы из CSV: base_currency,quote_currency,date,rate
+	Import(ctx context.Context, r io.Reader) (int, error)
+	GetAll(ctx context.Context, filter *models.ExchangeRateFilter) ([]models.ExchangeRate, error)
+}
+
+// AuditService журнал изменений подписок
+type AuditService interface {
+	List(ctx context.Context, filter *models.AuditFilter) ([]models.AuditEntry, error)
+	GetHistory(ctx context.Context, id uuid.UUID, limit, offset int) ([]models.AuditEntry, error)
+}
+
+// APIKeyService ключи сервисных клиентов
+type APIKeyService interface {
+	Create(ctx context.Context, req *models.CreateAPIKeyReq) (*models.APIKeySecret, error)
+	List(ctx context.Context) ([]models.APIKey, error)
+	Revoke(ctx context.Context, id uuid.UUID) error
+	Rotate(ctx context.Context, id uuid.UUID) (*models.APIKeySecret, error)
+	// Authenticate проверяет ключ из запроса
+	Authenticate(ctx context.Context, key string) (*reqctx.Identity, error)
+}
+
+// IdempotencyService ключи идемпотентности (заголовок Idempotency-Key) для повторяемых POST
+type IdempotencyService interface {
+	Begin(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, status int, response []byte) error
+	Release(ctx context.Context, key string) error
+	PurgeExpired(ctx context.Context) (int64, error)
 }
 
 type Service struct {
 	Subscription SubscriptionService
+	Catalog      CatalogService
+	ExchangeRate ExchangeRateService
+	Audit        AuditService
+	APIKey       APIKeyService
+	Idempotency  IdempotencyService
 }
 
-func NewService(repos *repository.Repository) *Service {
+func NewService(repos *repository.Repository, rules *config.ValidationConfig) *Service {
 	return &Service{
-		Subscription: NewSubscriptionService(repos.Subscription),
+		Subscription: NewSubscriptionService(repos.Subscription, repos.Charge, repos.ExchangeRate, rules),
+		Catalog:      NewCatalogService(repos.Catalog),
+		ExchangeRate: NewExchangeRateService(repos.ExchangeRate),
+		Audit:        NewAuditService(repos.Audit),
+		APIKey:       NewAPIKeyService(repos.APIKey),
+		Idempotency:  NewIdempotencyService(repos.Idempotency),
 	}
 }
@@ -2,9 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"time"
 
+	"em_tz_anvar/internal/config"
 	"em_tz_anvar/internal/models"
 	"em_tz_anvar/internal/repository"
 
@@ -12,12 +17,22 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// ErrInvalidBillingPeriod billing_months задан не для custom или не задан для custom
+var ErrInvalidBillingPeriod = errors.New("invalid billing period")
+
+// ErrInvalidPriceChange price_effective_from без новой цены или в неверном формате
+var ErrInvalidPriceChange = errors.New("invalid price change")
+
 type subscriptionService struct {
-	repo repository.SubscriptionRepository
+	repo    repository.SubscriptionRepository
+	charges repository.ChargeRepository
+	rates   repository.ExchangeRateRepository
+	rules   *config.ValidationConfig
 }
 
-func NewSubscriptionService(repo repository.SubscriptionRepository) SubscriptionService {
-	return &subscriptionService{repo: repo}
+// NewSubscriptionService rules — настраиваемые доменные правила, nil — без ограничений
+func NewSubscriptionService(repo repository.SubscriptionRepository, charges repository.ChargeRepository, rates repository.ExchangeRateRepository, rules *config.ValidationConfig) SubscriptionService {
+	return &subscriptionService{repo: repo, charges: charges, rates: rates, rules: rules}
 }
 
 // Create
@@ -30,40 +45,69 @@ func (s *subscriptionService) Create(ctx context.Context, req *models.CreateSubs
 	//User parsing
 	userID, err := uuid.Parse(req.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user_id format: %w", err)
+		return nil, fieldError("user_id", ErrInvalidUserID)
 	}
 
 	//Parsing
-	startDate, err := parseMonthYear(req.StartDate)
+	startDate, err := parseStartDate(req.StartDate)
 	if err != nil {
-		return nil, fmt.Errorf("invalid start_date format: %w", err)
+		return nil, fieldError("start_date", err)
 	}
 
 	//Parsing
 	var endDate *time.Time
 	if req.EndDate != "" {
-		ed, err := parseMonthYear(req.EndDate)
+		ed, err := parseEndDate(req.EndDate)
 		if err != nil {
-			return nil, fmt.Errorf("invalid end_date format: %w", err)
+			return nil, fieldError("end_date", err)
 		}
 		endDate = &ed
 	}
 
+	currency := req.Currency
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	billingPeriod := req.BillingPeriod
+	if billingPeriod == "" {
+		billingPeriod = models.BillingMonthly
+	}
+	billingMonths, err := billingCycleMonths(billingPeriod, req.BillingMonths)
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	subscription := &models.Subscription{
-		ID:          uuid.New(),
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
-		UserID:      userID,
-		StartDate:   startDate,
-		EndDate:     endDate,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+		ID:            uuid.New(),
+		ServiceName:   req.ServiceName,
+		Price:         req.Price,
+		Currency:      currency,
+		BillingPeriod: billingPeriod,
+		BillingMonths: billingMonths,
+		UserID:        userID,
+		StartDate:     startDate,
+		EndDate:       endDate,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Version:       1,
 	}
 
+	if err := validateSubscription(subscription, s.rules, now); err != nil {
+		return nil, err
+	}
+
+	overlaps, err := s.checkOverlaps(ctx, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	// Начисления строит репозиторий в транзакции создания, см. BuildCharges
 	if err := s.repo.Create(ctx, subscription); err != nil {
 		return nil, err
 	}
+	subscription.Overlaps = overlaps
 
 	log.Info().
 		Str("subscription_id", subscription.ID.String()).
@@ -78,49 +122,105 @@ func (s *subscriptionService) GetByID(ctx context.Context, id uuid.UUID) (*model
 	return s.repo.GetByID(ctx, id)
 }
 
-// GetAll
-func (s *subscriptionService) GetAll(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
+// GetAll возвращает страницу подписок. Курсор продолжает выдачу с места, где закончилась
+// предыдущая страница, поэтому изменения между запросами не сдвигают строки.
+// Курсор действует только с той сортировкой, с которой выдан
+func (s *subscriptionService) GetAll(ctx context.Context, filter *models.SubscriptionFilter) (*models.SubscriptionPage, error) {
 	log.Info().Interface("filter", filter).Msg("Getting all subscriptions")
-	return s.repo.GetAll(ctx, filter)
+
+	field, desc := filter.SortBy()
+	query := *filter
+	if filter.Cursor != "" {
+		after, err := decodeCursor(filter.Cursor, field, desc)
+		if err != nil {
+			return nil, err
+		}
+		query.After = after
+		query.Offset = 0
+	}
+	// Лишняя строка показывает, есть ли следующая страница
+	if filter.Limit > 0 {
+		query.Limit = filter.Limit + 1
+	}
+
+	subscriptions, err := s.repo.GetAll(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Неполная первая страница (или неполная непустая по offset) уже дает итог, отдельный COUNT не нужен
+	total := filter.Offset + len(subscriptions)
+	lastPage := filter.Limit == 0 || len(subscriptions) <= filter.Limit
+	if query.After != nil || !lastPage || (len(subscriptions) == 0 && filter.Offset > 0) {
+		if total, err = s.repo.Count(ctx, filter); err != nil {
+			return nil, err
+		}
+	}
+
+	page := &models.SubscriptionPage{Items: subscriptions, Total: total}
+	if filter.Limit > 0 && len(subscriptions) > filter.Limit {
+		page.Items = subscriptions[:filter.Limit]
+		page.NextCursor = encodeCursor(&page.Items[filter.Limit-1], field, desc)
+	}
+	if page.Items == nil {
+		page.Items = []models.Subscription{}
+	}
+	return page, nil
 }
 
-// Update выполняет атомарное обновление подписки
-func (s *subscriptionService) Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq) (*models.Subscription, error) {
+// Update заменяет подписку целиком (PUT)
+func (s *subscriptionService) Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionReq, version int) (*models.Subscription, error) {
 	log.Info().Str("subscription_id", id.String()).Msg("Updating subscription")
 
+	return s.modify(ctx, id, version, func(sub *models.Subscription) error {
+		return replaceSubscription(sub, req)
+	})
+}
+
+// Patch частично изменяет подписку (PATCH): патч накладывается на текущее состояние,
+// а результат применяется как полная замена
+func (s *subscriptionService) Patch(ctx context.Context, id uuid.UUID, req *models.PatchSubscriptionReq, version int) (*models.Subscription, error) {
+	log.Info().Str("subscription_id", id.String()).Msg("Patching subscription")
+
+	return s.modify(ctx, id, version, func(sub *models.Subscription) error {
+		merged, err := mergePatch(sub, req)
+		if err != nil {
+			return err
+		}
+		return replaceSubscription(sub, merged)
+	})
+}
+
+// modify выполняет атомарное обновление подписки; начисления перестраиваются в той же транзакции
+func (s *subscriptionService) modify(ctx context.Context, id uuid.UUID, version int, apply func(*models.Subscription) error) (*models.Subscription, error) {
+	var overlaps []uuid.UUID
+
 	// Используем атомарное обновление с SELECT FOR UPDATE
 	subscription, err := s.repo.UpdateAtomically(ctx, id, func(sub *models.Subscription) error {
-		if req.ServiceName != "" {
-			sub.ServiceName = req.ServiceName
+		// Версия сверяется под блокировкой строки, поэтому параллельное изменение не проскочит
+		if version != 0 && sub.Version != version {
+			return repository.ErrVersionMismatch
 		}
-
-		if req.Price > 0 {
-			sub.Price = req.Price
+		if err := apply(sub); err != nil {
+			return err
 		}
-
-		if req.StartDate != "" {
-			startDate, err := parseMonthYear(req.StartDate)
-			if err != nil {
-				return fmt.Errorf("invalid start_date format: %w", err)
-			}
-			sub.StartDate = startDate
+		now := time.Now()
+		if err := validateSubscription(sub, s.rules, now); err != nil {
+			return err
 		}
-
-		if req.EndDate != "" {
-			endDate, err := parseMonthYear(req.EndDate)
-			if err != nil {
-				return fmt.Errorf("invalid end_date format: %w", err)
-			}
-			sub.EndDate = &endDate
+		var err error
+		if overlaps, err = s.checkOverlaps(ctx, sub); err != nil {
+			return err
 		}
-
-		sub.UpdatedAt = time.Now()
+		sub.UpdatedAt = now
 		return nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
+	// В журнал изменений пересечения не попадают, только в ответ
+	subscription.Overlaps = overlaps
 
 	log.Info().
 		Str("subscription_id", subscription.ID.String()).
@@ -129,10 +229,332 @@ func (s *subscriptionService) Update(ctx context.Context, id uuid.UUID, req *mod
 	return subscription, nil
 }
 
-// Delete
-func (s *subscriptionService) Delete(ctx context.Context, id uuid.UUID) error {
+// checkOverlaps ищет действующие подписки пользователя на тот же сервис с пересекающимся периодом.
+// В режиме reject пересечение — ErrSubscriptionOverlap, в warn — ID подписок для ответа.
+// Проверка идет до записи и без блокировки: два одновременных запроса могут создать пересечение,
+// его покажет отчет GetOverlaps
+func (s *subscriptionService) checkOverlaps(ctx context.Context, sub *models.Subscription) ([]uuid.UUID, error) {
+	if s.rules == nil || (s.rules.OverlapMode != config.OverlapWarn && s.rules.OverlapMode != config.OverlapReject) {
+		return nil, nil
+	}
+
+	ids, err := s.repo.FindOverlaps(ctx, sub)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	if s.rules.OverlapMode == config.OverlapReject {
+		return nil, fmt.Errorf("%w: %s", ErrSubscriptionOverlap, joinIDs(ids))
+	}
+
+	log.Warn().
+		Str("subscription_id", sub.ID.String()).
+		Str("user_id", sub.UserID.String()).
+		Str("overlaps", joinIDs(ids)).
+		Msg("Subscription overlaps existing subscriptions to the same service")
+	return ids, nil
+}
+
+func joinIDs(ids []uuid.UUID) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = id.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// GetOverlaps пересечения действующих подписок пользователя на один сервис: такие подписки
+// дважды учитываются в отчетах по стоимости
+func (s *subscriptionService) GetOverlaps(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error) {
+	log.Info().Str("user_id", userID.String()).Msg("Getting overlapping subscriptions")
+
+	overlaps, err := s.repo.GetOverlaps(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if overlaps == nil {
+		overlaps = []models.SubscriptionOverlap{}
+	}
+	return overlaps, nil
+}
+
+// GetUserSummary собирает сводку из тех же запросов, что список и отчеты по стоимости:
+// траты считаются по журналу начислений без пропорции, ближайшее списание берется из него же
+func (s *subscriptionService) GetUserSummary(ctx context.Context, userID uuid.UUID) (*models.UserSummary, error) {
+	log.Info().Str("user_id", userID.String()).Msg("Getting user summary")
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	summary := &models.UserSummary{
+		UserID:            userID,
+		AsOf:              today,
+		CurrentMonthSpend: []models.CurrencyCost{},
+		LifetimeSpend:     []models.CurrencyCost{},
+		NextRenewals:      []models.UpcomingCharge{},
+	}
+
+	active, err := s.repo.Count(ctx, &models.SubscriptionFilter{UserID: &userID, ActiveAt: &today})
+	if err != nil {
+		return nil, err
+	}
+	summary.ActiveCount = active
+
+	if err := s.extendCharges(ctx, endOfMonth(today)); err != nil {
+		return nil, err
+	}
+
+	month, err := s.repo.GetTotalCost(ctx, &models.CostFilter{UserID: &userID, StartDate: startOfMonth(today), EndDate: endOfMonth(today)})
+	if err != nil {
+		return nil, err
+	}
+	if month != nil {
+		summary.CurrentMonthSpend = month
+	}
+
+	// Первая по дате начала подписка задает начало периода для трат за все время
+	subscriptions, err := s.repo.GetAll(ctx, &models.SubscriptionFilter{UserID: &userID, Sort: models.SortStartDate})
+	if err != nil {
+		return nil, err
+	}
+	if len(subscriptions) == 0 {
+		return summary, nil
+	}
+
+	lifetime, err := s.repo.GetTotalCost(ctx, &models.CostFilter{UserID: &userID, StartDate: subscriptions[0].StartDate, EndDate: today})
+	if err != nil {
+		return nil, err
+	}
+	if lifetime != nil {
+		summary.LifetimeSpend = lifetime
+	}
+
+	// Сегодняшнее списание уже учтено в тратах, ближайшее — следующее за ним
+	charges, err := s.charges.NextByUser(ctx, userID, today)
+	if err != nil {
+		return nil, err
+	}
+	next := make(map[uuid.UUID]models.Charge, len(charges))
+	for _, charge := range charges {
+		next[charge.SubscriptionID] = charge
+	}
+
+	for i := range subscriptions {
+		sub := &subscriptions[i]
+		if sub.EndDate != nil && !sub.EndDate.After(today) {
+			continue
+		}
+
+		charge, ok := next[sub.ID]
+		if !ok {
+			continue
+		}
+		summary.NextRenewals = append(summary.NextRenewals, models.UpcomingCharge{
+			SubscriptionID: sub.ID,
+			ServiceName:    sub.ServiceName,
+			Date:           charge.PeriodStart,
+			Amount:         charge.Amount,
+			Currency:       charge.Currency,
+		})
+	}
+
+	sort.SliceStable(summary.NextRenewals, func(i, j int) bool {
+		return summary.NextRenewals[i].Date.Before(summary.NextRenewals[j].Date)
+	})
+
+	return summary, nil
+}
+
+// replaceSubscription записывает в подписку все поля запроса; пустые необязательные поля — значения по умолчанию
+func replaceSubscription(sub *models.Subscription, req *models.UpdateSubscriptionReq) error {
+	startDate, err := parseStartDate(req.StartDate)
+	if err != nil {
+		return fieldError("start_date", err)
+	}
+
+	var endDate *time.Time
+	if req.EndDate != "" {
+		ed, err := parseEndDate(req.EndDate)
+		if err != nil {
+			return fieldError("end_date", err)
+		}
+		endDate = &ed
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	billingPeriod := req.BillingPeriod
+	if billingPeriod == "" {
+		billingPeriod = models.BillingMonthly
+	}
+	billingMonths, err := billingCycleMonths(billingPeriod, req.BillingMonths)
+	if err != nil {
+		return err
+	}
+
+	// История цен пишется, только если цена изменилась или явно задана дата ее действия
+	if req.Price != sub.Price || req.PriceEffectiveFrom != "" {
+		effectiveFrom := time.Now().UTC().Truncate(24 * time.Hour)
+		if req.PriceEffectiveFrom != "" {
+			date, err := parseStartDate(req.PriceEffectiveFrom)
+			if err != nil {
+				return fieldError("price_effective_from", fmt.Errorf("%w: %w", ErrInvalidPriceChange, err))
+			}
+			effectiveFrom = date
+		}
+		sub.PriceEffectiveFrom = &effectiveFrom
+	}
+
+	sub.ServiceName = req.ServiceName
+	sub.Price = req.Price
+	sub.Currency = currency
+	sub.BillingPeriod = billingPeriod
+	sub.BillingMonths = billingMonths
+	sub.StartDate = startDate
+	sub.EndDate = endDate
+	return nil
+}
+
+// mergePatch накладывает merge patch на текущее состояние подписки и возвращает его как запрос полной замены
+func mergePatch(sub *models.Subscription, patch *models.PatchSubscriptionReq) (*models.UpdateSubscriptionReq, error) {
+	if patch.PriceEffectiveFrom.Present() && !patch.Price.Present() {
+		return nil, fieldError("price_effective_from", fmt.Errorf("%w: price_effective_from requires price", ErrInvalidPriceChange))
+	}
+
+	req := &models.UpdateSubscriptionReq{
+		ServiceName:   sub.ServiceName,
+		Price:         sub.Price,
+		Currency:      sub.Currency,
+		BillingPeriod: sub.BillingPeriod,
+		StartDate:     sub.StartDate.Format("2006-01-02"),
+	}
+	if sub.BillingMonths != nil {
+		req.BillingMonths = *sub.BillingMonths
+	}
+	if sub.EndDate != nil {
+		req.EndDate = sub.EndDate.Format("2006-01-02")
+	}
+
+	// null у полей с умолчанием превращается в пустое значение, replaceSubscription подставит умолчание
+	mergeField(&req.ServiceName, patch.ServiceName)
+	mergeField(&req.Price, patch.Price)
+	mergeField(&req.PriceEffectiveFrom, patch.PriceEffectiveFrom)
+	mergeField(&req.Currency, patch.Currency)
+	mergeField(&req.BillingPeriod, patch.BillingPeriod)
+	mergeField(&req.BillingMonths, patch.BillingMonths)
+	mergeField(&req.StartDate, patch.StartDate)
+	mergeField(&req.EndDate, patch.EndDate)
+
+	// Смена периода без billing_months сбрасывает длину цикла, которая нужна только custom
+	if patch.BillingPeriod.Set && !patch.BillingMonths.Set && req.BillingPeriod != models.BillingCustom {
+		req.BillingMonths = 0
+	}
+	return req, nil
+}
+
+// mergeField применяет одно поле патча: значение заменяет текущее, null обнуляет
+func mergeField[T any](dst *T, field models.Nullable[T]) {
+	if !field.Set {
+		return
+	}
+	var zero T
+	if field.Null {
+		*dst = zero
+		return
+	}
+	*dst = field.Value
+}
+
+// Delete переносит подписку в корзину, начисления остаются, но не попадают в отчеты
+func (s *subscriptionService) Delete(ctx context.Context, id uuid.UUID, version int) error {
 	log.Info().Str("subscription_id", id.String()).Msg("Deleting subscription")
-	return s.repo.Delete(ctx, id)
+
+	return s.repo.Delete(ctx, id, version)
+}
+
+// Restore возвращает подписку из корзины; репозиторий перестраивает ее начисления (горизонт мог устареть)
+func (s *subscriptionService) Restore(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	log.Info().Str("subscription_id", id.String()).Msg("Restoring subscription")
+
+	if err := s.repo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
+
+// Purge окончательно удаляет подписку из корзины, начисления и история цен удаляются каскадно
+func (s *subscriptionService) Purge(ctx context.Context, id uuid.UUID) error {
+	log.Info().Str("subscription_id", id.String()).Msg("Purging subscription")
+
+	return s.repo.Purge(ctx, id)
+}
+
+// GetCharges возвращает журнал начислений подписки
+func (s *subscriptionService) GetCharges(ctx context.Context, id uuid.UUID) ([]models.Charge, error) {
+	log.Info().Str("subscription_id", id.String()).Msg("Getting subscription charges")
+
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.charges.GetBySubscription(ctx, id)
+}
+
+// RebuildCharges достраивает журнал начислений до текущего горизонта: подпискам без начислений
+// строит их, у бессрочных сдвигает горизонт. Возвращает число перестроенных подписок
+func (s *subscriptionService) RebuildCharges(ctx context.Context) (int, error) {
+	log.Info().Msg("Rebuilding charges ledger")
+
+	n, err := s.rebuildStaleCharges(ctx, chargeHorizon(time.Now()))
+	if err != nil {
+		return n, err
+	}
+
+	log.Info().Int("subscriptions", n).Msg("Charges ledger rebuilt")
+	return n, nil
+}
+
+// prepareCharges отчеты по стоимости читают журнал начислений: период отчета не может выходить
+// за горизонт, а устаревший горизонт бессрочных подписок сдвигается до конца периода
+func (s *subscriptionService) prepareCharges(ctx context.Context, filter *models.CostFilter) error {
+	if filter.EndDate.IsZero() {
+		return nil
+	}
+
+	if horizon := chargeHorizon(time.Now()); filter.EndDate.After(horizon) {
+		return fieldError("end_date", fmt.Errorf("%w: charges are built up to %s", ErrBeyondChargeHorizon, horizon.Format("01-2006")))
+	}
+
+	return s.extendCharges(ctx, filter.EndDate)
+}
+
+// extendCharges достраивает журнал подписок, начисления которых не доходят до until
+func (s *subscriptionService) extendCharges(ctx context.Context, until time.Time) error {
+	n, err := s.rebuildStaleCharges(ctx, until)
+	if n > 0 {
+		log.Info().Int("subscriptions", n).Time("until", until).Msg("Charges ledger extended")
+	}
+	return err
+}
+
+// rebuildStaleCharges перестраивает начисления подписок, у которых журнал кончается раньше until.
+// Подписку могли удалить окончательно между поиском и перестройкой, ее пропускаем
+func (s *subscriptionService) rebuildStaleCharges(ctx context.Context, until time.Time) (int, error) {
+	ids, err := s.repo.StaleCharges(ctx, until)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := s.repo.RebuildCharges(ctx, id); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Error().Err(err).Str("subscription_id", id.String()).Msg("Failed to rebuild charges")
+			return i, err
+		}
+	}
+
+	return len(ids), nil
 }
 
 // GetTotalCost
@@ -141,18 +563,225 @@ func (s *subscriptionService) GetTotalCost(ctx context.Context, filter *models.C
 		Interface("filter", filter).
 		Msg("Calculating total cost")
 
-	totalCost, err := s.repo.GetTotalCost(ctx, filter)
+	if err := s.prepareCharges(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	if filter.TargetCurrency != "" {
+		return s.getConvertedCost(ctx, filter)
+	}
+
+	totals, err := s.repo.GetTotalCost(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.TotalCostResponse{Totals: totals}
+	switch len(totals) {
+	case 0:
+		// Подписок за период нет: отдаём ноль в запрошенной валюте
+		resp.Currency = filter.Currency
+		if resp.Currency == "" {
+			resp.Currency = models.DefaultCurrency
+		}
+		resp.Totals = []models.CurrencyCost{}
+	case 1:
+		resp.TotalCost = totals[0].TotalCost
+		resp.Currency = totals[0].Currency
+	}
+	// Если валют несколько, складывать их нельзя — итог только в Totals
+
+	if filter.GroupBy != "" {
+		groups, err := s.repo.GetCostGroups(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		resp.Groups = groups
+	}
+
+	return resp, nil
+}
+
+// GetCostBreakdown строит временной ряд стоимости: по строке на каждый месяц периода,
+// месяцы без подписок тоже попадают в ответ с пустым списком
+func (s *subscriptionService) GetCostBreakdown(ctx context.Context, filter *models.CostFilter) (*models.CostBreakdownResponse, error) {
+	log.Info().
+		Interface("filter", filter).
+		Msg("Calculating cost breakdown")
+
+	if err := s.prepareCharges(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.repo.GetMonthlyCost(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.CostBreakdownResponse{
+		GroupBy: filter.GroupBy,
+		Months:  []models.CostBreakdownMonth{},
+	}
+
+	index := make(map[string]int)
+	last := startOfMonth(filter.EndDate)
+	for m := startOfMonth(filter.StartDate); !m.After(last); m = m.AddDate(0, 1, 0) {
+		month := m.Format("01-2006")
+		index[month] = len(resp.Months)
+		resp.Months = append(resp.Months, models.CostBreakdownMonth{
+			Month: month,
+			Items: []models.CostBreakdownItem{},
+		})
+	}
+
+	for _, row := range rows {
+		i, ok := index[row.Month.Format("01-2006")]
+		if !ok {
+			continue
+		}
+		resp.Months[i].Items = append(resp.Months[i].Items, models.CostBreakdownItem{
+			Key:       row.Key,
+			Currency:  row.Currency,
+			TotalCost: row.TotalCost,
+		})
+	}
+
+	return resp, nil
+}
+
+// getConvertedCost пересчитывает стоимость каждого месяца в TargetCurrency по курсу из таблицы курсов.
+// Месяцы без курса не попадают в итог и возвращаются в MissingRates
+func (s *subscriptionService) getConvertedCost(ctx context.Context, filter *models.CostFilter) (*models.TotalCostResponse, error) {
+	months, err := s.repo.GetMonthlyCost(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.TotalCostResponse{
+		Currency: filter.TargetCurrency,
+		Totals:   []models.CurrencyCost{},
+	}
+
+	totals := make(map[string]int)
+	var converted float64
+	for _, m := range months {
+		totals[m.Currency] += m.TotalCost
+
+		if m.Currency == filter.TargetCurrency {
+			converted += float64(m.TotalCost)
+			continue
+		}
+
+		month := m.Month.Format("01-2006")
+		rate, err := s.findRate(ctx, m.Currency, filter.TargetCurrency, endOfMonth(m.Month))
+		if errors.Is(err, repository.ErrRateNotFound) {
+			log.Warn().
+				Str("month", month).
+				Str("currency", m.Currency).
+				Str("target_currency", filter.TargetCurrency).
+				Msg("No exchange rate for month")
+			resp.MissingRates = append(resp.MissingRates, models.MissingRate{
+				Month:    month,
+				Currency: m.Currency,
+				Amount:   m.TotalCost,
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		converted += float64(m.TotalCost) * rate.Rate
+		resp.RatesUsed = append(resp.RatesUsed, models.AppliedRate{
+			Month:    month,
+			From:     m.Currency,
+			To:       filter.TargetCurrency,
+			Rate:     rate.Rate,
+			RateDate: rate.Date.Format("2006-01-02"),
+		})
+	}
+
+	resp.TotalCost = int(math.Round(converted))
+
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		resp.Totals = append(resp.Totals, models.CurrencyCost{Currency: currency, TotalCost: totals[currency]})
+	}
+
+	return resp, nil
+}
+
+// findRate ищет курс from->to на дату; если есть только обратный курс, берёт 1/rate
+func (s *subscriptionService) findRate(ctx context.Context, from, to string, on time.Time) (*models.ExchangeRate, error) {
+	rate, err := s.rates.GetLatest(ctx, from, to, on)
+	if err == nil {
+		return rate, nil
+	}
+	if !errors.Is(err, repository.ErrRateNotFound) {
+		return nil, err
+	}
+
+	inverse, err := s.rates.GetLatest(ctx, to, from, on)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.TotalCostResponse{
-		TotalCost: totalCost,
-		Currency:  "RUB",
+	return &models.ExchangeRate{
+		BaseCurrency:  from,
+		QuoteCurrency: to,
+		Date:          inverse.Date,
+		Rate:          1 / inverse.Rate,
 	}, nil
 }
 
-// parseMonthYear
-func parseMonthYear(s string) (time.Time, error) {
-	return time.Parse("01-2006", s)
+// billingCycleMonths проверяет длину цикла: months обязателен для custom и запрещен для остальных периодов
+func billingCycleMonths(period string, months int) (*int, error) {
+	if period != models.BillingCustom {
+		if months > 0 {
+			return nil, fieldError("billing_months", fmt.Errorf("%w: billing_months is only allowed for custom billing_period", ErrInvalidBillingPeriod))
+		}
+		return nil, nil
+	}
+	if months <= 0 {
+		return nil, fieldError("billing_months", fmt.Errorf("%w: billing_months is required for custom billing_period", ErrInvalidBillingPeriod))
+	}
+	return &months, nil
+}
+
+// startOfMonth первый день месяца, к которому относится t
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// endOfMonth последний день месяца, к которому относится t
+func endOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location())
+}
+
+// parseStartDate парсит дату начала: YYYY-MM-DD или MM-YYYY (первое число месяца)
+func parseStartDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("01-2006", s)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	return t, nil
+}
+
+// parseEndDate парсит дату окончания: YYYY-MM-DD или MM-YYYY (последнее число месяца, подписка действует весь месяц)
+func parseEndDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("01-2006", s)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	return endOfMonth(t), nil
 }
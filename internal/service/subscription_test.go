@@ -2,7 +2,10 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -18,10 +21,48 @@ type mockSubscriptionRepo struct {
 	createFn          func(ctx context.Context, sub *models.Subscription) error
 	getByIDFn         func(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
 	getAllFn          func(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error)
-	updateFn          func(ctx context.Context, sub *models.Subscription) error
+	countFn           func(ctx context.Context, filter *models.SubscriptionFilter) (int, error)
 	updateAtomicallyFn func(ctx context.Context, id uuid.UUID, updateFn func(*models.Subscription) error) (*models.Subscription, error)
-	deleteFn          func(ctx context.Context, id uuid.UUID) error
-	getTotalCostFn    func(ctx context.Context, filter *models.CostFilter) (int, error)
+	deleteFn          func(ctx context.Context, id uuid.UUID, version int) error
+	getTotalCostFn    func(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error)
+	getMonthlyCostFn  func(ctx context.Context, filter *models.CostFilter) ([]models.MonthlyCost, error)
+	getCostGroupsFn   func(ctx context.Context, filter *models.CostFilter) ([]models.CostGroup, error)
+	getPriceHistoryFn func(ctx context.Context, id uuid.UUID) ([]models.PriceChange, error)
+	restoreFn         func(ctx context.Context, id uuid.UUID) error
+	purgeFn           func(ctx context.Context, id uuid.UUID) error
+	getOwnerFn        func(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
+	findOverlapsFn    func(ctx context.Context, sub *models.Subscription) ([]uuid.UUID, error)
+	getOverlapsFn     func(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error)
+	staleChargesFn    func(ctx context.Context, until time.Time) ([]uuid.UUID, error)
+	rebuildChargesFn  func(ctx context.Context, id uuid.UUID) error
+}
+
+func (m *mockSubscriptionRepo) GetOwner(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	if m.getOwnerFn != nil {
+		return m.getOwnerFn(ctx, id)
+	}
+	return uuid.Nil, nil
+}
+
+func (m *mockSubscriptionRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	if m.restoreFn != nil {
+		return m.restoreFn(ctx, id)
+	}
+	return nil
+}
+
+func (m *mockSubscriptionRepo) Purge(ctx context.Context, id uuid.UUID) error {
+	if m.purgeFn != nil {
+		return m.purgeFn(ctx, id)
+	}
+	return nil
+}
+
+func (m *mockSubscriptionRepo) GetPriceHistory(ctx context.Context, id uuid.UUID) ([]models.PriceChange, error) {
+	if m.getPriceHistoryFn != nil {
+		return m.getPriceHistoryFn(ctx, id)
+	}
+	return nil, nil
 }
 
 func (m *mockSubscriptionRepo) Create(ctx context.Context, sub *models.Subscription) error {
@@ -45,11 +86,11 @@ func (m *mockSubscriptionRepo) GetAll(ctx context.Context, filter *models.Subscr
 	return nil, nil
 }
 
-func (m *mockSubscriptionRepo) Update(ctx context.Context, sub *models.Subscription) error {
-	if m.updateFn != nil {
-		return m.updateFn(ctx, sub)
+func (m *mockSubscriptionRepo) Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+	if m.countFn != nil {
+		return m.countFn(ctx, filter)
 	}
-	return nil
+	return 0, nil
 }
 
 func (m *mockSubscriptionRepo) UpdateAtomically(ctx context.Context, id uuid.UUID, updateFn func(*models.Subscription) error) (*models.Subscription, error) {
@@ -59,18 +100,79 @@ func (m *mockSubscriptionRepo) UpdateAtomically(ctx context.Context, id uuid.UUI
 	return nil, nil
 }
 
-func (m *mockSubscriptionRepo) Delete(ctx context.Context, id uuid.UUID) error {
+func (m *mockSubscriptionRepo) Delete(ctx context.Context, id uuid.UUID, version int) error {
 	if m.deleteFn != nil {
-		return m.deleteFn(ctx, id)
+		return m.deleteFn(ctx, id, version)
 	}
 	return nil
 }
 
-func (m *mockSubscriptionRepo) GetTotalCost(ctx context.Context, filter *models.CostFilter) (int, error) {
+func (m *mockSubscriptionRepo) GetTotalCost(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error) {
 	if m.getTotalCostFn != nil {
 		return m.getTotalCostFn(ctx, filter)
 	}
-	return 0, nil
+	return nil, nil
+}
+
+func (m *mockSubscriptionRepo) GetMonthlyCost(ctx context.Context, filter *models.CostFilter) ([]models.MonthlyCost, error) {
+	if m.getMonthlyCostFn != nil {
+		return m.getMonthlyCostFn(ctx, filter)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionRepo) GetCostGroups(ctx context.Context, filter *models.CostFilter) ([]models.CostGroup, error) {
+	if m.getCostGroupsFn != nil {
+		return m.getCostGroupsFn(ctx, filter)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionRepo) FindOverlaps(ctx context.Context, sub *models.Subscription) ([]uuid.UUID, error) {
+	if m.findOverlapsFn != nil {
+		return m.findOverlapsFn(ctx, sub)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionRepo) GetOverlaps(ctx context.Context, userID uuid.UUID) ([]models.SubscriptionOverlap, error) {
+	if m.getOverlapsFn != nil {
+		return m.getOverlapsFn(ctx, userID)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionRepo) StaleCharges(ctx context.Context, until time.Time) ([]uuid.UUID, error) {
+	if m.staleChargesFn != nil {
+		return m.staleChargesFn(ctx, until)
+	}
+	return nil, nil
+}
+
+func (m *mockSubscriptionRepo) RebuildCharges(ctx context.Context, id uuid.UUID) error {
+	if m.rebuildChargesFn != nil {
+		return m.rebuildChargesFn(ctx, id)
+	}
+	return nil
+}
+
+type mockChargeRepo struct {
+	getBySubscriptionFn func(ctx context.Context, subscriptionID uuid.UUID) ([]models.Charge, error)
+	nextByUserFn        func(ctx context.Context, userID uuid.UUID, after time.Time) ([]models.Charge, error)
+}
+
+func (m *mockChargeRepo) GetBySubscription(ctx context.Context, subscriptionID uuid.UUID) ([]models.Charge, error) {
+	if m.getBySubscriptionFn != nil {
+		return m.getBySubscriptionFn(ctx, subscriptionID)
+	}
+	return nil, nil
+}
+
+func (m *mockChargeRepo) NextByUser(ctx context.Context, userID uuid.UUID, after time.Time) ([]models.Charge, error) {
+	if m.nextByUserFn != nil {
+		return m.nextByUserFn(ctx, userID, after)
+	}
+	return nil, nil
 }
 
 func TestSubscriptionService_Create(t *testing.T) {
@@ -83,7 +185,7 @@ func TestSubscriptionService_Create(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	req := &models.CreateSubscriptionReq{
 		ServiceName: "Yandex Plus",
@@ -98,14 +200,98 @@ func TestSubscriptionService_Create(t *testing.T) {
 	assert.NotEqual(t, uuid.Nil, sub.ID)
 	assert.Equal(t, "Yandex Plus", sub.ServiceName)
 	assert.Equal(t, 400, sub.Price)
+	assert.Equal(t, models.DefaultCurrency, sub.Currency)
 	assert.Equal(t, userID, capturedSub.UserID.String())
 	assert.Equal(t, "01-2025", capturedSub.StartDate.Format("01-2006"))
 }
 
+func TestSubscriptionService_Create_WithCurrency(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockSubscriptionRepo{}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	req := &models.CreateSubscriptionReq{
+		ServiceName: "Netflix",
+		Price:       15,
+		Currency:    "USD",
+		UserID:      uuid.New().String(),
+		StartDate:   "01-2025",
+	}
+
+	sub, err := svc.Create(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "USD", sub.Currency)
+}
+
+func TestSubscriptionService_Create_DayPrecision(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockSubscriptionRepo{}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	req := &models.CreateSubscriptionReq{
+		ServiceName: "Yandex Plus",
+		Price:       400,
+		UserID:      uuid.New().String(),
+		StartDate:   "2025-01-20",
+		EndDate:     "03-2025",
+	}
+
+	sub, err := svc.Create(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC), sub.StartDate)
+	require.NotNil(t, sub.EndDate)
+	// MM-YYYY в end_date — подписка действует до конца месяца
+	assert.Equal(t, time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC), *sub.EndDate)
+}
+
+func TestSubscriptionService_Create_BillingPeriod(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockSubscriptionRepo{}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	sub, err := svc.Create(ctx, &models.CreateSubscriptionReq{
+		ServiceName: "Yandex Plus",
+		Price:       400,
+		UserID:      uuid.New().String(),
+		StartDate:   "01-2025",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.BillingMonthly, sub.BillingPeriod)
+	assert.Nil(t, sub.BillingMonths)
+
+	sub, err = svc.Create(ctx, &models.CreateSubscriptionReq{
+		ServiceName:   "Kinopoisk",
+		Price:         1500,
+		BillingPeriod: models.BillingCustom,
+		BillingMonths: 6,
+		UserID:        uuid.New().String(),
+		StartDate:     "01-2025",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.BillingCustom, sub.BillingPeriod)
+	require.NotNil(t, sub.BillingMonths)
+	assert.Equal(t, 6, *sub.BillingMonths)
+}
+
+func TestSubscriptionService_Create_InvalidBillingMonths(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockSubscriptionRepo{}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	for _, req := range []*models.CreateSubscriptionReq{
+		{ServiceName: "A", Price: 100, BillingPeriod: models.BillingCustom, UserID: uuid.New().String(), StartDate: "01-2025"},
+		{ServiceName: "B", Price: 100, BillingPeriod: models.BillingYearly, BillingMonths: 12, UserID: uuid.New().String(), StartDate: "01-2025"},
+	} {
+		sub, err := svc.Create(ctx, req)
+		assert.ErrorIs(t, err, ErrInvalidBillingPeriod)
+		assert.Nil(t, sub)
+	}
+}
+
 func TestSubscriptionService_Create_InvalidUserID(t *testing.T) {
 	ctx := context.Background()
 	repo := &mockSubscriptionRepo{}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	req := &models.CreateSubscriptionReq{
 		ServiceName: "Yandex",
@@ -115,15 +301,17 @@ func TestSubscriptionService_Create_InvalidUserID(t *testing.T) {
 	}
 
 	sub, err := svc.Create(ctx, req)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidUserID)
 	assert.Nil(t, sub)
-	assert.Contains(t, err.Error(), "user_id")
+	var fieldErr *FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "user_id", fieldErr.Field)
 }
 
 func TestSubscriptionService_Create_InvalidStartDate(t *testing.T) {
 	ctx := context.Background()
 	repo := &mockSubscriptionRepo{}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	req := &models.CreateSubscriptionReq{
 		ServiceName: "Yandex",
@@ -133,9 +321,11 @@ func TestSubscriptionService_Create_InvalidStartDate(t *testing.T) {
 	}
 
 	sub, err := svc.Create(ctx, req)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidDate)
 	assert.Nil(t, sub)
-	assert.Contains(t, err.Error(), "start_date")
+	var fieldErr *FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "start_date", fieldErr.Field)
 }
 
 func TestSubscriptionService_GetByID(t *testing.T) {
@@ -155,7 +345,7 @@ func TestSubscriptionService_GetByID(t *testing.T) {
 			return expected, nil
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	sub, err := svc.GetByID(ctx, id)
 	require.NoError(t, err)
@@ -170,7 +360,7 @@ func TestSubscriptionService_GetByID_NotFound(t *testing.T) {
 			return nil, repository.ErrNotFound
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	sub, err := svc.GetByID(ctx, id)
 	assert.ErrorIs(t, err, repository.ErrNotFound)
@@ -187,12 +377,143 @@ func TestSubscriptionService_GetAll(t *testing.T) {
 			return list, nil
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	result, err := svc.GetAll(ctx, &models.SubscriptionFilter{Limit: 10})
 	require.NoError(t, err)
-	assert.Len(t, result, 1)
-	assert.Equal(t, "A", result[0].ServiceName)
+	assert.Len(t, result.Items, 1)
+	assert.Equal(t, "A", result.Items[0].ServiceName)
+	assert.Empty(t, result.NextCursor)
+	// Единственная неполная страница — итог известен без COUNT
+	assert.Equal(t, 1, result.Total)
+}
+
+func TestSubscriptionService_GetAll_Cursor(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	list := make([]models.Subscription, 5)
+	for i := range list {
+		list[i] = models.Subscription{ID: uuid.New(), ServiceName: fmt.Sprintf("S%d", i), CreatedAt: base.Add(-time.Duration(i) * time.Hour)}
+	}
+	var queries []models.SubscriptionFilter
+	repo := &mockSubscriptionRepo{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
+			queries = append(queries, *filter)
+			rows := list
+			if filter.After != nil {
+				for i := range list {
+					if list[i].ID == filter.After.ID {
+						rows = list[i+1:]
+					}
+				}
+			}
+			if len(rows) > filter.Limit {
+				rows = rows[:filter.Limit]
+			}
+			return rows, nil
+		},
+		countFn: func(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+			// Итог считается по фильтру без позиции курсора
+			assert.Nil(t, filter.After)
+			return len(list), nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	first, err := svc.GetAll(ctx, &models.SubscriptionFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, first.Items, 2)
+	require.NotEmpty(t, first.NextCursor)
+	// Запрашивается на строку больше, чтобы понять, есть ли следующая страница
+	assert.Equal(t, 3, queries[0].Limit)
+	assert.Nil(t, queries[0].After)
+	assert.Equal(t, 5, first.Total)
+
+	second, err := svc.GetAll(ctx, &models.SubscriptionFilter{Limit: 2, Cursor: first.NextCursor})
+	require.NoError(t, err)
+	require.NotNil(t, queries[1].After)
+	assert.Equal(t, list[1].ID, queries[1].After.ID)
+	assert.Equal(t, list[1].CreatedAt.Format(time.RFC3339Nano), queries[1].After.Value)
+	assert.Equal(t, []string{"S2", "S3"}, []string{second.Items[0].ServiceName, second.Items[1].ServiceName})
+
+	last, err := svc.GetAll(ctx, &models.SubscriptionFilter{Limit: 2, Cursor: second.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, last.Items, 1)
+	assert.Empty(t, last.NextCursor)
+	assert.Equal(t, 5, last.Total)
+
+	for _, cursor := range []string{"not base64!", "e30", "bnVsbA"} {
+		_, err = svc.GetAll(ctx, &models.SubscriptionFilter{Limit: 2, Cursor: cursor})
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
+
+func TestSubscriptionService_GetAll_CursorKeepsSort(t *testing.T) {
+	ctx := context.Background()
+	list := []models.Subscription{
+		{ID: uuid.New(), ServiceName: "A", Price: 900},
+		{ID: uuid.New(), ServiceName: "B", Price: 500},
+		{ID: uuid.New(), ServiceName: "C", Price: 100},
+	}
+	var after *models.SubscriptionCursor
+	repo := &mockSubscriptionRepo{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
+			after = filter.After
+			return list[:filter.Limit], nil
+		},
+		countFn: func(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+			return len(list), nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	first, err := svc.GetAll(ctx, &models.SubscriptionFilter{Sort: "-price", Limit: 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, first.NextCursor)
+
+	// Курсор хранит значение поля сортировки последней строки
+	_, err = svc.GetAll(ctx, &models.SubscriptionFilter{Sort: "-price", Limit: 1, Cursor: first.NextCursor})
+	require.NoError(t, err)
+	require.NotNil(t, after)
+	assert.Equal(t, "900", after.Value)
+	assert.Equal(t, list[0].ID, after.ID)
+
+	// С другой сортировкой позиция курсора не имеет смысла
+	for _, sort := range []string{"price", "", "service_name"} {
+		_, err = svc.GetAll(ctx, &models.SubscriptionFilter{Sort: sort, Limit: 1, Cursor: first.NextCursor})
+		assert.ErrorIs(t, err, ErrInvalidCursor, sort)
+	}
+}
+
+func TestSubscriptionService_GetAll_CursorTamperedValue(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockSubscriptionRepo{
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
+			t.Fatal("tampered cursor must not reach the repository")
+			return nil, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	// Значение не того типа упало бы в сравнении в базе
+	tests := []struct {
+		sort  string
+		value string
+	}{
+		{sort: "-price", value: "abc"},
+		{sort: "price", value: "99999999999"},
+		{sort: "start_date", value: "01-2025"},
+		{sort: "-created_at", value: "yesterday"},
+		{sort: "deleted_at", value: "2025-05-01"},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(models.SubscriptionCursor{Sort: tt.sort, Value: tt.value, ID: uuid.New()})
+		require.NoError(t, err)
+		cursor := base64.RawURLEncoding.EncodeToString(data)
+
+		_, err = svc.GetAll(ctx, &models.SubscriptionFilter{Sort: tt.sort, Limit: 1, Cursor: cursor})
+		assert.ErrorIs(t, err, ErrInvalidCursor, tt.sort+" "+tt.value)
+	}
 }
 
 func TestSubscriptionService_Update(t *testing.T) {
@@ -207,19 +528,164 @@ func TestSubscriptionService_Update(t *testing.T) {
 			return sub, nil
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	req := &models.UpdateSubscriptionReq{
 		ServiceName: "Updated",
 		Price:       600,
 		StartDate:   "02-2025",
 	}
-	sub, err := svc.Update(ctx, id, req)
+	sub, err := svc.Update(ctx, id, req, 0)
 	require.NoError(t, err)
 	assert.Equal(t, "Updated", sub.ServiceName)
 	assert.Equal(t, 600, sub.Price)
 }
 
+func TestSubscriptionService_Update_ReplacesOptionalFields(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	months := 6
+	endDate := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+	var updated *models.Subscription
+	repo := &mockSubscriptionRepo{
+		updateAtomicallyFn: func(ctx context.Context, id uuid.UUID, fn func(*models.Subscription) error) (*models.Subscription, error) {
+			sub := &models.Subscription{ID: id, ServiceName: "Old", Price: 100, Currency: "USD", BillingPeriod: models.BillingCustom, BillingMonths: &months, EndDate: &endDate}
+			if err := fn(sub); err != nil {
+				return nil, err
+			}
+			updated = sub
+			return sub, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	// PUT — полная замена: не переданные поля не сохраняются, а получают значения по умолчанию
+	sub, err := svc.Update(ctx, id, &models.UpdateSubscriptionReq{ServiceName: "Old", Price: 100, StartDate: "01-2025"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultCurrency, sub.Currency)
+	assert.Equal(t, models.BillingMonthly, sub.BillingPeriod)
+	assert.Nil(t, sub.BillingMonths)
+	assert.Nil(t, sub.EndDate)
+	// Цена та же — история цен не трогается
+	assert.Nil(t, updated.PriceEffectiveFrom)
+}
+
+// mergePatchReq разбирает тело PATCH так же, как хендлер
+func mergePatchReq(t *testing.T, body string) *models.PatchSubscriptionReq {
+	t.Helper()
+	var req models.PatchSubscriptionReq
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	return &req
+}
+
+func TestSubscriptionService_Patch(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	endDate := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+	repo := &mockSubscriptionRepo{
+		updateAtomicallyFn: func(ctx context.Context, id uuid.UUID, fn func(*models.Subscription) error) (*models.Subscription, error) {
+			sub := &models.Subscription{ID: id, ServiceName: "Okko", Price: 300, Currency: "USD", BillingPeriod: models.BillingYearly,
+				StartDate: time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), EndDate: &endDate}
+			if err := fn(sub); err != nil {
+				return nil, err
+			}
+			return sub, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	// Отсутствующие поля не меняются
+	sub, err := svc.Patch(ctx, id, mergePatchReq(t, `{"service_name":"Okko Premium"}`), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Okko Premium", sub.ServiceName)
+	assert.Equal(t, 300, sub.Price)
+	assert.Equal(t, "USD", sub.Currency)
+	assert.Equal(t, models.BillingYearly, sub.BillingPeriod)
+	assert.Equal(t, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), sub.StartDate)
+	require.NotNil(t, sub.EndDate)
+	assert.Equal(t, endDate, *sub.EndDate)
+
+	// null снимает дату окончания и возвращает умолчания
+	sub, err = svc.Patch(ctx, id, mergePatchReq(t, `{"end_date":null,"currency":null}`), 0)
+	require.NoError(t, err)
+	assert.Nil(t, sub.EndDate)
+	assert.Equal(t, models.DefaultCurrency, sub.Currency)
+	assert.Equal(t, models.BillingYearly, sub.BillingPeriod)
+}
+
+func TestSubscriptionService_Patch_BillingPeriod(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	months := 6
+	repo := &mockSubscriptionRepo{
+		updateAtomicallyFn: func(ctx context.Context, id uuid.UUID, fn func(*models.Subscription) error) (*models.Subscription, error) {
+			sub := &models.Subscription{ID: id, ServiceName: "Netflix", BillingPeriod: models.BillingCustom, BillingMonths: &months}
+			if err := fn(sub); err != nil {
+				return nil, err
+			}
+			return sub, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	// Только длина цикла — период остается custom
+	sub, err := svc.Patch(ctx, id, mergePatchReq(t, `{"billing_months":3}`), 0)
+	require.NoError(t, err)
+	assert.Equal(t, models.BillingCustom, sub.BillingPeriod)
+	assert.Equal(t, 3, *sub.BillingMonths)
+
+	// Смена на годовой период сбрасывает длину цикла
+	sub, err = svc.Patch(ctx, id, mergePatchReq(t, `{"billing_period":"yearly"}`), 0)
+	require.NoError(t, err)
+	assert.Equal(t, models.BillingYearly, sub.BillingPeriod)
+	assert.Nil(t, sub.BillingMonths)
+}
+
+func TestSubscriptionService_Patch_PriceEffectiveFrom(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	var updated *models.Subscription
+	repo := &mockSubscriptionRepo{
+		updateAtomicallyFn: func(ctx context.Context, id uuid.UUID, fn func(*models.Subscription) error) (*models.Subscription, error) {
+			sub := &models.Subscription{ID: id, ServiceName: "Netflix", Price: 400, BillingPeriod: models.BillingMonthly, StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+			if err := fn(sub); err != nil {
+				return nil, err
+			}
+			updated = sub
+			return sub, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	_, err := svc.Patch(ctx, id, mergePatchReq(t, `{"price":500,"price_effective_from":"03-2025"}`), 0)
+	require.NoError(t, err)
+	require.NotNil(t, updated.PriceEffectiveFrom)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), *updated.PriceEffectiveFrom)
+
+	// Репозиторий записывает цену с этой даты и строит начисления по истории
+	charges := BuildCharges(updated, []models.PriceChange{
+		{Price: 400, EffectiveFrom: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Price: 500, EffectiveFrom: *updated.PriceEffectiveFrom},
+	})
+	require.Greater(t, len(charges), 3)
+	assert.Equal(t, 400, charges[1].Amount)
+	assert.Equal(t, 500, charges[2].Amount)
+}
+
+func TestSubscriptionService_Patch_PriceEffectiveFromWithoutPrice(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockSubscriptionRepo{
+		updateAtomicallyFn: func(ctx context.Context, id uuid.UUID, fn func(*models.Subscription) error) (*models.Subscription, error) {
+			return nil, fn(&models.Subscription{ID: id, Price: 400})
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	sub, err := svc.Patch(ctx, uuid.New(), mergePatchReq(t, `{"price_effective_from":"2025-03-01"}`), 0)
+	assert.ErrorIs(t, err, ErrInvalidPriceChange)
+	assert.Nil(t, sub)
+}
+
 func TestSubscriptionService_Update_InvalidDate(t *testing.T) {
 	ctx := context.Background()
 	id := uuid.New()
@@ -229,10 +695,10 @@ func TestSubscriptionService_Update_InvalidDate(t *testing.T) {
 			return nil, fn(sub)
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	req := &models.UpdateSubscriptionReq{StartDate: "invalid"}
-	sub, err := svc.Update(ctx, id, req)
+	sub, err := svc.Update(ctx, id, req, 0)
 	assert.Error(t, err)
 	assert.Nil(t, sub)
 }
@@ -245,24 +711,49 @@ func TestSubscriptionService_Update_NotFound(t *testing.T) {
 			return nil, repository.ErrNotFound
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
-	sub, err := svc.Update(ctx, id, &models.UpdateSubscriptionReq{Price: 100})
+	sub, err := svc.Update(ctx, id, &models.UpdateSubscriptionReq{Price: 100}, 0)
 	assert.ErrorIs(t, err, repository.ErrNotFound)
 	assert.Nil(t, sub)
 }
 
+func TestSubscriptionService_Update_VersionMismatch(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	repo := &mockSubscriptionRepo{
+		updateAtomicallyFn: func(ctx context.Context, id uuid.UUID, fn func(*models.Subscription) error) (*models.Subscription, error) {
+			sub := &models.Subscription{ID: id, ServiceName: "Old", Price: 100, Version: 3}
+			if err := fn(sub); err != nil {
+				return nil, err
+			}
+			return sub, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	// Клиент читал версию 2, а подписка уже на версии 3
+	req := &models.UpdateSubscriptionReq{ServiceName: "New", Price: 100, StartDate: "01-2025"}
+	sub, err := svc.Update(ctx, id, req, 2)
+	assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+	assert.Nil(t, sub)
+
+	sub, err = svc.Update(ctx, id, req, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "New", sub.ServiceName)
+}
+
 func TestSubscriptionService_Delete(t *testing.T) {
 	ctx := context.Background()
 	id := uuid.New()
 	repo := &mockSubscriptionRepo{
-		deleteFn: func(ctx context.Context, id uuid.UUID) error {
+		deleteFn: func(ctx context.Context, id uuid.UUID, version int) error {
 			return nil
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
-	err := svc.Delete(ctx, id)
+	err := svc.Delete(ctx, id, 0)
 	require.NoError(t, err)
 }
 
@@ -270,24 +761,24 @@ func TestSubscriptionService_Delete_NotFound(t *testing.T) {
 	ctx := context.Background()
 	id := uuid.New()
 	repo := &mockSubscriptionRepo{
-		deleteFn: func(ctx context.Context, id uuid.UUID) error {
+		deleteFn: func(ctx context.Context, id uuid.UUID, version int) error {
 			return repository.ErrNotFound
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
-	err := svc.Delete(ctx, id)
+	err := svc.Delete(ctx, id, 0)
 	assert.ErrorIs(t, err, repository.ErrNotFound)
 }
 
 func TestSubscriptionService_GetTotalCost(t *testing.T) {
 	ctx := context.Background()
 	repo := &mockSubscriptionRepo{
-		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) (int, error) {
-			return 1200, nil
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error) {
+			return []models.CurrencyCost{{Currency: "RUB", TotalCost: 1200}}, nil
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	filter := &models.CostFilter{
 		StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -297,19 +788,353 @@ func TestSubscriptionService_GetTotalCost(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, 1200, resp.TotalCost)
 	assert.Equal(t, "RUB", resp.Currency)
+	assert.Len(t, resp.Totals, 1)
+}
+
+func TestSubscriptionService_GetTotalCost_MixedCurrencies(t *testing.T) {
+	ctx := context.Background()
+	totals := []models.CurrencyCost{
+		{Currency: "EUR", TotalCost: 30},
+		{Currency: "RUB", TotalCost: 1200},
+	}
+	repo := &mockSubscriptionRepo{
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error) {
+			return totals, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	resp, err := svc.GetTotalCost(ctx, &models.CostFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, resp.TotalCost)
+	assert.Empty(t, resp.Currency)
+	assert.Equal(t, totals, resp.Totals)
+}
+
+func TestSubscriptionService_GetTotalCost_Empty(t *testing.T) {
+	ctx := context.Background()
+	svc := NewSubscriptionService(&mockSubscriptionRepo{}, &mockChargeRepo{}, nil, nil)
+
+	resp, err := svc.GetTotalCost(ctx, &models.CostFilter{Currency: "USD"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, resp.TotalCost)
+	assert.Equal(t, "USD", resp.Currency)
+	assert.NotNil(t, resp.Totals)
 }
 
 func TestSubscriptionService_GetTotalCost_RepoError(t *testing.T) {
 	ctx := context.Background()
 	repoErr := errors.New("db error")
 	repo := &mockSubscriptionRepo{
-		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) (int, error) {
-			return 0, repoErr
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error) {
+			return nil, repoErr
 		},
 	}
-	svc := NewSubscriptionService(repo)
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
 
 	resp, err := svc.GetTotalCost(ctx, &models.CostFilter{})
 	assert.ErrorIs(t, err, repoErr)
 	assert.Nil(t, resp)
 }
+
+func TestSubscriptionService_GetTotalCost_Converted(t *testing.T) {
+	ctx := context.Background()
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	repo := &mockSubscriptionRepo{
+		getMonthlyCostFn: func(ctx context.Context, filter *models.CostFilter) ([]models.MonthlyCost, error) {
+			return []models.MonthlyCost{
+				{Month: jan, Currency: "RUB", TotalCost: 400},
+				{Month: jan, Currency: "USD", TotalCost: 10},
+				{Month: feb, Currency: "RUB", TotalCost: 400},
+				{Month: feb, Currency: "USD", TotalCost: 10},
+			}, nil
+		},
+	}
+	rates := &mockExchangeRateRepo{
+		getLatestFn: func(ctx context.Context, base, quote string, on time.Time) (*models.ExchangeRate, error) {
+			// Курс USD/RUB есть только на январь
+			if base == "USD" && quote == "RUB" && on.Month() == time.January {
+				return &models.ExchangeRate{BaseCurrency: base, QuoteCurrency: quote, Date: jan, Rate: 90}, nil
+			}
+			return nil, repository.ErrRateNotFound
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, rates, nil)
+
+	resp, err := svc.GetTotalCost(ctx, &models.CostFilter{StartDate: jan, EndDate: feb, TargetCurrency: "RUB"})
+	require.NoError(t, err)
+	assert.Equal(t, 400+900+400, resp.TotalCost)
+	assert.Equal(t, "RUB", resp.Currency)
+	assert.Equal(t, []models.CurrencyCost{
+		{Currency: "RUB", TotalCost: 800},
+		{Currency: "USD", TotalCost: 20},
+	}, resp.Totals)
+	require.Len(t, resp.RatesUsed, 1)
+	assert.Equal(t, models.AppliedRate{Month: "01-2025", From: "USD", To: "RUB", Rate: 90, RateDate: "2025-01-01"}, resp.RatesUsed[0])
+	assert.Equal(t, []models.MissingRate{{Month: "02-2025", Currency: "USD", Amount: 10}}, resp.MissingRates)
+}
+
+func TestSubscriptionService_GetTotalCost_InverseRate(t *testing.T) {
+	ctx := context.Background()
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &mockSubscriptionRepo{
+		getMonthlyCostFn: func(ctx context.Context, filter *models.CostFilter) ([]models.MonthlyCost, error) {
+			return []models.MonthlyCost{{Month: jan, Currency: "RUB", TotalCost: 1000}}, nil
+		},
+	}
+	rates := &mockExchangeRateRepo{
+		getLatestFn: func(ctx context.Context, base, quote string, on time.Time) (*models.ExchangeRate, error) {
+			if base == "USD" && quote == "RUB" {
+				return &models.ExchangeRate{BaseCurrency: base, QuoteCurrency: quote, Date: jan, Rate: 100}, nil
+			}
+			return nil, repository.ErrRateNotFound
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, rates, nil)
+
+	resp, err := svc.GetTotalCost(ctx, &models.CostFilter{StartDate: jan, EndDate: jan, TargetCurrency: "USD"})
+	require.NoError(t, err)
+	assert.Equal(t, 10, resp.TotalCost)
+	assert.Equal(t, "USD", resp.Currency)
+	require.Len(t, resp.RatesUsed, 1)
+	assert.InDelta(t, 0.01, resp.RatesUsed[0].Rate, 1e-9)
+	assert.Empty(t, resp.MissingRates)
+}
+
+func TestSubscriptionService_GetCostBreakdown(t *testing.T) {
+	ctx := context.Background()
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	repo := &mockSubscriptionRepo{
+		getMonthlyCostFn: func(ctx context.Context, filter *models.CostFilter) ([]models.MonthlyCost, error) {
+			return []models.MonthlyCost{
+				{Month: jan, Key: "Netflix", Currency: "USD", TotalCost: 10},
+				{Month: jan, Key: "Yandex Plus", Currency: "RUB", TotalCost: 400},
+				{Month: mar, Key: "Yandex Plus", Currency: "RUB", TotalCost: 400},
+			}, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	resp, err := svc.GetCostBreakdown(ctx, &models.CostFilter{StartDate: jan, EndDate: mar, GroupBy: models.CostGroupByServiceName})
+	require.NoError(t, err)
+	assert.Equal(t, models.CostGroupByServiceName, resp.GroupBy)
+	require.Len(t, resp.Months, 3)
+	assert.Equal(t, "01-2025", resp.Months[0].Month)
+	assert.Len(t, resp.Months[0].Items, 2)
+	// В феврале подписок нет, но месяц присутствует в ряду
+	assert.Equal(t, "02-2025", resp.Months[1].Month)
+	assert.Empty(t, resp.Months[1].Items)
+	assert.Equal(t, []models.CostBreakdownItem{{Key: "Yandex Plus", Currency: "RUB", TotalCost: 400}}, resp.Months[2].Items)
+}
+
+func TestSubscriptionService_GetTotalCost_GroupBy(t *testing.T) {
+	ctx := context.Background()
+	groups := []models.CostGroup{
+		{Key: "Yandex Plus", Currency: "RUB", TotalCost: 4800, Months: 12, SubscriptionCount: 1, Rank: 1},
+	}
+	repo := &mockSubscriptionRepo{
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error) {
+			return []models.CurrencyCost{{Currency: "RUB", TotalCost: 4800}}, nil
+		},
+		getCostGroupsFn: func(ctx context.Context, filter *models.CostFilter) ([]models.CostGroup, error) {
+			assert.Equal(t, 5, filter.Top)
+			return groups, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	resp, err := svc.GetTotalCost(ctx, &models.CostFilter{GroupBy: models.CostGroupByServiceName, Top: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 4800, resp.TotalCost)
+	assert.Equal(t, groups, resp.Groups)
+}
+
+func TestSubscriptionService_GetCharges_NotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockSubscriptionRepo{
+		getByIDFn: func(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+			return nil, repository.ErrNotFound
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	charges, err := svc.GetCharges(ctx, uuid.New())
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Nil(t, charges)
+}
+
+func TestSubscriptionService_RebuildCharges(t *testing.T) {
+	ctx := context.Background()
+	stale := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	var until time.Time
+	var rebuilt []uuid.UUID
+	repo := &mockSubscriptionRepo{
+		staleChargesFn: func(ctx context.Context, u time.Time) ([]uuid.UUID, error) {
+			until = u
+			return stale, nil
+		},
+		rebuildChargesFn: func(ctx context.Context, id uuid.UUID) error {
+			rebuilt = append(rebuilt, id)
+			// Подписку удалили окончательно между поиском и перестройкой
+			if id == stale[1] {
+				return repository.ErrNotFound
+			}
+			return nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	n, err := svc.RebuildCharges(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, stale, rebuilt)
+	assert.Equal(t, chargeHorizon(time.Now()), until)
+}
+
+func TestSubscriptionService_GetTotalCost_ChargeHorizon(t *testing.T) {
+	ctx := context.Background()
+	stale := uuid.New()
+	var rebuilt []uuid.UUID
+	repo := &mockSubscriptionRepo{
+		staleChargesFn: func(ctx context.Context, until time.Time) ([]uuid.UUID, error) {
+			return []uuid.UUID{stale}, nil
+		},
+		rebuildChargesFn: func(ctx context.Context, id uuid.UUID) error {
+			rebuilt = append(rebuilt, id)
+			return nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	// Отчет в пределах горизонта сначала достраивает устаревший журнал
+	end := endOfMonth(addMonths(time.Now(), 6))
+	_, err := svc.GetTotalCost(ctx, &models.CostFilter{StartDate: startOfMonth(time.Now()), EndDate: end})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{stale}, rebuilt)
+
+	// Начислений за горизонтом нет, такой отчет отклоняется, а не возвращает ноль
+	end = addMonths(chargeHorizon(time.Now()), 1)
+	_, err = svc.GetCostBreakdown(ctx, &models.CostFilter{StartDate: startOfMonth(time.Now()), EndDate: end})
+	assert.ErrorIs(t, err, ErrBeyondChargeHorizon)
+	var fieldErr *FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "end_date", fieldErr.Field)
+}
+
+func TestSubscriptionService_Restore(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	restored := false
+	repo := &mockSubscriptionRepo{
+		restoreFn: func(ctx context.Context, subID uuid.UUID) error {
+			restored = true
+			return nil
+		},
+		getByIDFn: func(ctx context.Context, subID uuid.UUID) (*models.Subscription, error) {
+			return &models.Subscription{ID: subID, Price: 400, BillingPeriod: models.BillingMonthly, StartDate: time.Now()}, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	sub, err := svc.Restore(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, id, sub.ID)
+	assert.True(t, restored)
+}
+
+func TestSubscriptionService_Restore_NotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockSubscriptionRepo{
+		restoreFn: func(ctx context.Context, id uuid.UUID) error {
+			return repository.ErrNotFound
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	sub, err := svc.Restore(ctx, uuid.New())
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Nil(t, sub)
+}
+
+func TestSubscriptionService_GetUserSummary(t *testing.T) {
+	userID := uuid.New()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	ended := today.AddDate(0, 0, -1)
+	yearAgo := addMonths(today, -12)
+
+	monthly := models.Subscription{ID: uuid.New(), ServiceName: "Okko", Price: 300, Currency: "RUB", BillingPeriod: models.BillingMonthly, UserID: userID, StartDate: yearAgo}
+	yearly := models.Subscription{ID: uuid.New(), ServiceName: "Spotify", Price: 100, Currency: "USD", BillingPeriod: models.BillingYearly, UserID: userID, StartDate: yearAgo.AddDate(0, 0, 3)}
+	past := models.Subscription{ID: uuid.New(), ServiceName: "Netflix", Price: 500, Currency: "RUB", BillingPeriod: models.BillingMonthly, UserID: userID, StartDate: yearAgo, EndDate: &ended}
+	subs := map[uuid.UUID]*models.Subscription{monthly.ID: &monthly, yearly.ID: &yearly, past.ID: &past}
+
+	var costFilters []*models.CostFilter
+	repo := &mockSubscriptionRepo{
+		countFn: func(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+			assert.Equal(t, &userID, filter.UserID)
+			assert.Equal(t, &today, filter.ActiveAt)
+			return 2, nil
+		},
+		getTotalCostFn: func(ctx context.Context, filter *models.CostFilter) ([]models.CurrencyCost, error) {
+			costFilters = append(costFilters, filter)
+			return []models.CurrencyCost{{Currency: "RUB", TotalCost: 300 * len(costFilters)}}, nil
+		},
+		getAllFn: func(ctx context.Context, filter *models.SubscriptionFilter) ([]models.Subscription, error) {
+			assert.Equal(t, models.SortStartDate, filter.Sort)
+			assert.Zero(t, filter.Limit)
+			return []models.Subscription{monthly, past, yearly}, nil
+		},
+	}
+	charges := &mockChargeRepo{
+		// Начисления всех подписок пользователя приходят одним вызовом
+		nextByUserFn: func(ctx context.Context, id uuid.UUID, after time.Time) ([]models.Charge, error) {
+			assert.Equal(t, userID, id)
+			assert.Equal(t, today, after)
+			var next []models.Charge
+			for _, sub := range subs {
+				for _, charge := range buildCharges(sub, nil, chargeHorizon(today)) {
+					if charge.PeriodStart.After(after) {
+						next = append(next, charge)
+						break
+					}
+				}
+			}
+			return next, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, charges, nil, nil)
+
+	summary, err := svc.GetUserSummary(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.ActiveCount)
+
+	// Текущий месяц целиком, за все время — с начала самой ранней подписки по сегодня
+	require.Len(t, costFilters, 2)
+	assert.Equal(t, startOfMonth(today), costFilters[0].StartDate)
+	assert.Equal(t, endOfMonth(today), costFilters[0].EndDate)
+	assert.Equal(t, yearAgo, costFilters[1].StartDate)
+	assert.Equal(t, today, costFilters[1].EndDate)
+	assert.Equal(t, []models.CurrencyCost{{Currency: "RUB", TotalCost: 300}}, summary.CurrentMonthSpend)
+	assert.Equal(t, []models.CurrencyCost{{Currency: "RUB", TotalCost: 600}}, summary.LifetimeSpend)
+
+	// Сегодняшнее списание уже прошло: ближайшее у месячной — через месяц, у годовой — через три дня
+	require.Len(t, summary.NextRenewals, 2)
+	assert.Equal(t, yearly.ID, summary.NextRenewals[0].SubscriptionID)
+	assert.Equal(t, today.AddDate(0, 0, 3), summary.NextRenewals[0].Date)
+	assert.Equal(t, "USD", summary.NextRenewals[0].Currency)
+	assert.Equal(t, monthly.ID, summary.NextRenewals[1].SubscriptionID)
+	assert.Equal(t, addMonths(yearAgo, 13), summary.NextRenewals[1].Date)
+	assert.Equal(t, 300, summary.NextRenewals[1].Amount)
+}
+
+func TestSubscriptionService_GetUserSummary_NoSubscriptions(t *testing.T) {
+	svc := NewSubscriptionService(&mockSubscriptionRepo{}, &mockChargeRepo{}, nil, nil)
+
+	summary, err := svc.GetUserSummary(context.Background(), uuid.New())
+	require.NoError(t, err)
+	assert.Zero(t, summary.ActiveCount)
+	assert.NotNil(t, summary.CurrentMonthSpend)
+	assert.NotNil(t, summary.LifetimeSpend)
+	assert.NotNil(t, summary.NextRenewals)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"em_tz_anvar/internal/config"
+	"em_tz_anvar/internal/models"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// currencyValidator тот же iso4217, что проверяет binding запросов; отдельный экземпляр нужен
+// для значений, которые приходят не через binding: CSV курсов, query и PATCH
+var currencyValidator = validator.New()
+
+// IsCurrencyCode проверяет, что строка — код валюты из ISO 4217
+func IsCurrencyCode(s string) bool {
+	return currencyValidator.Var(s, "iso4217") == nil
+}
+
+// validateSubscription проверяет подписку, собранную из запроса, перед записью. Проверяется итоговое
+// состояние, поэтому PATCH одного поля сверяется с остальными полями подписки.
+// rules == nil — только обязательные правила, без настраиваемых ограничений
+func validateSubscription(sub *models.Subscription, rules *config.ValidationConfig, now time.Time) error {
+	var fields []FieldError
+	violate := func(field, message string) {
+		fields = append(fields, FieldError{Field: field, Err: errors.New(message)})
+	}
+
+	// Название хранится без пробелов по краям: "Netflix " и "Netflix" — один сервис
+	sub.ServiceName = strings.TrimSpace(sub.ServiceName)
+	if sub.ServiceName == "" {
+		violate("service_name", "must not be blank")
+	}
+
+	// Иначе месяцев между началом и концом меньше нуля, и подписка уменьшает сумму в отчетах
+	if sub.EndDate != nil && sub.EndDate.Before(sub.StartDate) {
+		violate("end_date", "must not be before start_date")
+	}
+
+	if rules != nil {
+		if rules.MaxPrice > 0 && sub.Price > rules.MaxPrice {
+			violate("price", "must not exceed "+strconv.Itoa(rules.MaxPrice))
+		}
+
+		if rules.MaxStartMonthsAhead > 0 {
+			latest := endOfMonth(startOfMonth(now).AddDate(0, rules.MaxStartMonthsAhead, 0))
+			if sub.StartDate.After(latest) {
+				violate("start_date", "must not be more than "+strconv.Itoa(rules.MaxStartMonthsAhead)+" months ahead")
+			}
+		}
+
+		if sub.ServiceName != "" && len(rules.AllowedServiceNames) > 0 && !containsFold(rules.AllowedServiceNames, sub.ServiceName) {
+			violate("service_name", "is not in the service catalog")
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"em_tz_anvar/internal/config"
+	"em_tz_anvar/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSubscription(t *testing.T) {
+	now := time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC)
+	rules := &config.ValidationConfig{MaxPrice: 10000, MaxStartMonthsAhead: 12, AllowedServiceNames: []string{"Netflix", "Yandex Plus"}}
+	date := func(y int, m time.Month, d int) *time.Time {
+		t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	tests := []struct {
+		name   string
+		sub    models.Subscription
+		rules  *config.ValidationConfig
+		fields map[string]string
+	}{
+		{
+			name:  "valid",
+			sub:   models.Subscription{ServiceName: "Netflix", Price: 500, StartDate: *date(2025, 1, 1), EndDate: date(2025, 12, 31)},
+			rules: rules,
+		},
+		{
+			name:  "end date equals start date",
+			sub:   models.Subscription{ServiceName: "Netflix", Price: 500, StartDate: *date(2025, 1, 1), EndDate: date(2025, 1, 1)},
+			rules: rules,
+		},
+		{
+			name:   "end before start",
+			sub:    models.Subscription{ServiceName: "Netflix", Price: 500, StartDate: *date(2025, 3, 1), EndDate: date(2025, 2, 28)},
+			rules:  rules,
+			fields: map[string]string{"end_date": "must not be before start_date"},
+		},
+		{
+			name:   "blank service name",
+			sub:    models.Subscription{ServiceName: "   ", Price: 500, StartDate: *date(2025, 1, 1)},
+			fields: map[string]string{"service_name": "must not be blank"},
+		},
+		{
+			name:   "price over cap",
+			sub:    models.Subscription{ServiceName: "Netflix", Price: 10001, StartDate: *date(2025, 1, 1)},
+			rules:  rules,
+			fields: map[string]string{"price": "must not exceed 10000"},
+		},
+		{
+			name:  "start at the end of the allowed month",
+			sub:   models.Subscription{ServiceName: "Netflix", Price: 500, StartDate: *date(2026, 6, 30)},
+			rules: rules,
+		},
+		{
+			name:   "start too far ahead",
+			sub:    models.Subscription{ServiceName: "Netflix", Price: 500, StartDate: *date(2026, 7, 1)},
+			rules:  rules,
+			fields: map[string]string{"start_date": "must not be more than 12 months ahead"},
+		},
+		{
+			name:  "catalog ignores case",
+			sub:   models.Subscription{ServiceName: "yandex plus", Price: 500, StartDate: *date(2025, 1, 1)},
+			rules: rules,
+		},
+		{
+			name:   "not in catalog",
+			sub:    models.Subscription{ServiceName: "Okko", Price: 500, StartDate: *date(2025, 1, 1)},
+			rules:  rules,
+			fields: map[string]string{"service_name": "is not in the service catalog"},
+		},
+		{
+			name:  "no rules",
+			sub:   models.Subscription{ServiceName: "Okko", Price: 10000000, StartDate: *date(2030, 1, 1)},
+			rules: nil,
+		},
+		{
+			name:  "all violations at once",
+			sub:   models.Subscription{ServiceName: "Okko", Price: 20000, StartDate: *date(2027, 1, 1), EndDate: date(2026, 1, 1)},
+			rules: rules,
+			fields: map[string]string{
+				"service_name": "is not in the service catalog",
+				"end_date":     "must not be before start_date",
+				"price":        "must not exceed 10000",
+				"start_date":   "must not be more than 12 months ahead",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := tt.sub
+			err := validateSubscription(&sub, tt.rules, now)
+			if tt.fields == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrRuleViolation)
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			got := make(map[string]string, len(validationErr.Fields))
+			for _, f := range validationErr.Fields {
+				got[f.Field] = f.Err.Error()
+			}
+			assert.Equal(t, tt.fields, got)
+		})
+	}
+}
+
+func TestValidateSubscription_TrimsServiceName(t *testing.T) {
+	sub := &models.Subscription{ServiceName: "  Netflix ", Price: 500, StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	require.NoError(t, validateSubscription(sub, nil, time.Now()))
+	assert.Equal(t, "Netflix", sub.ServiceName)
+}
+
+func TestSubscriptionService_Create_RuleViolation(t *testing.T) {
+	repo := &mockSubscriptionRepo{
+		createFn: func(ctx context.Context, sub *models.Subscription) error {
+			t.Fatal("invalid subscription must not be stored")
+			return nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, &config.ValidationConfig{MaxPrice: 1000})
+
+	_, err := svc.Create(context.Background(), &models.CreateSubscriptionReq{
+		ServiceName: "Netflix",
+		Price:       1500,
+		UserID:      uuid.New().String(),
+		StartDate:   "03-2025",
+		EndDate:     "01-2025",
+	})
+	assert.ErrorIs(t, err, ErrRuleViolation)
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Fields, 2)
+}
+
+func TestSubscriptionService_Patch_RuleViolation(t *testing.T) {
+	id := uuid.New()
+	repo := &mockSubscriptionRepo{
+		updateAtomicallyFn: func(ctx context.Context, id uuid.UUID, fn func(*models.Subscription) error) (*models.Subscription, error) {
+			sub := &models.Subscription{ID: id, ServiceName: "Netflix", Price: 500, BillingPeriod: models.BillingMonthly, StartDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)}
+			if err := fn(sub); err != nil {
+				return nil, err
+			}
+			return sub, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, nil)
+
+	// end_date сверяется с сохраненной датой начала
+	_, err := svc.Patch(context.Background(), id, mergePatchReq(t, `{"end_date":"01-2025"}`), 0)
+	assert.ErrorIs(t, err, ErrRuleViolation)
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Len(t, validationErr.Fields, 1)
+	assert.Equal(t, "end_date", validationErr.Fields[0].Field)
+}
+
+func TestSubscriptionService_Create_Overlaps(t *testing.T) {
+	existing := uuid.New()
+	req := &models.CreateSubscriptionReq{ServiceName: "Netflix", Price: 500, UserID: uuid.New().String(), StartDate: "03-2025"}
+
+	tests := []struct {
+		mode     string
+		overlaps []uuid.UUID
+		err      error
+		stored   bool
+	}{
+		{mode: "", stored: true},
+		{mode: config.OverlapOff, stored: true},
+		{mode: config.OverlapWarn, overlaps: []uuid.UUID{existing}, stored: true},
+		{mode: config.OverlapReject, err: ErrSubscriptionOverlap},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			stored := false
+			repo := &mockSubscriptionRepo{
+				createFn: func(ctx context.Context, sub *models.Subscription) error {
+					stored = true
+					return nil
+				},
+				findOverlapsFn: func(ctx context.Context, sub *models.Subscription) ([]uuid.UUID, error) {
+					if tt.mode == "" || tt.mode == config.OverlapOff {
+						t.Fatal("overlaps must not be checked when the check is off")
+					}
+					assert.Equal(t, "Netflix", sub.ServiceName)
+					return []uuid.UUID{existing}, nil
+				},
+			}
+			svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, &config.ValidationConfig{OverlapMode: tt.mode})
+
+			sub, err := svc.Create(context.Background(), req)
+			assert.Equal(t, tt.stored, stored)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Contains(t, err.Error(), existing.String())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.overlaps, sub.Overlaps)
+		})
+	}
+}
+
+func TestSubscriptionService_Patch_OverlapReject(t *testing.T) {
+	id := uuid.New()
+	var checked *models.Subscription
+	repo := &mockSubscriptionRepo{
+		updateAtomicallyFn: func(ctx context.Context, id uuid.UUID, fn func(*models.Subscription) error) (*models.Subscription, error) {
+			sub := &models.Subscription{ID: id, ServiceName: "Netflix", Price: 500, BillingPeriod: models.BillingMonthly, StartDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)}
+			if err := fn(sub); err != nil {
+				return nil, err
+			}
+			return sub, nil
+		},
+		findOverlapsFn: func(ctx context.Context, sub *models.Subscription) ([]uuid.UUID, error) {
+			checked = sub
+			return []uuid.UUID{uuid.New()}, nil
+		},
+	}
+	svc := NewSubscriptionService(repo, &mockChargeRepo{}, nil, &config.ValidationConfig{OverlapMode: config.OverlapReject})
+
+	// Проверяется итоговое состояние: сохраненное название с новой датой начала
+	_, err := svc.Patch(context.Background(), id, mergePatchReq(t, `{"start_date":"01-2025"}`), 0)
+	assert.ErrorIs(t, err, ErrSubscriptionOverlap)
+	require.NotNil(t, checked)
+	assert.Equal(t, id, checked.ID)
+	assert.Equal(t, "Netflix", checked.ServiceName)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), checked.StartDate)
+}
+
+func TestSubscriptionService_GetOverlaps_Empty(t *testing.T) {
+	svc := NewSubscriptionService(&mockSubscriptionRepo{}, &mockChargeRepo{}, nil, nil)
+
+	overlaps, err := svc.GetOverlaps(context.Background(), uuid.New())
+	require.NoError(t, err)
+	assert.NotNil(t, overlaps)
+	assert.Empty(t, overlaps)
+}
@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'RUB'
+        CHECK (currency ~ '^[A-Z]{3}$');
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_currency ON subscriptions(currency);
@@ -0,0 +1,9 @@
+-- Курс: 1 единица base_currency = rate единиц quote_currency на дату rate_date
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    base_currency VARCHAR(3) NOT NULL CHECK (base_currency ~ '^[A-Z]{3}$'),
+    quote_currency VARCHAR(3) NOT NULL CHECK (quote_currency ~ '^[A-Z]{3}$'),
+    rate_date DATE NOT NULL,
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (base_currency, quote_currency, rate_date)
+);
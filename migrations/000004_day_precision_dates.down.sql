@@ -0,0 +1,3 @@
+ALTER TABLE subscriptions
+    ALTER COLUMN start_date TYPE TIMESTAMP USING date_trunc('month', start_date),
+    ALTER COLUMN end_date TYPE TIMESTAMP USING date_trunc('month', end_date);
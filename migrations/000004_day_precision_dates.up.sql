@@ -0,0 +1,9 @@
+-- Даты подписки хранятся с точностью до дня.
+-- Раньше end_date указывал на первое число последнего оплаченного месяца — переносим на его последний день
+ALTER TABLE subscriptions
+    ALTER COLUMN start_date TYPE DATE USING start_date::date,
+    ALTER COLUMN end_date TYPE DATE USING end_date::date;
+
+UPDATE subscriptions
+SET end_date = (date_trunc('month', end_date) + interval '1 month' - interval '1 day')::date
+WHERE end_date IS NOT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_billing_months_check;
+
+ALTER TABLE subscriptions
+    DROP COLUMN IF EXISTS billing_months,
+    DROP COLUMN IF EXISTS billing_period;
@@ -0,0 +1,9 @@
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS billing_period VARCHAR(16) NOT NULL DEFAULT 'monthly'
+        CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'yearly', 'custom')),
+    ADD COLUMN IF NOT EXISTS billing_months INTEGER CHECK (billing_months BETWEEN 1 AND 120);
+
+-- Длина цикла в месяцах задается только для custom
+ALTER TABLE subscriptions
+    ADD CONSTRAINT subscriptions_billing_months_check
+        CHECK ((billing_period = 'custom') = (billing_months IS NOT NULL));
@@ -0,0 +1,16 @@
+-- Журнал начислений: строка на каждый цикл списания подписки.
+-- Заполняется сервисом при создании и изменении подписки, для существующих подписок — при старте приложения
+CREATE TABLE IF NOT EXISTS charges (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL,
+    -- последний оплаченный день цикла, не позже end_date подписки
+    period_end DATE NOT NULL CHECK (period_end >= period_start),
+    -- полная длина цикла в днях, для посуточного начисления
+    cycle_days INTEGER NOT NULL CHECK (cycle_days > 0),
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (subscription_id, period_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_charges_period ON charges(period_start, period_end);
@@ -0,0 +1,13 @@
+-- История цен: цена действует с effective_from до следующего изменения
+CREATE TABLE IF NOT EXISTS subscription_price_history (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    price INTEGER NOT NULL CHECK (price > 0),
+    effective_from DATE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (subscription_id, effective_from)
+);
+
+-- Текущая цена существующих подписок считается действующей с начала подписки
+INSERT INTO subscription_price_history (subscription_id, price, effective_from)
+SELECT id, price, start_date FROM subscriptions
+ON CONFLICT DO NOTHING;
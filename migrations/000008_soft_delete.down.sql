@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_subscriptions_deleted_at;
+
+-- Подписки из корзины при откате удаляются окончательно
+DELETE FROM subscriptions WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,14 @@
+-- Журнал изменений подписок. Без внешнего ключа: история остается и после окончательного удаления
+CREATE TABLE IF NOT EXISTS subscription_audit (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id UUID NOT NULL,
+    action VARCHAR(16) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore', 'purge')),
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(128),
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_audit_subscription ON subscription_audit(subscription_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_subscription_audit_created_at ON subscription_audit(created_at);
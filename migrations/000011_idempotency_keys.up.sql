@@ -0,0 +1,15 @@
+-- Ключи идемпотентности POST-запросов: повтор с тем же ключом получает сохраненный ответ.
+-- owner — личность вызывающего (пусто без аутентификации), чтобы клиенты не видели ответы друг друга.
+-- status_code IS NULL — запрос с ключом еще выполняется
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    owner VARCHAR(255) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INTEGER,
+    response BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (owner, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
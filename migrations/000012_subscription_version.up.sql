@@ -0,0 +1,2 @@
+-- Версия строки для оптимистичной блокировки (ETag / If-Match): растет при каждом изменении подписки
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
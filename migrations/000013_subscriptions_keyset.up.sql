@@ -0,0 +1,3 @@
+-- Индексы под keyset-пагинацию списка: активные по (created_at, id), корзина по (deleted_at, id)
+CREATE INDEX IF NOT EXISTS idx_subscriptions_created_at_id ON subscriptions (created_at DESC, id DESC) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_subscriptions_deleted_at_id ON subscriptions (deleted_at DESC, id DESC) WHERE deleted_at IS NOT NULL;
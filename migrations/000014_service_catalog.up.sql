@@ -0,0 +1,50 @@
+-- Каталог сервисов. name_key — нормализованное название: нижний регистр, пробелы по краям убраны, внутри схлопнуты
+CREATE TABLE IF NOT EXISTS services (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    name_key VARCHAR(255) NOT NULL UNIQUE,
+    category VARCHAR(100) NOT NULL DEFAULT '',
+    default_price INTEGER CHECK (default_price > 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'RUB',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Все названия сервиса, включая каноническое: по alias_key подписка находит сервис.
+-- Первичный ключ не дает одному названию принадлежать двум сервисам
+CREATE TABLE IF NOT EXISTS service_aliases (
+    alias_key VARCHAR(255) PRIMARY KEY,
+    alias VARCHAR(255) NOT NULL,
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_aliases_service_id ON service_aliases(service_id);
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS service_id UUID REFERENCES services(id);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_service_id ON subscriptions(service_id);
+
+-- Перенос существующих подписок: сервис на каждое нормализованное название,
+-- каноническим становится самое частое написание
+INSERT INTO services (name, name_key)
+SELECT DISTINCT ON (name_key) name, name_key
+FROM (
+    SELECT btrim(regexp_replace(service_name, '\s+', ' ', 'g')) AS name,
+        lower(btrim(regexp_replace(service_name, '\s+', ' ', 'g'))) AS name_key,
+        COUNT(*) AS uses
+    FROM subscriptions
+    GROUP BY 1, 2
+) AS spellings
+WHERE name_key <> ''
+ORDER BY name_key, uses DESC, name
+ON CONFLICT (name_key) DO NOTHING;
+
+INSERT INTO service_aliases (alias_key, alias, service_id)
+SELECT name_key, name, id FROM services
+ON CONFLICT (alias_key) DO NOTHING;
+
+UPDATE subscriptions s
+SET service_id = sv.id, service_name = sv.name
+FROM services sv
+WHERE s.service_id IS NULL
+    AND sv.name_key = lower(btrim(regexp_replace(s.service_name, '\s+', ' ', 'g')));